@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	bolt "go.etcd.io/bbolt"
+)
+
+// verifyAuditCommand walks the audit log chain of a database that no server has open, or of a backup, and
+// reports every break. It exits with status 1 if the chain is broken. Use GET /audit/verify for a running server.
+func verifyAuditCommand(args []string) {
+	flags := flag.NewFlagSet("verify-audit", flag.ExitOnError)
+	dbPath := flags.String("db", "receipts.db", "database or backup to verify")
+	flags.Parse(args)
+
+	db, err := bolt.Open(*dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		log.Fatalf("failed to open %s, use GET /audit/verify while the server is running: %v", *dbPath, err)
+	}
+	defer db.Close()
+	report, err := audit.Verify(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d audit log entries, head %s\n", report.Entries, report.Head)
+	for _, b := range report.Breaks {
+		fmt.Printf("break at entry %d: %s\n", b.Seq, b.Reason)
+	}
+	if len(report.Breaks) > 0 {
+		db.Close()
+		os.Exit(1)
+	}
+	fmt.Println("the chain is intact")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/backup"
+	bolt "go.etcd.io/bbolt"
+)
+
+// backupCommand writes a backup of a database that no server has open. Use GET /backup for a running server.
+func backupCommand(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	dbPath := flags.String("db", "receipts.db", "database to back up")
+	out := flags.String("out", "", "file to write the backup to (default receipts-<time>.db)")
+	flags.Parse(args)
+	if *out == "" {
+		*out = "receipts-" + time.Now().UTC().Format("20060102T150405Z") + ".db"
+	}
+
+	db, err := bolt.Open(*dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		log.Fatalf("failed to open %s, use GET /backup while the server is running: %v", *dbPath, err)
+	}
+	defer db.Close()
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := backup.WriteTo(db, f); err != nil {
+		f.Close()
+		os.Remove(*out)
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote backup %s\n", *out)
+}
+
+// restoreCommand validates a backup and swaps it in as the database. The server must be stopped.
+func restoreCommand(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbPath := flags.String("db", "receipts.db", "database to replace")
+	from := flags.String("from", "", "backup file to restore")
+	flags.Parse(args)
+	if *from == "" {
+		log.Fatal("restore needs -from")
+	}
+
+	kept, err := backup.Restore(*from, *dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if kept == "" {
+		fmt.Printf("restored %s from %s\n", *dbPath, *from)
+	} else {
+		fmt.Printf("restored %s from %s; the previous database was kept as %s\n", *dbPath, *from, kept)
+	}
+}
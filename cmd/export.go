@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/export"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	bolt "go.etcd.io/bbolt"
+)
+
+// exportCommand writes a tenant's receipts from a database that no server has open. Use GET /receipts/export
+// for a running server.
+func exportCommand(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := flags.String("db", "receipts.db", "database to export from")
+	tenant := flags.String("tenant", service.DefaultTenant, "tenant whose receipts to export")
+	format := flags.String("format", "csv", "csv, ndjson or columnar")
+	out := flags.String("out", "", "file to write, or standard output when empty")
+	var filter service.ReceiptFilter
+	flags.StringVar(&filter.From, "from", "", "earliest purchase date to export, as YYYY-MM-DD")
+	flags.StringVar(&filter.To, "to", "", "latest purchase date to export, as YYYY-MM-DD")
+	flags.StringVar(&filter.Retailer, "retailer", "", "only export receipts of this retailer")
+	flags.Parse(args)
+
+	db, err := bolt.Open(*dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		log.Fatalf("failed to open %s, use GET /receipts/export while the server is running: %v", *dbPath, err)
+	}
+	defer db.Close()
+
+	var dst io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		dst = f
+	}
+	w, err := export.NewWriter(*format, dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := service.NewReceiptService(db).EachReceipt(tenantContext(*tenant), filter, w.Write); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// importCommand stores receipts from a file in a database that no server has open, and prints the result.
+// Use POST /receipts/import for a running server.
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := flags.String("db", "receipts.db", "database to import into")
+	tenant := flags.String("tenant", service.DefaultTenant, "tenant to import the receipts into")
+	format := flags.String("format", "csv", "csv, ndjson or columnar")
+	in := flags.String("in", "", "file to import, or standard input when empty")
+	rescore := flags.Bool("rescore", false, "recalculate points with the tenant's rules instead of keeping the imported points")
+	flags.Parse(args)
+
+	var src io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		src = f
+	}
+	r, err := export.NewReader(*format, src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := database.NewBoltDatabase(*dbPath)
+	defer db.Close()
+	result, err := service.NewReceiptService(db).ImportReceipts(tenantContext(*tenant), r.Read, *rescore)
+	json.NewEncoder(os.Stdout).Encode(result)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// tenantContext returns a context acting in tenant, as the tenant's admin.
+func tenantContext(tenant string) context.Context {
+	return auth.WithPrincipal(context.Background(), &auth.Principal{ID: "cli", Name: "cli", Tenant: tenant, Scopes: []string{auth.ScopeAdmin}})
+}
@@ -1,15 +1,321 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	// store time zones must resolve even where the system has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/backup"
+	"github.com/pranathireddyk/receipt-processor/internal/cache"
 	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/eventlog"
+	"github.com/pranathireddyk/receipt-processor/internal/ingest"
+	"github.com/pranathireddyk/receipt-processor/internal/metrics"
+	"github.com/pranathireddyk/receipt-processor/internal/ratelimit"
+	"github.com/pranathireddyk/receipt-processor/internal/retention"
 	"github.com/pranathireddyk/receipt-processor/internal/server"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/pranathireddyk/receipt-processor/internal/tracing"
+	"github.com/pranathireddyk/receipt-processor/internal/webhook"
 )
 
-// main function initializes and runs the server
+// main function initializes and runs the server, or runs the backup, restore, export, import, migrate and verify-audit commands
 func main() {
-	server := server.NewReceiptServer()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			backupCommand(os.Args[2:])
+			return
+		case "restore":
+			restoreCommand(os.Args[2:])
+			return
+		case "export":
+			exportCommand(os.Args[2:])
+			return
+		case "import":
+			importCommand(os.Args[2:])
+			return
+		case "migrate":
+			migrateCommand(os.Args[2:])
+			return
+		case "verify-audit":
+			verifyAuditCommand(os.Args[2:])
+			return
+		}
+	}
+
+	ingestFile := flag.String("ingest-file", "", "NDJSON file of receipts to tail and process")
+	bootstrapKeyFile := flag.String("bootstrap-key-file", "bootstrap-admin-key", "file the admin api key created on first start is written to, readable only by its owner")
+	jwksFile := flag.String("jwks-file", "", "JWKS file of keys for verifying end user JWTs; reloaded when it changes")
+	jwtIssuer := flag.String("jwt-issuer", "", "required iss claim of end user JWTs")
+	jwtAudience := flag.String("jwt-audience", "", "required aud claim of end user JWTs")
+	traceExporter := flag.String("trace-exporter", "", `OpenTelemetry span exporter: "stdout" or "file:<path>"; tracing is off when empty`)
+	backupDir := flag.String("backup-dir", "", "directory for scheduled backups; scheduled backups are off when empty")
+	backupInterval := flag.Duration("backup-interval", time.Hour, "time between scheduled backups")
+	backupKeep := flag.Int("backup-keep", 7, "number of scheduled backups to keep, or 0 to keep all")
+	retentionDays := flag.Int("retention-days", 0, "days to keep receipts of tenants without their own retention; 0 keeps them forever")
+	retentionAction := flag.String("retention-action", service.RetentionDelete, `what happens to expired receipts: "delete" or "anonymize"`)
+	deadLetterDays := flag.Int("dead-letter-retention-days", 0, "days to keep dead-lettered ingest messages; 0 keeps them forever")
+	webhookWorkers := flag.Int("webhook-workers", webhook.DefaultWorkers, "number of webhook subscriptions delivered to at once")
+	webhookFailureDays := flag.Int("webhook-failure-retention-days", 0, "days to keep failed webhook deliveries; 0 keeps them forever")
+	shutdownDelay := flag.Duration("shutdown-delay", 5*time.Second, "how long /readyz fails before the servers stop accepting requests on shutdown")
+	trustedProxies := flag.String("trusted-proxies", "", "comma separated addresses or CIDRs of reverse proxies whose X-Forwarded-For header is believed; none when empty")
+	maxBodyBytes := flag.Int64("max-body-bytes", server.DefaultMaxBodyBytes, "largest accepted request body in bytes")
+	maxImportBytes := flag.Int64("max-import-bytes", server.DefaultMaxImportBytes, "largest accepted import file in bytes")
+	batchSize := flag.Int("batch-max-size", database.DefaultMaxBatchSize, "most receipts committed in one database transaction")
+	batchDelay := flag.Duration("batch-max-delay", 0, "how long to wait for more receipts before committing a batch that is not full; 0 adds no latency")
+	pointsCacheSize := flag.Int("points-cache-size", service.DefaultPointsCacheSize, "most receipts whose points are cached in memory; 0 disables the cache")
+	pointsCacheTTL := flag.Duration("points-cache-ttl", service.DefaultPointsCacheTTL, "how long cached points are kept; 0 keeps them until evicted")
+	reviewPoints := flag.Int("review-points", service.DefaultReviewPoints, "score above which a receipt is sent for review; 0 disables the check")
+	flagRisk := flag.Int("risk-flag-score", service.DefaultFlagRisk, "risk score from 0 to 100 at which a receipt is sent for review; 0 never flags")
+	blockRisk := flag.Int("risk-block-score", service.DefaultBlockRisk, "risk score from 0 to 100 at which a receipt is refused; 0 never blocks")
+	riskMaxPerHour := flag.Int("risk-max-per-hour", service.DefaultMaxPerHour, "receipts an account may submit in an hour before it adds to the risk score")
+	riskMaxTotal := flag.Float64("risk-max-total", service.DefaultMaxTotal, "largest plausible receipt total; larger totals add to the risk score")
+	maxReceiptAge := flag.Duration("max-receipt-age", service.DefaultMaxReceiptAge, "how long before now a submitted receipt may have been bought; 0 accepts any age")
+	maxFutureSkew := flag.Duration("max-future-skew", service.DefaultMaxFutureSkew, "how far after now a submitted receipt may have been bought; negative accepts any date")
+	purchaseZone := flag.String("purchase-timezone", "UTC", "IANA time zone of receipts that do not give one, for checking the purchase date window")
+	maxItems := flag.Int("max-items", service.DefaultMaxItems, "most items accepted on a receipt")
+	rateLimits := map[string]string{
+		"POST /receipts/process":   "10:20",
+		"GET /receipts/:id/points": "50:100",
+	}
+	flag.Func("rate-limit", `per client limit for a route as "METHOD /path=rate[:burst]", in requests per second; may be repeated`, func(value string) error {
+		route, limit, found := strings.Cut(value, "=")
+		if !found {
+			return errors.New(`expected "METHOD /path=rate[:burst]"`)
+		}
+		rateLimits[route] = limit
+		return nil
+	})
+	flag.Parse()
+
+	if *traceExporter != "" {
+		exporter, err := tracing.NewExporter(*traceExporter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		provider := tracing.Setup(exporter)
+		defer provider.Shutdown(context.Background())
+	}
+
 	db := database.NewBoltDatabase("receipts.db")
-	server.DB = db
-	server.Run(":8080")
 	defer db.Close()
+	// SIGINT or SIGTERM stops the background loops and starts the shutdown below
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+	// failed receives the error of a server or loop that stopped unexpectedly, which shuts the server down too
+	failed := make(chan error, 1)
+	run := func(name string, fn func(ctx context.Context) error) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			if err := fn(ctx); err != nil {
+				select {
+				case failed <- fmt.Errorf("%s: %w", name, err):
+				default:
+					log.Printf("%s: %v\n", name, err)
+				}
+			}
+		}()
+	}
+	svc := service.NewReceiptService(db)
+	svc.MaxItems = *maxItems
+	location, err := time.LoadLocation(*purchaseZone)
+	if err != nil {
+		log.Fatalf("invalid -purchase-timezone: %v", err)
+	}
+	svc.Dates = service.DatePolicy{MaxAge: *maxReceiptAge, MaxFutureSkew: *maxFutureSkew, Location: location}
+	svc.Writes.MaxSize = *batchSize
+	svc.Writes.MaxDelay = *batchDelay
+	svc.ReviewPoints = *reviewPoints
+	detector := service.NewFeatureDetector()
+	detector.MaxPerHour = *riskMaxPerHour
+	detector.MaxTotal = *riskMaxTotal
+	svc.Anomaly = detector
+	svc.FlagRisk = *flagRisk
+	svc.BlockRisk = *blockRisk
+	svc.PointsCache = nil
+	if *pointsCacheSize > 0 {
+		svc.PointsCache = cache.New[string, service.CachedPoints](*pointsCacheSize, *pointsCacheTTL)
+	}
+
+	keys := auth.NewKeyStore(db)
+	bootstrapAdminKey(keys, *bootstrapKeyFile)
+	var jwtVerifier *auth.JWTVerifier
+	if *jwksFile != "" {
+		var err error
+		if jwtVerifier, err = auth.NewJWTVerifier(*jwksFile); err != nil {
+			log.Fatal(err)
+		}
+		jwtVerifier.Issuer = *jwtIssuer
+		jwtVerifier.Audience = *jwtAudience
+		run("jwks watcher", func(ctx context.Context) error {
+			jwtVerifier.Watch(ctx, 10*time.Second)
+			return nil
+		})
+	}
+
+	webhooks := webhook.NewDispatcher(db)
+	webhooks.Workers = *webhookWorkers
+	svc.SubscribeTx(webhooks.Record)
+	svc.Subscribe(webhooks.Notify)
+	svc.OnDeleteTenant(webhooks.DeleteTenant)
+	svc.OnEraseReceipts(webhooks.Erase)
+	run("webhook dispatcher", func(ctx context.Context) error {
+		webhooks.Run(ctx)
+		return nil
+	})
+	events := eventlog.NewLog(db)
+	svc.SubscribeTx(events.Record)
+	svc.Subscribe(events.Notify)
+	svc.OnEraseReceipts(events.Erase)
+	if *backupDir != "" {
+		scheduler := backup.NewScheduler(db, *backupDir)
+		scheduler.Interval = *backupInterval
+		scheduler.Keep = *backupKeep
+		run("backup scheduler", func(ctx context.Context) error {
+			scheduler.Run(ctx)
+			return nil
+		})
+	}
+	janitor := retention.NewJanitor(svc)
+	janitor.Default = service.Retention{Days: *retentionDays, Action: *retentionAction}
+	if err := janitor.Default.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	janitor.DeadLetterDays = *deadLetterDays
+	janitor.WebhookFailureDays = *webhookFailureDays
+	run("retention janitor", func(ctx context.Context) error {
+		janitor.Run(ctx)
+		return nil
+	})
+	appMetrics := metrics.New(db)
+	svc.Subscribe(appMetrics.Observe)
+	if svc.PointsCache != nil {
+		appMetrics.RegisterCache("points", svc.PointsCache.Stats, svc.PointsCache.Len)
+	}
+
+	if *ingestFile != "" {
+		consumer, err := ingest.NewFileConsumer(*ingestFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		run("ingest", func(ctx context.Context) error {
+			return ingest.NewIngester(svc).Run(ctx, consumer)
+		})
+	}
+
+	// gRPC and HTTP share the same service so both transports see the same receipts
+	lis, err := net.Listen("tcp", ":9090")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// both transports share the limiters, so a client has one quota per route
+	limiters := map[string]*ratelimit.Limiter{}
+	for route, spec := range rateLimits {
+		limit, err := ratelimit.ParseLimit(spec)
+		if err != nil {
+			log.Fatalf("invalid rate limit for %s: %v", route, err)
+		}
+		limiters[route] = ratelimit.NewLimiter(limit)
+	}
+	grpcServer := server.NewGRPCReceiptServer(svc, &auth.Multi{Keys: keys, JWT: jwtVerifier}, limiters)
+	run("grpc server", func(context.Context) error {
+		return grpcServer.Serve(lis)
+	})
+
+	server := server.NewReceiptServer()
+	server.Service = svc
+	server.Webhooks = webhooks
+	server.Events = events
+	server.Keys = keys
+	server.JWT = jwtVerifier
+	server.MaxBodyBytes = *maxBodyBytes
+	server.MaxImportBytes = *maxImportBytes
+	server.Metrics = appMetrics
+	server.RateLimits = limiters
+	if *trustedProxies != "" {
+		if err := server.SetTrustedProxies(strings.Split(*trustedProxies, ",")); err != nil {
+			log.Fatalf("invalid -trusted-proxies: %v", err)
+		}
+	}
+
+	httpServer := &http.Server{Addr: ":8080", Handler: server}
+	run("http server", func(context.Context) error {
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+
+	// on SIGINT or SIGTERM fail readiness first, so the orchestrator stops routing here, then drain both servers
+	var failure error
+	select {
+	case <-ctx.Done():
+		log.Println("shutting down")
+		server.BeginShutdown()
+		time.Sleep(*shutdownDelay)
+	case failure = <-failed:
+		log.Printf("shutting down: %v\n", failure)
+		stop()
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("http shutdown: %v\n", err)
+	}
+	grpcServer.GracefulStop()
+	// the loops write to the database, so it is only closed once they have all returned
+	background.Wait()
+	if failure != nil {
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+// bootstrapAdminKey creates an admin api key on first start so the key management endpoints can be reached. The
+// key is written to path, which must not exist yet, with only its owner allowed to read it; the log shows its id.
+func bootstrapAdminKey(keys *auth.KeyStore, path string) {
+	empty, err := keys.Empty()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !empty {
+		return
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatalf("failed to create the bootstrap admin key file: %v", err)
+	}
+	key, token, err := keys.Create("bootstrap", "", []string{auth.ScopeAdmin})
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		log.Fatal(err)
+	}
+	_, err = fmt.Fprintln(file, token)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// revoke the key nobody can read, so the next start creates another
+		keys.Revoke(key.ID)
+		os.Remove(path)
+		log.Fatal(err)
+	}
+	log.Printf("created bootstrap admin api key %s in %s; store it elsewhere and delete the file\n", key.ID, path)
 }
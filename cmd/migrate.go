@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	bolt "go.etcd.io/bbolt"
+)
+
+// migrateCommand migrates a database that no server has open to the latest schema version, or with -dry-run
+// shows the migrations that would run and checks that they succeed. The server also migrates on startup.
+func migrateCommand(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := flags.String("db", "receipts.db", "database to migrate")
+	dryRun := flags.Bool("dry-run", false, "apply the migrations in a transaction that is rolled back")
+	flags.Parse(args)
+
+	db, err := bolt.Open(*dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Fatalf("failed to open %s, stop the server first: %v", *dbPath, err)
+	}
+	defer db.Close()
+	var version int
+	err = db.View(func(tx *bolt.Tx) error {
+		version, err = database.SchemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s is at schema version %d, the latest is %d\n", *dbPath, version, database.LatestVersion())
+
+	migrations, err := database.Migrate(db, *dryRun)
+	for _, m := range migrations {
+		if *dryRun {
+			fmt.Printf("would apply %d: %s\n", m.Version, m.Description)
+		} else {
+			fmt.Printf("applied %d: %s\n", m.Version, m.Description)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
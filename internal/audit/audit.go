@@ -0,0 +1,290 @@
+// Package audit keeps a tamper-evident log of every change made to receipts and configuration.
+//
+// Entries are stored in the audit bucket in the order they were made. Each entry holds the hash of the entry
+// before it and is itself hashed, so the entries form a chain: changing, removing or reordering an entry breaks
+// the chain at that point. The hash of the last entry, the head, is also kept in the meta bucket, so removing
+// entries from the end is detected too. Verify walks the chain and reports every break.
+//
+// Entries cannot be erased, so they never hold an end user's id. A change made by a user is attributed to a
+// pseudonym instead: a keyed hash of the user's id under a random key kept in the meta bucket. The same user
+// always gets the same pseudonym, so their changes can still be told apart and grouped, but the log alone does
+// not say who they are.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionReceiptSubmitted = "receipt.submitted"
+	ActionReceiptImported  = "receipt.imported"
+	ActionPointsAdjusted   = "points.adjusted"
+	ActionReceiptDeleted   = "receipt.deleted"
+	// ActionReceiptDecided is a receipt approved, rejected or reversed by a reviewer.
+	ActionReceiptDecided = "receipt.decided"
+	// ActionReceiptExpired is a receipt deleted or anonymized by retention.
+	ActionReceiptExpired = "receipt.expired"
+	ActionTenantCreated  = "tenant.created"
+	ActionTenantDeleted  = "tenant.deleted"
+	ActionKeyCreated     = "apikey.created"
+	ActionKeyRevoked     = "apikey.revoked"
+	ActionWebhookCreated = "webhook.created"
+	ActionWebhookDeleted = "webhook.deleted"
+)
+
+// Entry is one change in the audit log.
+type Entry struct {
+	// Seq numbers the entries from 1 without gaps.
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Actor is the api key id or user pseudonym of the principal that made the change, or the name of the
+	// background job that made it.
+	Actor string `json:"actor,omitempty"`
+	// Subject is the end user who made the change, if any. It is never stored: Append sets Actor to its pseudonym.
+	Subject   string `json:"-"`
+	RequestID string `json:"requestId,omitempty"`
+	Action    string `json:"action"`
+	Tenant    string `json:"tenant,omitempty"`
+	// Target is the id of what was changed.
+	Target string `json:"target"`
+	// Before and After are hashes of the target before and after the change, empty when it did not exist.
+	// They show what changed without copying the data, which may be personal, into the log.
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+	// PrevHash is the Hash of the previous entry, empty for the first.
+	PrevHash string `json:"prevHash"`
+	// Hash is the sha256 of the entry with Hash left empty.
+	Hash string `json:"hash"`
+}
+
+// Break is a place where the chain does not hold.
+type Break struct {
+	Seq    uint64 `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+// Report is the result of verifying the chain.
+type Report struct {
+	Entries int     `json:"entries"`
+	Head    string  `json:"head"`
+	Breaks  []Break `json:"breaks"`
+}
+
+// head is the last entry of the chain, stored in the meta bucket.
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+var (
+	bucketName = []byte("audit")
+	headKey    = []byte("auditHead")
+	// actorKey is the key user pseudonyms are made with.
+	actorKey = []byte("auditActorKey")
+)
+
+// pseudonymPrefix marks an Actor that is a user pseudonym.
+const pseudonymPrefix = "user:"
+
+// Append adds entry to the end of the chain in tx. Seq, PrevHash and Hash are set by Append, and Time if
+// it is zero. As bolt allows one write transaction at a time, entries are chained in commit order.
+func Append(tx *bolt.Tx, entry Entry) error {
+	meta := tx.Bucket([]byte("meta"))
+	var last head
+	if data := meta.Get(headKey); data != nil {
+		if err := json.Unmarshal(data, &last); err != nil {
+			return fmt.Errorf("invalid audit head: %w", err)
+		}
+	}
+	if entry.Subject != "" {
+		actor, err := pseudonym(meta, entry.Subject)
+		if err != nil {
+			return err
+		}
+		entry.Actor, entry.Subject = actor, ""
+	}
+	entry.Seq = last.Seq + 1
+	entry.PrevHash = last.Hash
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+	hash, err := hashEntry(entry)
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketName).Put(seqKey(entry.Seq), data); err != nil {
+		return err
+	}
+	data, err = json.Marshal(head{Seq: entry.Seq, Hash: entry.Hash})
+	if err != nil {
+		return err
+	}
+	return meta.Put(headKey, data)
+}
+
+// pseudonym returns the actor recorded for changes made by subject, creating the pseudonym key in meta on first use.
+func pseudonym(meta *bolt.Bucket, subject string) (string, error) {
+	key := meta.Get(actorKey)
+	if key == nil {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return "", err
+		}
+		if err := meta.Put(actorKey, key); err != nil {
+			return "", err
+		}
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(subject))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// Record appends entry in a transaction of its own, for changes made outside of the transaction that stored them.
+func Record(db *bolt.DB, entry Entry) error {
+	return db.Update(func(tx *bolt.Tx) error { return Append(tx, entry) })
+}
+
+// Entries returns up to limit entries with a Seq greater than after, oldest first.
+func Entries(db *bolt.DB, after uint64, limit int) ([]Entry, error) {
+	entries := []Entry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek(seqKey(after + 1)); k != nil && len(entries) < limit; k, v = c.Next() {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Verify walks the chain from the first entry and reports every entry whose sequence number, link to the
+// previous entry or hash is wrong, and whether the head still matches the last entry. After a break it
+// carries on from the stored hash, so one changed entry is reported once rather than breaking everything after it.
+func Verify(db *bolt.DB) (Report, error) {
+	report := Report{Breaks: []Break{}}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket, meta := tx.Bucket(bucketName), tx.Bucket([]byte("meta"))
+		if bucket == nil || meta == nil {
+			// a database from before the audit log
+			return nil
+		}
+		var prev head
+		err := bucket.ForEach(func(k, v []byte) error {
+			report.Entries++
+			want := prev.Seq + 1
+			fail := func(reason string, args ...any) {
+				report.Breaks = append(report.Breaks, Break{Seq: want, Reason: fmt.Sprintf(reason, args...)})
+			}
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				fail("entry cannot be decoded: %v", err)
+				prev.Seq = want
+				return nil
+			}
+			if len(k) != 8 || binary.BigEndian.Uint64(k) != want || entry.Seq != want {
+				fail("expected entry %d, found entry %d", want, entry.Seq)
+			}
+			if entry.PrevHash != prev.Hash {
+				fail("previous hash does not match entry %d", prev.Seq)
+			}
+			if hash, err := hashEntry(entry); err != nil || hash != entry.Hash {
+				fail("entry hash does not match its contents")
+			}
+			prev = head{Seq: max(entry.Seq, want), Hash: entry.Hash}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		report.Head = prev.Hash
+
+		var stored head
+		if data := meta.Get(headKey); data != nil {
+			if err := json.Unmarshal(data, &stored); err != nil {
+				report.Breaks = append(report.Breaks, Break{Seq: prev.Seq, Reason: fmt.Sprintf("head cannot be decoded: %v", err)})
+				return nil
+			}
+		}
+		if stored != prev {
+			report.Breaks = append(report.Breaks, Break{Seq: stored.Seq,
+				Reason: fmt.Sprintf("head is entry %d but the last entry is %d; entries were removed from the end or added without the head", stored.Seq, prev.Seq)})
+		}
+		return nil
+	})
+	return report, err
+}
+
+// Hash returns the hex sha256 of data, or "" for nil, for the Before and After of an entry.
+func Hash(data []byte) string {
+	if data == nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashJSON returns the Hash of the JSON encoding of v, or "" for nil.
+func HashJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return Hash(data)
+}
+
+// hashEntry returns the hash of entry with its Hash left out.
+func hashEntry(entry Entry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	return Hash(data), nil
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the id of the request being served, for the entries it records.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request id carried by ctx, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
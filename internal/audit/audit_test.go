@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// the service package, which builds balances when the database is migrated, imports this one
+func TestMain(m *testing.M) {
+	database.BuildBalances = func(*bolt.Tx) error { return nil }
+	os.Exit(m.Run())
+}
+
+// testLog returns a database with n audit entries.
+func testLog(t *testing.T, n int) *bolt.DB {
+	t.Helper()
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	t.Cleanup(func() { db.Close() })
+	for i := 1; i <= n; i++ {
+		entry := Entry{Actor: "key-1", RequestID: fmt.Sprintf("req-%d", i), Action: ActionReceiptSubmitted, Target: fmt.Sprintf("receipt-%d", i), After: Hash([]byte{byte(i)})}
+		assert.NoError(t, Record(db, entry))
+	}
+	return db
+}
+
+func TestAppend(t *testing.T) {
+	db := testLog(t, 3)
+
+	entries, err := Entries(db, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, uint64(1), entries[0].Seq)
+	assert.Empty(t, entries[0].PrevHash)
+	assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	assert.Equal(t, entries[1].Hash, entries[2].PrevHash)
+	assert.Equal(t, "req-3", entries[2].RequestID)
+	assert.False(t, entries[0].Time.IsZero())
+
+	entries, err = Entries(db, 1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, uint64(2), entries[0].Seq)
+}
+
+func TestAppendPseudonymizesSubject(t *testing.T) {
+	db := testLog(t, 0)
+	for _, subject := range []string{"alice@example.com", "bob@example.com", "alice@example.com"} {
+		assert.NoError(t, Record(db, Entry{Actor: "jwt:" + subject, Subject: subject, Action: ActionReceiptSubmitted, Target: "receipt"}))
+	}
+
+	entries, err := Entries(db, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Regexp(t, "^user:[0-9a-f]{32}$", entries[0].Actor)
+	assert.Equal(t, entries[0].Actor, entries[2].Actor, "the same subject gets the same pseudonym")
+	assert.NotEqual(t, entries[0].Actor, entries[1].Actor)
+	assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).ForEach(func(_, data []byte) error {
+			assert.NotContains(t, string(data), "example.com")
+			return nil
+		})
+	}))
+	report, err := Verify(db)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Breaks)
+}
+
+func TestVerify(t *testing.T) {
+	// rewrite changes the stored entry seq with fn
+	rewrite := func(t *testing.T, db *bolt.DB, seq uint64, fn func(*Entry)) {
+		assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			var entry Entry
+			if err := json.Unmarshal(tx.Bucket(bucketName).Get(seqKey(seq)), &entry); err != nil {
+				return err
+			}
+			fn(&entry)
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			return tx.Bucket(bucketName).Put(seqKey(seq), data)
+		}))
+	}
+
+	t.Run("intact chain", func(t *testing.T) {
+		db := testLog(t, 5)
+		report, err := Verify(db)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, report.Entries)
+		assert.Empty(t, report.Breaks)
+		entries, _ := Entries(db, 4, 1)
+		assert.Equal(t, entries[0].Hash, report.Head)
+	})
+
+	t.Run("empty log", func(t *testing.T) {
+		report, err := Verify(testLog(t, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, report.Entries)
+		assert.Empty(t, report.Breaks)
+	})
+
+	t.Run("changed entry", func(t *testing.T) {
+		db := testLog(t, 5)
+		rewrite(t, db, 3, func(entry *Entry) { entry.Actor = "someone-else" })
+		report, err := Verify(db)
+		assert.NoError(t, err)
+		assert.Len(t, report.Breaks, 1)
+		assert.Equal(t, uint64(3), report.Breaks[0].Seq)
+	})
+
+	t.Run("changed and rehashed entry", func(t *testing.T) {
+		db := testLog(t, 5)
+		rewrite(t, db, 3, func(entry *Entry) {
+			entry.Actor = "someone-else"
+			entry.Hash, _ = hashEntry(*entry)
+		})
+		report, err := Verify(db)
+		assert.NoError(t, err)
+		assert.Len(t, report.Breaks, 1)
+		assert.Equal(t, uint64(4), report.Breaks[0].Seq)
+	})
+
+	t.Run("removed entry", func(t *testing.T) {
+		db := testLog(t, 5)
+		assert.NoError(t, db.Update(func(tx *bolt.Tx) error { return tx.Bucket(bucketName).Delete(seqKey(2)) }))
+		report, err := Verify(db)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, report.Entries)
+		assert.NotEmpty(t, report.Breaks)
+		assert.Equal(t, uint64(2), report.Breaks[0].Seq)
+	})
+
+	t.Run("removed last entry", func(t *testing.T) {
+		db := testLog(t, 5)
+		assert.NoError(t, db.Update(func(tx *bolt.Tx) error { return tx.Bucket(bucketName).Delete(seqKey(5)) }))
+		report, err := Verify(db)
+		assert.NoError(t, err)
+		assert.Len(t, report.Breaks, 1)
+		assert.Contains(t, report.Breaks[0].Reason, "head is entry 5")
+	})
+}
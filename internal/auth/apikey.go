@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// keyPrefix marks a bearer token as an API key.
+const keyPrefix = "rpk_"
+
+var (
+	// ErrKeyNotFound is returned when an api key id does not exist.
+	ErrKeyNotFound = errors.New("api key not found")
+	// ErrInvalidKey is returned when an api key is created without a name or with an unknown scope.
+	ErrInvalidKey = errors.New("invalid api key")
+)
+
+// APIKey is the stored form of an api key. Only the SHA-256 hash of the key itself is kept.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// storedKey is the database encoding of an APIKey, which unlike the API response includes the hash.
+type storedKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// IsAPIKey reports whether a bearer token looks like an api key rather than another kind of credential.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, keyPrefix)
+}
+
+// KeyStore creates and verifies api keys stored in the apikeys bucket, keyed by hash.
+type KeyStore struct {
+	DB *bolt.DB
+}
+
+// NewKeyStore creates a KeyStore backed by db.
+func NewKeyStore(db *bolt.DB) *KeyStore {
+	return &KeyStore{DB: db}
+}
+
+// Create generates a new api key bound to tenant, or an operator key if tenant is empty.
+// The returned token is the only copy of the key; it cannot be recovered later.
+func (ks *KeyStore) Create(name, tenant string, scopes []string) (APIKey, string, error) {
+	if name == "" {
+		return APIKey{}, "", fmt.Errorf("%w: name is required", ErrInvalidKey)
+	}
+	if len(scopes) == 0 {
+		return APIKey{}, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidKey)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return APIKey{}, "", fmt.Errorf("%w: unknown scope %q", ErrInvalidKey, scope)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", err
+	}
+	token := keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key := APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Tenant:    tenant,
+		Scopes:    scopes,
+		Hash:      hashToken(token),
+		CreatedAt: time.Now().UTC(),
+	}
+	data, err := json.Marshal(storedKey{APIKey: key, Hash: key.Hash})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	err = ks.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("apikeys")).Put([]byte(key.Hash), data)
+	})
+	return key, token, err
+}
+
+// Authenticate returns the principal for token, or ErrUnauthenticated.
+func (ks *KeyStore) Authenticate(token string) (*Principal, error) {
+	if !IsAPIKey(token) {
+		return nil, ErrUnauthenticated
+	}
+	var key *APIKey
+	err := ks.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte("apikeys")).Get([]byte(hashToken(token)))
+		if data == nil {
+			return ErrUnauthenticated
+		}
+		var stored storedKey
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		key = &stored.APIKey
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{ID: key.ID, Name: key.Name, Tenant: key.Tenant, Scopes: key.Scopes}, nil
+}
+
+// List returns every api key, without hashes.
+func (ks *KeyStore) List() ([]APIKey, error) {
+	keys := []APIKey{}
+	err := ks.forEach(func(_ []byte, key storedKey) error {
+		keys = append(keys, key.APIKey)
+		return nil
+	})
+	return keys, err
+}
+
+// Revoke deletes the api key with the given id.
+func (ks *KeyStore) Revoke(id string) error {
+	return ks.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("apikeys"))
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var stored storedKey
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+			if stored.ID == id {
+				return bucket.Delete(k)
+			}
+		}
+		return ErrKeyNotFound
+	})
+}
+
+// RevokeTenantKeys deletes the api keys bound to tenant in tx, so they can be revoked in the transaction
+// that deletes the tenant.
+func RevokeTenantKeys(tx *bolt.Tx, tenant string) error {
+	bucket := tx.Bucket([]byte("apikeys"))
+	var revoked [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var stored storedKey
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return err
+		}
+		if stored.Tenant == tenant {
+			revoked = append(revoked, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// bolt does not allow changing a bucket while iterating it
+	for _, k := range revoked {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Empty reports whether no api keys have been created yet.
+func (ks *KeyStore) Empty() (bool, error) {
+	empty := true
+	err := ks.DB.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket([]byte("apikeys")).Cursor().First()
+		empty = k == nil
+		return nil
+	})
+	return empty, err
+}
+
+func (ks *KeyStore) forEach(fn func(k []byte, key storedKey) error) error {
+	return ks.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("apikeys")).ForEach(func(k, v []byte) error {
+			var stored storedKey
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+			return fn(k, stored)
+		})
+	})
+}
+
+// hashToken returns the hex SHA-256 of an api key. Keys are 256 bits of randomness, so a fast hash is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
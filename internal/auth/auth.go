@@ -0,0 +1,94 @@
+// Package auth authenticates API clients and carries the authenticated principal through request contexts.
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// Scopes grant access to groups of endpoints. ScopeAdmin implies every other scope.
+const (
+	ScopeSubmit = "submit"
+	ScopeRead   = "read"
+	ScopeAdmin  = "admin"
+)
+
+// DefaultTenant is the tenant of credentials that name none but must not act as operators. It is the same
+// tenant as service.DefaultTenant.
+const DefaultTenant = "default"
+
+// Scopes lists every valid scope.
+var Scopes = []string{ScopeSubmit, ScopeRead, ScopeAdmin}
+
+var (
+	// ErrUnauthenticated is returned when a credential is missing, invalid or revoked.
+	ErrUnauthenticated = errors.New("invalid or missing credentials")
+	// ErrForbidden is returned when a principal lacks the scope an operation requires.
+	ErrForbidden = errors.New("credentials do not have the required scope")
+	// ErrWrongTenant is returned when a principal bound to one tenant asks to act in another.
+	ErrWrongTenant = errors.New("credentials do not belong to the requested tenant")
+)
+
+// Principal is the authenticated client a request is made on behalf of.
+type Principal struct {
+	// ID is the api key id, or "jwt:" followed by the subject for bearer tokens; receipts are attributed to it.
+	ID   string
+	Name string
+	// Account is the end user the principal acts for. It is empty for api keys, which act for no single user.
+	Account string
+	// Tenant is the tenant the principal acts in. It is empty for operator credentials, which are bound to
+	// no tenant and may select one per request.
+	Tenant string
+	Scopes []string
+}
+
+// HasScope reports whether the principal was granted scope, directly or through ScopeAdmin.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// ForTenant returns the principal to use for a request that asked for tenant, which may be empty.
+// Operator principals act in the requested tenant; a principal bound to a different tenant gets ErrWrongTenant.
+func (p *Principal) ForTenant(tenant string) (*Principal, error) {
+	if tenant == "" || tenant == p.Tenant {
+		return p, nil
+	}
+	if p.Tenant != "" {
+		return nil, ErrWrongTenant
+	}
+	scoped := *p
+	scoped.Tenant = tenant
+	return &scoped, nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal stored in ctx, or nil if there is none.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Authenticator turns a bearer credential into a principal.
+type Authenticator interface {
+	Authenticate(token string) (*Principal, error)
+}
+
+// Multi authenticates api keys with Keys and any other bearer token with JWT, if it is configured.
+type Multi struct {
+	Keys *KeyStore
+	JWT  *JWTVerifier
+}
+
+func (m *Multi) Authenticate(token string) (*Principal, error) {
+	if IsAPIKey(token) || m.JWT == nil {
+		return m.Keys.Authenticate(token)
+	}
+	return m.JWT.Authenticate(token)
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultUserScopes are granted to tokens that carry no scope claim, letting end users submit and read their receipts.
+var defaultUserScopes = []string{ScopeSubmit, ScopeRead}
+
+// JWTVerifier verifies RS256 and ES256 bearer tokens against the keys in a local JWKS file.
+// The file is re-read by Watch whenever it changes, so keys can be rotated without a restart.
+type JWTVerifier struct {
+	Path string
+	// Issuer and Audience, when set, must match the token's iss and aud claims.
+	Issuer   string
+	Audience string
+
+	mu      sync.RWMutex
+	keys    map[string]any
+	modTime time.Time
+}
+
+// jwk is the subset of RFC 7517 fields needed for RSA and EC public keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// userClaims are the registered claims plus the OAuth 2.0 scope claim and the tenant the user belongs to.
+type userClaims struct {
+	jwt.RegisteredClaims
+	Scope  string `json:"scope"`
+	Tenant string `json:"tenant"`
+}
+
+// NewJWTVerifier loads the JWKS file at path.
+func NewJWTVerifier(path string) (*JWTVerifier, error) {
+	v := &JWTVerifier{Path: path}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload re-reads the JWKS file, replacing the current keys only if the whole file is valid.
+func (v *JWTVerifier) Reload() error {
+	info, err := os.Stat(v.Path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(v.Path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("invalid jwks file %s: %w", v.Path, err)
+	}
+
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("invalid jwk %q in %s: %w", k.Kid, v.Path, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys = keys
+	v.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the JWKS file whenever its modification time changes, until ctx is done.
+// A file that fails to load is logged and the previous keys stay in use.
+func (v *JWTVerifier) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(v.Path)
+		if err != nil {
+			log.Printf("failed to stat jwks file: %v\n", err)
+			continue
+		}
+		v.mu.RLock()
+		changed := !info.ModTime().Equal(v.modTime)
+		v.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := v.Reload(); err != nil {
+			log.Printf("failed to reload jwks file: %v\n", err)
+		} else {
+			log.Printf("reloaded jwks file %s\n", v.Path)
+		}
+	}
+}
+
+// Authenticate verifies token and returns a principal for its subject.
+// The subject becomes the principal's account, which owns the receipts it submits, and the
+// tenant claim binds the principal to a tenant. Tokens without a tenant claim are bound to DefaultTenant:
+// end users are never operators, whatever their scopes.
+func (v *JWTVerifier) Authenticate(token string) (*Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if v.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.Issuer))
+	}
+	if v.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.Audience))
+	}
+
+	var claims userClaims
+	_, err := jwt.ParseWithClaims(token, &claims, v.keyFor, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrUnauthenticated)
+	}
+
+	scopes := defaultUserScopes
+	if claims.Scope != "" {
+		scopes = strings.Fields(claims.Scope)
+	}
+	tenant := claims.Tenant
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	return &Principal{ID: "jwt:" + claims.Subject, Name: claims.Subject, Account: claims.Subject, Tenant: tenant, Scopes: scopes}, nil
+}
+
+func (v *JWTVerifier) keyFor(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	// an RSA key must only verify RS256 and an EC key only ES256
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, errors.New("key id does not match the signing method")
+		}
+	case *ecdsa.PublicKey:
+		if token.Method != jwt.SigningMethodES256 {
+			return nil, errors.New("key id does not match the signing method")
+		}
+	}
+	return key, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		// ECDH rejects points that are not on the curve
+		if _, err := key.ECDH(); err != nil {
+			return nil, err
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
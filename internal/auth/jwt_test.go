@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]any{"keys": keys})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32)))}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey))
+
+	v, err := NewJWTVerifier(path)
+	assert.NoError(t, err)
+	v.Issuer = "https://login.example.com"
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "user-1", "iss": "https://login.example.com", "exp": exp}
+		for k, val := range extra {
+			c[k] = val
+		}
+		return c
+	}
+
+	t.Run("RS256", func(t *testing.T) {
+		p, err := v.Authenticate(sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(nil)))
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", p.Account)
+		assert.Equal(t, "jwt:user-1", p.ID)
+		assert.Equal(t, DefaultTenant, p.Tenant)
+		assert.True(t, p.HasScope(ScopeSubmit))
+		assert.True(t, p.HasScope(ScopeRead))
+		assert.False(t, p.HasScope(ScopeAdmin))
+	})
+
+	t.Run("ES256 with scope claim", func(t *testing.T) {
+		p, err := v.Authenticate(sign(t, jwt.SigningMethodES256, "ec-1", ecKey, claims(jwt.MapClaims{"scope": "read admin"})))
+		assert.NoError(t, err)
+		assert.True(t, p.HasScope(ScopeAdmin))
+	})
+
+	t.Run("rejected tokens", func(t *testing.T) {
+		otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil))
+		hmacToken.Header["kid"] = "rsa-1"
+		hs, _ := hmacToken.SignedString([]byte("secret"))
+		tokens := map[string]string{
+			"wrong key":    sign(t, jwt.SigningMethodRS256, "rsa-1", otherKey, claims(nil)),
+			"unknown kid":  sign(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, claims(nil)),
+			"expired":      sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})),
+			"no expiry":    sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, jwt.MapClaims{"sub": "user-1", "iss": "https://login.example.com"}),
+			"wrong issuer": sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(jwt.MapClaims{"iss": "https://evil.example.com"})),
+			"no subject":   sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(jwt.MapClaims{"sub": ""})),
+			"HS256":        hs,
+			"garbage":      "not.a.token",
+		}
+		for name, token := range tokens {
+			_, err := v.Authenticate(token)
+			assert.ErrorIs(t, err, ErrUnauthenticated, name)
+		}
+	})
+
+	t.Run("reload rotates keys", func(t *testing.T) {
+		newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		writeJWKS(t, path, rsaJWK("rsa-2", newKey))
+		assert.NoError(t, v.Reload())
+		_, err := v.Authenticate(sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(nil)))
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+		_, err = v.Authenticate(sign(t, jwt.SigningMethodRS256, "rsa-2", newKey, claims(nil)))
+		assert.NoError(t, err)
+
+		// an invalid file keeps the current keys
+		assert.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+		assert.Error(t, v.Reload())
+		_, err = v.Authenticate(sign(t, jwt.SigningMethodRS256, "rsa-2", newKey, claims(nil)))
+		assert.NoError(t, err)
+	})
+}
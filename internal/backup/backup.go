@@ -0,0 +1,245 @@
+// Package backup takes consistent copies of the live bbolt database and restores them.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	bolt "go.etcd.io/bbolt"
+)
+
+// filePrefix and timeLayout name backup files so they sort by the time they were taken.
+const (
+	filePrefix = "receipts-"
+	fileSuffix = ".db"
+	timeLayout = "20060102T150405Z"
+)
+
+// ErrDatabaseInUse is returned by Restore when another process has the target database open.
+var ErrDatabaseInUse = errors.New("database is in use, stop the server before restoring")
+
+// WriteTo writes a consistent copy of db to w from a read transaction, so writers are not blocked.
+func WriteTo(db *bolt.DB, w io.Writer) (int64, error) {
+	var n int64
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// Scheduler writes a backup of DB to Dir every Interval and keeps the newest Keep backups, or all of them if Keep is zero.
+type Scheduler struct {
+	DB       *bolt.DB
+	Dir      string
+	Interval time.Duration
+	Keep     int
+
+	now func() time.Time
+}
+
+// NewScheduler creates a Scheduler that keeps 7 hourly backups of db in dir.
+func NewScheduler(db *bolt.DB, dir string) *Scheduler {
+	return &Scheduler{DB: db, Dir: dir, Interval: time.Hour, Keep: 7, now: time.Now}
+}
+
+// Run takes a backup every Interval until ctx is done. Failed backups are logged and retried at the next interval.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if path, err := s.BackupNow(); err != nil {
+			log.Printf("backup failed: %v\n", err)
+		} else {
+			log.Printf("wrote backup %s\n", path)
+		}
+	}
+}
+
+// BackupNow writes a backup to Dir, then removes all but the newest Keep backups.
+// The backup is written to a temporary file and renamed, so Dir never holds a partial backup.
+func (s *Scheduler) BackupNow() (string, error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.Dir, filePrefix+s.now().UTC().Format(timeLayout)+fileSuffix)
+	tmp, err := os.CreateTemp(s.Dir, ".backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := WriteTo(s.DB, tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, s.prune()
+}
+
+// List returns the paths of the backups in Dir, oldest first.
+func (s *Scheduler) List() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			paths = append(paths, filepath.Join(s.Dir, name))
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func (s *Scheduler) prune() error {
+	paths, err := s.List()
+	if err != nil || s.Keep <= 0 || len(paths) <= s.Keep {
+		return err
+	}
+	for _, path := range paths[:len(paths)-s.Keep] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that the file at path is a consistent bbolt database holding receipts: it has the points
+// bucket, every top level bucket is one the application uses, every points value is a number and its schema
+// version is not newer than this build's. Databases from before migrations only have the points bucket; the
+// server migrates them when it opens them.
+func Validate(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("%s is not a valid database: %w", path, err)
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		// the check runs on its own goroutine until every error has been received
+		var corrupt error
+		for err := range tx.Check() {
+			if corrupt == nil {
+				corrupt = err
+			}
+		}
+		if corrupt != nil {
+			return fmt.Errorf("%s is corrupt: %w", path, corrupt)
+		}
+		if tx.Bucket([]byte("points")) == nil {
+			return fmt.Errorf("%s has no points bucket", path)
+		}
+		version, err := database.SchemaVersion(tx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if version > database.LatestVersion() {
+			return fmt.Errorf("%s: %w: it is at version %d", path, database.ErrSchemaTooNew, version)
+		}
+		known := database.Buckets()
+		err = tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if !slices.Contains(known, string(name)) {
+				return fmt.Errorf("%s has unknown bucket %q", path, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("points")).ForEach(func(k, v []byte) error {
+			if _, err := service.DecodePoints(v); err != nil {
+				return fmt.Errorf("%s has invalid points for receipt %s", path, k)
+			}
+			return nil
+		})
+	})
+}
+
+// keptLayout timestamps the databases Restore keeps, finely enough that restores in a row do not collide.
+const keptLayout = "20060102T150405.000000000Z"
+
+// Restore validates the backup at src and swaps it in as the database at dst. The current database, if any,
+// is kept beside it with a .before-restore suffix and the time of the restore, and its path is returned, so
+// restoring again does not replace it. The server must not be running.
+func Restore(src, dst string) (string, error) {
+	if err := Validate(src); err != nil {
+		return "", err
+	}
+	var kept string
+	if _, err := os.Stat(dst); err == nil {
+		// bbolt locks the file while it is open, so failing to get the lock means the server is running
+		db, err := bolt.Open(dst, 0600, &bolt.Options{Timeout: time.Second})
+		if errors.Is(err, bolt.ErrTimeout) {
+			return "", ErrDatabaseInUse
+		}
+		if err == nil {
+			db.Close()
+		}
+		kept = dst + ".before-restore-" + time.Now().UTC().Format(keptLayout)
+		if _, err := os.Stat(kept); err == nil {
+			return "", fmt.Errorf("%s already exists", kept)
+		}
+	}
+
+	tmp := dst + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if kept != "" {
+		if err := os.Rename(dst, kept); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+	}
+	return kept, os.Rename(tmp, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
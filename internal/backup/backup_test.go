@@ -0,0 +1,136 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func testReceipt() *model.Receipt {
+	return &model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "receipts.db")
+	db := database.NewBoltDatabase(dbPath)
+	id, err := service.NewReceiptService(db).ProcessReceipt(context.Background(), testReceipt())
+	assert.NoError(t, err)
+
+	s := NewScheduler(db, filepath.Join(dir, "backups"))
+	s.Keep = 2
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	t.Run("scheduled backups are pruned", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, err := s.BackupNow()
+			assert.NoError(t, err)
+			now = now.Add(time.Hour)
+		}
+		paths, err := s.List()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "backups", "receipts-20240101T010000Z.db"),
+			filepath.Join(dir, "backups", "receipts-20240101T020000Z.db"),
+		}, paths)
+		for _, path := range paths {
+			assert.NoError(t, Validate(path))
+		}
+	})
+
+	paths, _ := s.List()
+	t.Run("restore refuses a database in use", func(t *testing.T) {
+		_, err := Restore(paths[1], dbPath)
+		assert.ErrorIs(t, err, ErrDatabaseInUse)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		_, err := service.NewReceiptService(db).ProcessReceipt(context.Background(), testReceipt())
+		assert.NoError(t, err)
+		db.Close()
+
+		kept, err := Restore(paths[1], dbPath)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(kept, dbPath+".before-restore-"))
+		_, err = os.Stat(kept)
+		assert.NoError(t, err)
+		// restoring again keeps the restored database too, rather than replacing the first one
+		again, err := Restore(paths[1], dbPath)
+		assert.NoError(t, err)
+		assert.NotEqual(t, kept, again)
+		_, err = os.Stat(kept)
+		assert.NoError(t, err)
+
+		db = database.NewBoltDatabase(dbPath)
+		defer db.Close()
+		points, err := service.GetPoints(id, db)
+		assert.NoError(t, err)
+		assert.Equal(t, 12, points)
+		// the receipt processed after the backup is gone
+		err = db.View(func(tx *bolt.Tx) error {
+			assert.Equal(t, 1, tx.Bucket([]byte("points")).Stats().KeyN)
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	assert.NoError(t, os.WriteFile(garbage, []byte("not a database"), 0600))
+	assert.Error(t, Validate(garbage))
+
+	writeDB := func(name string, fn func(tx *bolt.Tx) error) string {
+		path := filepath.Join(dir, name)
+		db, err := bolt.Open(path, 0600, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Update(fn))
+		db.Close()
+		return path
+	}
+	empty := writeDB("empty.db", func(*bolt.Tx) error { return nil })
+	assert.ErrorContains(t, Validate(empty), "has no points bucket")
+
+	foreign := writeDB("foreign.db", func(tx *bolt.Tx) error {
+		for _, name := range []string{"points", "receipts", "sessions"} {
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.ErrorContains(t, Validate(foreign), `unknown bucket "sessions"`)
+
+	badPoints := writeDB("bad-points.db", func(tx *bolt.Tx) error {
+		tx.CreateBucket([]byte("receipts"))
+		points, err := tx.CreateBucket([]byte("points"))
+		if err != nil {
+			return err
+		}
+		return points.Put([]byte("d49ae048-61cc-4236-a258-1c4b3c2362ab"), []byte("lots"))
+	})
+	assert.ErrorContains(t, Validate(badPoints), "invalid points")
+
+	_, err := Restore(badPoints, filepath.Join(dir, "receipts.db"))
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "receipts.db"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,115 @@
+// Package cache provides a bounded, thread-safe LRU cache whose entries expire.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts lookups and evictions since the cache was created.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Evictions counts entries dropped to make room, not those that expired or were removed.
+	Evictions uint64
+}
+
+// LRU keeps up to Size entries, dropping the least recently used one to make room for a new one.
+// An entry expires TTL after it was added; a TTL of zero keeps entries until they are evicted.
+type LRU[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[K]*list.Element
+	// order has the most recently used entry at the front.
+	order *list.List
+	now   func() time.Time
+
+	hits, misses, evictions atomic.Uint64
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// New creates an LRU holding up to size entries for ttl each.
+func New[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{size: size, ttl: ttl, entries: map[K]*list.Element{}, order: list.New(), now: time.Now}
+}
+
+// Get returns the value for key and whether it was cached and has not expired.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[K, V])
+		if e.expires.IsZero() || c.now().Before(e.expires) {
+			c.order.MoveToFront(el)
+			c.hits.Add(1)
+			return e.value, true
+		}
+		c.remove(el)
+	}
+	c.misses.Add(1)
+	var zero V
+	return zero, false
+}
+
+// Add caches value for key, replacing any value it had.
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = c.now().Add(c.ttl)
+	}
+	if el, ok := c.entries[key]; ok {
+		el.Value = &entry[K, V]{key: key, value: value, expires: expires}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// Remove drops key from the cache.
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge drops every entry.
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[K]*list.Element{}
+	c.order.Init()
+}
+
+// Len returns the number of cached entries, including any that have expired but not been looked up since.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the cache's counters.
+func (c *LRU[K, V]) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Evictions: c.evictions.Load()}
+}
+
+func (c *LRU[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry[K, V]).key)
+}
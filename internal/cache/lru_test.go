@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	c := New[string, int](2, time.Minute)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		c.Add("a", 1)
+		c.Add("b", 2)
+		_, ok := c.Get("a")
+		assert.True(t, ok)
+		c.Add("c", 3)
+
+		_, ok = c.Get("b")
+		assert.False(t, ok)
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+		assert.Equal(t, 2, c.Len())
+		assert.Equal(t, Stats{Hits: 2, Misses: 1, Evictions: 1}, c.Stats())
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		c.Add("a", 10)
+		now = now.Add(59 * time.Second)
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 10, v)
+		now = now.Add(time.Second)
+		_, ok = c.Get("a")
+		assert.False(t, ok)
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("remove and purge", func(t *testing.T) {
+		c.Add("a", 1)
+		c.Remove("a")
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+		c.Add("a", 1)
+		c.Purge()
+		assert.Equal(t, 0, c.Len())
+	})
+}
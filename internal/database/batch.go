@@ -0,0 +1,145 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultMaxBatchSize is the default largest number of writes a Batcher commits in one transaction.
+const DefaultMaxBatchSize = 1000
+
+// Batcher group-commits concurrent writes: writes that arrive while a transaction is being committed are
+// queued and then committed together in the next one, so many writers share one fsync. Unlike bolt.DB.Batch,
+// a writer that finds no commit in flight starts one at once, so a lone writer is not delayed.
+//
+// The first writer to find no commit in flight becomes the leader and commits queued writes until its own
+// is done; if more are queued by then, it hands them to a new goroutine and returns.
+type Batcher struct {
+	DB *bolt.DB
+	// MaxSize is the most writes committed in one transaction.
+	MaxSize int
+	// MaxDelay is how long the leader waits for more writes before committing a batch that is not full.
+	// Zero commits whatever is queued without waiting, which adds no latency.
+	MaxDelay time.Duration
+
+	mu         sync.Mutex
+	pending    []*batchWrite
+	committing bool
+	// full wakes a leader waiting out MaxDelay once MaxSize writes are queued.
+	full chan struct{}
+}
+
+type batchWrite struct {
+	fn   func(*bolt.Tx) error
+	done chan error
+}
+
+// NewBatcher creates a Batcher for db that commits up to DefaultMaxBatchSize writes at a time without waiting.
+func NewBatcher(db *bolt.DB) *Batcher {
+	return &Batcher{DB: db, MaxSize: DefaultMaxBatchSize, full: make(chan struct{}, 1)}
+}
+
+// Update runs fn in a read-write transaction shared with other concurrent writes and returns once that
+// transaction has been committed and synced. fn may run more than once: if any write in a batch fails, the
+// batch is rolled back and each write is retried in its own transaction, so fn's error only fails its own write.
+func (b *Batcher) Update(fn func(*bolt.Tx) error) error {
+	w := &batchWrite{fn: fn, done: make(chan error, 1)}
+	b.mu.Lock()
+	b.pending = append(b.pending, w)
+	if b.committing {
+		if len(b.pending) >= b.MaxSize {
+			select {
+			case b.full <- struct{}{}:
+			default:
+			}
+		}
+		b.mu.Unlock()
+		return <-w.done
+	}
+	b.committing = true
+	b.mu.Unlock()
+
+	for {
+		select {
+		case err := <-w.done:
+			b.mu.Lock()
+			if len(b.pending) == 0 {
+				b.committing = false
+				b.mu.Unlock()
+			} else {
+				b.mu.Unlock()
+				go b.lead()
+			}
+			return err
+		default:
+		}
+		b.commitNext()
+	}
+}
+
+// lead commits batches until the queue is empty.
+func (b *Batcher) lead() {
+	for {
+		b.mu.Lock()
+		if len(b.pending) == 0 {
+			b.committing = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+		b.commitNext()
+	}
+}
+
+// commitNext waits up to MaxDelay for a full batch, then commits the queued writes, up to MaxSize of them.
+func (b *Batcher) commitNext() {
+	if b.MaxDelay > 0 {
+		b.mu.Lock()
+		full := len(b.pending) >= b.MaxSize
+		b.mu.Unlock()
+		if !full {
+			timer := time.NewTimer(b.MaxDelay)
+			select {
+			case <-b.full:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}
+
+	b.mu.Lock()
+	n := min(len(b.pending), max(b.MaxSize, 1))
+	batch := b.pending[:n:n]
+	b.pending = b.pending[n:]
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	failed := -1
+	err := b.DB.Update(func(tx *bolt.Tx) error {
+		for i, w := range batch {
+			if err := w.fn(tx); err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, w := range batch {
+			w.done <- nil
+		}
+		return
+	}
+	// the batch was rolled back; the write that failed gets its error and the rest are retried alone
+	for i, w := range batch {
+		if i == failed {
+			w.done <- err
+		} else {
+			w.done <- b.DB.Update(w.fn)
+		}
+	}
+}
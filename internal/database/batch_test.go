@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBatcher(t *testing.T) {
+	db := NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	b := NewBatcher(db)
+	b.MaxSize = 10
+	b.MaxDelay = 5 * time.Millisecond
+
+	var mu sync.Mutex
+	txSizes := map[*bolt.Tx]int{}
+	put := func(key string) func(*bolt.Tx) error {
+		return func(tx *bolt.Tx) error {
+			mu.Lock()
+			txSizes[tx]++
+			mu.Unlock()
+			if key == "bad" {
+				return errors.New("bad write")
+			}
+			return tx.Bucket([]byte("points")).Put([]byte(key), []byte("1"))
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 50)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint(i)
+			if i == 25 {
+				key = "bad"
+			}
+			errs[i] = b.Update(put(key))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i == 25 {
+			assert.EqualError(t, err, "bad write")
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 49, tx.Bucket([]byte("points")).Stats().KeyN)
+		return nil
+	}))
+	// writes were shared between transactions, and no transaction took more than MaxSize
+	assert.Less(t, len(txSizes), 50)
+	for _, n := range txSizes {
+		assert.LessOrEqual(t, n, b.MaxSize)
+	}
+
+	t.Run("a lone write is not delayed", func(t *testing.T) {
+		b.MaxDelay = 0
+		start := time.Now()
+		assert.NoError(t, b.Update(put("alone")))
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
@@ -2,25 +2,54 @@ package database
 
 import (
 	"log"
+	"slices"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
 
-// NewBoltDatabase initializes the database
+// buckets lists every bucket the application uses:
+//   - points: receipt id -> points awarded
+//   - receipts: receipt id -> the submitted receipt, its points and who submitted it
+//   - apikeys: sha256 of an api key -> api key id, name and scopes
+//   - offsets: ingest consumer name -> last committed offset
+//   - deadletters: receipts from ingest consumers that could not be processed
+//   - webhooks: webhook subscription id -> subscription
+//   - outbox: webhook deliveries waiting to be sent
+//   - webhookfailures: webhook deliveries that exhausted their retries
+//   - events: the most recent receipt events, keyed by event id
+//   - tenants: tenant id -> tenant name and rule set
+//   - tenantdata: one nested bucket per tenant holding its own points and receipts buckets;
+//     the default tenant uses the top level points and receipts buckets instead
+//   - deletions: audit records of receipts erased on request, in the order they were deleted
+//   - adjustments: one nested bucket per receipt id holding its manual points adjustments, in the order they were made
+//   - fingerprints: hash of a receipt's contents -> id of the first receipt with them, to recognise duplicates
+//   - balances: account -> the points of its receipts, kept when retention removes the receipts
+//   - audit: the audit log, keyed by sequence number, see package audit
+//   - meta: the schema version, see migrations, and the head of the audit log
+//
+// Buckets are created by migrations, so adding one here also needs a migration.
+var buckets = []string{"points", "receipts", "apikeys", "offsets", "deadletters", "webhooks", "outbox", "webhookfailures", "events", "tenants", "tenantdata", "deletions", "adjustments", "fingerprints", "balances", "audit", "meta"}
+
+// Buckets returns the names of the top level buckets every database must have.
+func Buckets() []string {
+	return slices.Clone(buckets)
+}
+
+// NewBoltDatabase opens the database and migrates it to the latest schema version. It exits if the
+// database was written by a newer build.
 func NewBoltDatabase(dbname string) *bolt.DB {
 	db, err := bolt.Open(dbname, 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
 		log.Fatal(err)
 	}
-	// Initialize the points bucket in the database
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("points"))
-		return err
-	})
+	applied, err := Migrate(db, false)
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, m := range applied {
+		log.Printf("migrated %s to schema version %d: %s\n", dbname, m.Version, m.Description)
+	}
 
 	return db
 }
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrSchemaTooNew is returned when a database was last migrated by a newer build than this one. Its data may
+// be in encodings this build cannot read, so it must not be opened.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// Migration moves the database from schema version Version-1 to Version.
+type Migration struct {
+	Version     int
+	Description string
+	// Up changes the database. It runs in the same transaction that records the new schema version, so a
+	// migration is applied completely or not at all.
+	Up func(tx *bolt.Tx) error
+}
+
+// BuildBalances builds every tenant's balances from its stored receipts in tx. Only the service package can
+// decode receipts, so it sets BuildBalances when it is linked in; until then the migration that runs it fails.
+var BuildBalances func(tx *bolt.Tx) error
+
+// errNoBalanceBuilder is returned by the balances migration when BuildBalances is not set.
+var errNoBalanceBuilder = errors.New("no balance builder is linked into this build")
+
+// migrations lists every migration in version order. Never change a migration that has been released; add a
+// new one instead. A migration that adds a bucket must also add it to buckets.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create the application buckets and the meta bucket",
+		Up: func(tx *bolt.Tx) error {
+			// the buckets as of schema version 1; the first databases only had points
+			for _, name := range []string{"points", "receipts", "apikeys", "offsets", "deadletters", "webhooks", "outbox",
+				"webhookfailures", "events", "tenants", "tenantdata", "deletions", "meta"} {
+				if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "create the adjustments bucket",
+		Up: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("adjustments"))
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "create the audit bucket",
+		Up: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("audit"))
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "create the fingerprints bucket",
+		Up: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("fingerprints"))
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "create the balances bucket",
+		Up: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("balances"))
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "build the account balances from the stored receipts",
+		Up: func(tx *bolt.Tx) error {
+			if BuildBalances == nil {
+				return errNoBalanceBuilder
+			}
+			return BuildBalances(tx)
+		},
+	},
+}
+
+// schemaVersionKey holds the schema version in the meta bucket, as a decimal string.
+var schemaVersionKey = []byte("schemaVersion")
+
+// LatestVersion returns the schema version this build migrates databases to.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the schema version recorded in the database. Databases created before
+// migrations existed have no meta bucket and are at version 0.
+func SchemaVersion(tx *bolt.Tx) (int, error) {
+	meta := tx.Bucket([]byte("meta"))
+	if meta == nil {
+		return 0, nil
+	}
+	data := meta.Get(schemaVersionKey)
+	if data == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", data, err)
+	}
+	return version, nil
+}
+
+// Migrate applies the migrations the database has not had yet, in order, each in its own transaction, and
+// returns them. With dryRun, the migrations are applied in a single transaction that is then rolled back,
+// which checks that they succeed without changing anything. It returns ErrSchemaTooNew, and changes nothing,
+// if the database is at a newer version than LatestVersion.
+func Migrate(db *bolt.DB, dryRun bool) ([]Migration, error) {
+	var version int
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = SchemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if version > LatestVersion() {
+		return nil, fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, version, LatestVersion())
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	if dryRun {
+		err := db.Update(func(tx *bolt.Tx) error {
+			for _, m := range pending {
+				if err := apply(tx, m); err != nil {
+					return err
+				}
+			}
+			return errDryRun
+		})
+		if !errors.Is(err, errDryRun) {
+			return pending, err
+		}
+		return pending, nil
+	}
+	for i, m := range pending {
+		if err := db.Update(func(tx *bolt.Tx) error { return apply(tx, m) }); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+// apply runs m and records its version.
+func apply(tx *bolt.Tx, m Migration) error {
+	if err := m.Up(tx); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+	}
+	meta, err := tx.CreateBucketIfNotExists([]byte("meta"))
+	if err != nil {
+		return err
+	}
+	return meta.Put(schemaVersionKey, []byte(strconv.Itoa(m.Version)))
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// the service package, which builds balances, cannot be imported here
+func TestMain(m *testing.M) {
+	BuildBalances = func(*bolt.Tx) error { return nil }
+	os.Exit(m.Run())
+}
+
+// legacyDatabase creates a database as the first release left it: only a points bucket holding decimal strings.
+func legacyDatabase(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	db, err := bolt.Open(path, 0600, nil)
+	assert.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		points, err := tx.CreateBucket([]byte("points"))
+		if err != nil {
+			return err
+		}
+		return points.Put([]byte("7fb1377b-b223-49d9-a31a-5a02701dd310"), []byte("28"))
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+	return path
+}
+
+func schemaVersion(t *testing.T, db *bolt.DB) int {
+	t.Helper()
+	var version int
+	assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = SchemaVersion(tx)
+		return err
+	}))
+	return version
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("dry run changes nothing", func(t *testing.T) {
+		db, err := bolt.Open(legacyDatabase(t), 0600, nil)
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pending, err := Migrate(db, true)
+		assert.NoError(t, err)
+		assert.Len(t, pending, len(migrations))
+		assert.Equal(t, 0, schemaVersion(t, db))
+		assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+			assert.Nil(t, tx.Bucket([]byte("receipts")))
+			return nil
+		}))
+	})
+
+	t.Run("legacy database migrates forward", func(t *testing.T) {
+		db := NewBoltDatabase(legacyDatabase(t))
+		defer db.Close()
+
+		assert.Equal(t, LatestVersion(), schemaVersion(t, db))
+		assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+			for _, name := range Buckets() {
+				assert.NotNil(t, tx.Bucket([]byte(name)), name)
+			}
+			assert.Equal(t, "28", string(tx.Bucket([]byte("points")).Get([]byte("7fb1377b-b223-49d9-a31a-5a02701dd310"))))
+			return nil
+		}))
+
+		applied, err := Migrate(db, false)
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("newer schema is refused", func(t *testing.T) {
+		db := NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+		defer db.Close()
+		assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte("meta")).Put(schemaVersionKey, []byte("999"))
+		}))
+
+		_, err := Migrate(db, false)
+		assert.ErrorIs(t, err, ErrSchemaTooNew)
+		_, err = Migrate(db, true)
+		assert.ErrorIs(t, err, ErrSchemaTooNew)
+	})
+}
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, m.Description)
+	}
+}
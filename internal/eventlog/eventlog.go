@@ -0,0 +1,178 @@
+// Package eventlog keeps a bounded, persistent log of receipt events and fans new entries out to live listeners.
+package eventlog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Entry is an event with its position in the log.
+type Entry struct {
+	ID    uint64
+	Event service.Event
+}
+
+// Log stores the most recent MaxEvents events in the events bucket.
+type Log struct {
+	DB        *bolt.DB
+	MaxEvents uint64
+	mu        sync.Mutex
+	listeners map[chan Entry]struct{}
+	// notified is the id of the last entry sent to listeners.
+	notified uint64
+}
+
+// listenerBuffer is how many entries a listener may fall behind before it is dropped.
+const listenerBuffer = 64
+
+// NewLog creates a Log that keeps the last 1000 events in db.
+func NewLog(db *bolt.DB) *Log {
+	l := &Log{DB: db, MaxEvents: 1000, listeners: map[chan Entry]struct{}{}}
+	// listeners only receive entries appended from now on
+	err := db.View(func(tx *bolt.Tx) error {
+		l.notified = tx.Bucket([]byte("events")).Sequence()
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return l
+}
+
+// Record stores the event and trims the log to MaxEvents in tx, the transaction storing the change the event
+// describes. It is meant to be passed to ReceiptService.SubscribeTx, with Notify passed to ReceiptService.Subscribe.
+func (l *Log) Record(tx *bolt.Tx, event service.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	bucket := tx.Bucket([]byte("events"))
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put(idKey(id), data); err != nil {
+		return err
+	}
+	if id <= l.MaxEvents {
+		return nil
+	}
+	cutoff := id - l.MaxEvents
+	c := bucket.Cursor()
+	for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= cutoff; k, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Erase deletes the entries about tenant's receipts ids in tx, the transaction erasing or anonymizing them, as
+// they name the receipts' account and retailer. It is meant to be passed to ReceiptService.OnEraseReceipts.
+func (l *Log) Erase(tx *bolt.Tx, tenant string, ids []string) error {
+	erased := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		erased[id] = true
+	}
+	bucket := tx.Bucket([]byte("events"))
+	var keys [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var event service.Event
+		if err := json.Unmarshal(v, &event); err != nil {
+			return err
+		}
+		if event.Tenant == tenant && erased[event.ReceiptID] {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notify sends listeners the entries committed since they were last notified, in id order. Entries are read
+// back from the log rather than taken from the event, as transactions may commit in a different order than
+// their events are published.
+func (l *Log) Notify(service.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries, err := l.Since(l.notified)
+	if err != nil {
+		log.Printf("failed to read events to notify: %v\n", err)
+		return
+	}
+	for _, entry := range entries {
+		l.notified = entry.ID
+		for ch := range l.listeners {
+			select {
+			case ch <- entry:
+			default:
+				// too slow to keep up; closing tells the listener to reconnect with its last id
+				delete(l.listeners, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// Append stores the event in a transaction of its own and notifies listeners.
+func (l *Log) Append(event service.Event) {
+	if err := l.DB.Update(func(tx *bolt.Tx) error { return l.Record(tx, event) }); err != nil {
+		log.Printf("failed to append %s event: %v\n", event.Type, err)
+		return
+	}
+	l.Notify(event)
+}
+
+// Since returns the retained entries with an id greater than id, oldest first.
+func (l *Log) Since(id uint64) ([]Entry, error) {
+	var entries []Entry
+	err := l.DB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("events")).Cursor()
+		for k, v := c.Seek(idKey(id + 1)); k != nil; k, v = c.Next() {
+			entry := Entry{ID: binary.BigEndian.Uint64(k)}
+			if err := json.Unmarshal(v, &entry.Event); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Listen returns a channel receiving every entry appended from now on, and a function to stop listening.
+// The channel is closed if the listener falls too far behind.
+func (l *Log) Listen() (<-chan Entry, func()) {
+	ch := make(chan Entry, listenerBuffer)
+	l.mu.Lock()
+	l.listeners[ch] = struct{}{}
+	l.mu.Unlock()
+
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.listeners[ch]; ok {
+			delete(l.listeners, ch)
+			close(ch)
+		}
+	}
+}
+
+func idKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
@@ -0,0 +1,175 @@
+package eventlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/pranathireddyk/receipt-processor/internal/webhook"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+var testReceipt = &model.Receipt{
+	Retailer:     "Target",
+	PurchaseDate: "2022-01-01",
+	PurchaseTime: "13:01",
+	Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+	Total:        "6.49",
+}
+
+func TestLogIsBounded(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	l := NewLog(db)
+	l.MaxEvents = 3
+	live, stop := l.Listen()
+	defer stop()
+
+	for i := 1; i <= 5; i++ {
+		l.Append(service.Event{Type: service.EventReceiptScored, Points: i})
+	}
+
+	entries, err := l.Since(0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, uint64(3), entries[0].ID)
+	assert.Equal(t, 3, entries[0].Event.Points)
+
+	entries, err = l.Since(4)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, uint64(5), entries[0].ID)
+
+	for i := uint64(1); i <= 5; i++ {
+		entry := <-live
+		assert.Equal(t, i, entry.ID)
+	}
+}
+
+func TestRecordCommitsWithTheChange(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	l := NewLog(db)
+	svc.SubscribeTx(l.Record)
+	svc.Subscribe(l.Notify)
+	errFull := errors.New("full")
+	svc.SubscribeTx(func(_ *bolt.Tx, event service.Event) error {
+		if event.Type == service.EventPointsAdjusted {
+			return errFull
+		}
+		return nil
+	})
+	live, stop := l.Listen()
+	defer stop()
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "admin", Scopes: []string{auth.ScopeAdmin}})
+
+	id, err := svc.ProcessReceipt(ctx, testReceipt)
+	assert.NoError(t, err)
+	entry := <-live
+	assert.Equal(t, service.EventReceiptScored, entry.Event.Type)
+	assert.Equal(t, id, entry.Event.ReceiptID)
+	assert.False(t, entry.Event.Time.IsZero())
+
+	// a change that fails to record its event is not stored, and neither is the event
+	_, _, err = svc.AdjustPoints(ctx, id, 5, "goodwill")
+	assert.ErrorIs(t, err, errFull)
+	history, err := svc.PointsHistory(ctx, id)
+	assert.NoError(t, err)
+	assert.Empty(t, history.Adjustments)
+	entries, err := l.Since(entry.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestErasureRemovesCopies(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	events := NewLog(db)
+	svc.SubscribeTx(events.Record)
+	svc.OnEraseReceipts(events.Erase)
+	webhooks := webhook.NewDispatcher(db)
+	svc.SubscribeTx(webhooks.Record)
+	svc.OnEraseReceipts(webhooks.Erase)
+	_, err := webhooks.CreateSubscription(webhook.Subscription{URL: "https://example.com/hook", Events: []string{service.EventReceiptScored}})
+	assert.NoError(t, err)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "pos", Account: "alice", Scopes: []string{auth.ScopeAdmin}})
+	erased, err := svc.ProcessReceipt(ctx, testReceipt)
+	assert.NoError(t, err)
+	// a delivery of the erased receipt that already failed for good
+	pending, err := webhooks.Pending()
+	assert.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		data, _ := json.Marshal(pending[0])
+		return tx.Bucket([]byte("webhookfailures")).Put([]byte(pending[0].ID), data)
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, svc.DeleteReceipt(ctx, erased, "erasure request"))
+	// the deletion event is recorded after the receipt's copies are erased, so subscribers hear of it
+	entries, err := events.Since(0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, service.EventReceiptDeleted, entries[0].Event.Type)
+	pending, err = webhooks.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	err = db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 0, tx.Bucket([]byte("webhookfailures")).Stats().KeyN)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// retention removes the copies of the receipts it anonymizes too
+	expired, err := svc.ProcessReceipt(ctx, testReceipt)
+	assert.NoError(t, err)
+	n, err := svc.PurgeReceipts(service.DefaultTenant, time.Now().Add(time.Hour), service.Retention{Action: service.RetentionAnonymize})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	entries, err = events.Since(entries[0].ID)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	pending, err = webhooks.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	record, err := svc.GetReceipt(context.Background(), expired)
+	assert.NoError(t, err)
+	assert.True(t, record.Anonymized)
+}
+
+// BenchmarkProcessReceiptWithSubscribers submits receipts from many goroutines at once with the event log and
+// the webhook outbox attached as in the server, with one webhook subscribed to every submission.
+func BenchmarkProcessReceiptWithSubscribers(b *testing.B) {
+	db := database.NewBoltDatabase(filepath.Join(b.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	webhooks := webhook.NewDispatcher(db)
+	_, err := webhooks.CreateSubscription(webhook.Subscription{URL: "https://example.com/hook", Events: []string{service.EventReceiptScored}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	svc.SubscribeTx(webhooks.Record)
+	svc.Subscribe(webhooks.Notify)
+	events := NewLog(db)
+	svc.SubscribeTx(events.Record)
+	svc.Subscribe(events.Notify)
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := svc.ProcessReceipt(context.Background(), testReceipt); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "receipts/s")
+}
@@ -0,0 +1,209 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+)
+
+// The columnar format is laid out like Parquet, without needing a Parquet library to read it: a
+// gzip-compressed stream of JSON lines, where the first line is a columnarHeader and every following
+// line is a row group holding up to rowGroupSize receipts, one array per column. Storing each column
+// together lets values that repeat, such as retailers and dates, compress well, and lets analysis tools
+// load a column without decoding whole receipts.
+
+// columnarFormat and columnarVersion identify the format in the header line.
+const (
+	columnarFormat  = "receipts-columnar"
+	columnarVersion = 1
+)
+
+// rowGroupSize is the most receipts in one row group.
+const rowGroupSize = 1000
+
+type columnarHeader struct {
+	Format  string   `json:"format"`
+	Version int      `json:"version"`
+	Columns []string `json:"columns"`
+}
+
+// rowGroup holds one column per receipt field. Every column has Rows entries. Points include the
+// receipts' adjustments.
+type rowGroup struct {
+	Rows         int            `json:"rows"`
+	ID           []string       `json:"id"`
+	Tenant       []string       `json:"tenant"`
+	Retailer     []string       `json:"retailer"`
+	PurchaseDate []string       `json:"purchaseDate"`
+	PurchaseTime []string       `json:"purchaseTime"`
+	Total        []string       `json:"total"`
+	Points       []int          `json:"points"`
+	Items        [][]model.Item `json:"items"`
+	SubmittedAt  []time.Time    `json:"submittedAt"`
+	SubmittedBy  []string       `json:"submittedBy"`
+	Account      []string       `json:"account"`
+	// Status was added after the first release, so files without it are still read.
+	Status []string `json:"status,omitempty"`
+	// PurchaseTimezone was added later still, so it is optional too.
+	PurchaseTimezone []string `json:"purchaseTimezone,omitempty"`
+	// Adjustment is the net delta of the receipt's adjustments, and optional like the columns above.
+	Adjustment []int `json:"adjustment,omitempty"`
+}
+
+var columnarColumns = []string{"id", "tenant", "retailer", "purchaseDate", "purchaseTime", "total", "points", "items", "submittedAt", "submittedBy", "account", "status", "purchaseTimezone", "adjustment"}
+
+func (g *rowGroup) append(record *service.StoredReceipt) {
+	g.Rows++
+	g.ID = append(g.ID, record.ID)
+	g.Tenant = append(g.Tenant, record.Tenant)
+	g.Retailer = append(g.Retailer, record.Receipt.Retailer)
+	g.PurchaseDate = append(g.PurchaseDate, record.Receipt.PurchaseDate)
+	g.PurchaseTime = append(g.PurchaseTime, record.Receipt.PurchaseTime)
+	g.Total = append(g.Total, record.Receipt.Total)
+	g.Points = append(g.Points, record.AdjustedPoints())
+	g.Items = append(g.Items, record.Receipt.Items)
+	g.SubmittedAt = append(g.SubmittedAt, record.SubmittedAt)
+	g.SubmittedBy = append(g.SubmittedBy, record.SubmittedBy)
+	g.Account = append(g.Account, record.Account)
+	g.Status = append(g.Status, record.Status)
+	g.PurchaseTimezone = append(g.PurchaseTimezone, record.Receipt.PurchaseTimezone)
+	g.Adjustment = append(g.Adjustment, record.AdjustedPoints()-record.Points)
+}
+
+// record returns the receipt in row i.
+func (g *rowGroup) record(i int) *service.StoredReceipt {
+	record := &service.StoredReceipt{
+		ID:     g.ID[i],
+		Tenant: g.Tenant[i],
+		Receipt: model.Receipt{
+			Retailer:     g.Retailer[i],
+			PurchaseDate: g.PurchaseDate[i],
+			PurchaseTime: g.PurchaseTime[i],
+			Total:        g.Total[i],
+			Items:        g.Items[i],
+		},
+		Points:      g.Points[i],
+		SubmittedAt: g.SubmittedAt[i],
+		SubmittedBy: g.SubmittedBy[i],
+		Account:     g.Account[i],
+	}
+	if len(g.Status) > 0 {
+		record.Status = g.Status[i]
+	}
+	if len(g.PurchaseTimezone) > 0 {
+		record.Receipt.PurchaseTimezone = g.PurchaseTimezone[i]
+	}
+	if len(g.Adjustment) > 0 {
+		setAdjustment(record, g.Adjustment[i])
+	}
+	return record
+}
+
+// valid reports whether every column has a value for each row.
+func (g *rowGroup) valid() bool {
+	for _, n := range []int{len(g.ID), len(g.Tenant), len(g.Retailer), len(g.PurchaseDate), len(g.PurchaseTime),
+		len(g.Total), len(g.Points), len(g.Items), len(g.SubmittedAt), len(g.SubmittedBy), len(g.Account)} {
+		if n != g.Rows {
+			return false
+		}
+	}
+	for _, n := range []int{len(g.Status), len(g.PurchaseTimezone), len(g.Adjustment)} {
+		if n != 0 && n != g.Rows {
+			return false
+		}
+	}
+	return true
+}
+
+type columnarWriter struct {
+	gz          *gzip.Writer
+	encoder     *json.Encoder
+	group       rowGroup
+	wroteHeader bool
+}
+
+func newColumnarWriter(w io.Writer) *columnarWriter {
+	gz := gzip.NewWriter(w)
+	return &columnarWriter{gz: gz, encoder: json.NewEncoder(gz)}
+}
+
+func (w *columnarWriter) Write(record *service.StoredReceipt) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.group.append(record)
+	if w.group.Rows == rowGroupSize {
+		return w.flushGroup()
+	}
+	return nil
+}
+
+func (w *columnarWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if err := w.flushGroup(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+func (w *columnarWriter) writeHeader() error {
+	if w.wroteHeader {
+		return nil
+	}
+	w.wroteHeader = true
+	return w.encoder.Encode(columnarHeader{Format: columnarFormat, Version: columnarVersion, Columns: columnarColumns})
+}
+
+func (w *columnarWriter) flushGroup() error {
+	if w.group.Rows == 0 {
+		return nil
+	}
+	err := w.encoder.Encode(&w.group)
+	w.group = rowGroup{}
+	return err
+}
+
+type columnarReader struct {
+	decoder *json.Decoder
+	group   rowGroup
+	next    int
+}
+
+func newColumnarReader(r io.Reader) (*columnarReader, error) {
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("columnar file is not gzip compressed: %w", err)
+	}
+	decoder := json.NewDecoder(gz)
+	var header columnarHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("columnar header: %w", err)
+	}
+	if header.Format != columnarFormat || header.Version != columnarVersion {
+		return nil, fmt.Errorf("unsupported columnar format %q version %d", header.Format, header.Version)
+	}
+	return &columnarReader{decoder: decoder}, nil
+}
+
+func (r *columnarReader) Read() (*service.StoredReceipt, error) {
+	for r.next == r.group.Rows {
+		r.group = rowGroup{}
+		r.next = 0
+		if err := r.decoder.Decode(&r.group); err != nil {
+			return nil, err
+		}
+		if !r.group.valid() {
+			return nil, fmt.Errorf("row group columns do not all have %d rows", r.group.Rows)
+		}
+	}
+	r.next++
+	return r.group.record(r.next - 1), nil
+}
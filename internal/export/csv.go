@@ -0,0 +1,148 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+)
+
+// csvColumns is the header of an exported CSV file. Items are written as a JSON array, so each
+// receipt stays on one row. Points include the receipt's adjustments, whose net delta is in the
+// adjustment column.
+var csvColumns = []string{"id", "tenant", "retailer", "purchaseDate", "purchaseTime", "total", "points", "itemCount", "items", "submittedAt", "submittedBy", "account", "status", "purchaseTimezone", "adjustment"}
+
+// csvRequired are the columns an imported CSV file must have. The others may be left out.
+var csvRequired = []string{"retailer", "purchaseDate", "purchaseTime", "total", "items"}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) Write(record *service.StoredReceipt) error {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if err := w.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	items, err := json.Marshal(record.Receipt.Items)
+	if err != nil {
+		return err
+	}
+	return w.w.Write([]string{
+		record.ID,
+		record.Tenant,
+		record.Receipt.Retailer,
+		record.Receipt.PurchaseDate,
+		record.Receipt.PurchaseTime,
+		record.Receipt.Total,
+		strconv.Itoa(record.AdjustedPoints()),
+		strconv.Itoa(len(record.Receipt.Items)),
+		string(items),
+		record.SubmittedAt.Format(time.RFC3339Nano),
+		record.SubmittedBy,
+		record.Account,
+		record.Status,
+		record.Receipt.PurchaseTimezone,
+		strconv.Itoa(record.AdjustedPoints() - record.Points),
+	})
+}
+
+func (w *csvWriter) Close() error {
+	// an export with no receipts still gets a header
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if err := w.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// csvReader reads columns by their header name, so they may come in any order.
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv has no header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range csvRequired {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv has no %s column", name)
+		}
+	}
+	return &csvReader{r: reader, columns: columns}, nil
+}
+
+func (r *csvReader) Read() (*service.StoredReceipt, error) {
+	row, err := r.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	get := func(name string) string {
+		if i, ok := r.columns[name]; ok {
+			return row[i]
+		}
+		return ""
+	}
+
+	record := &service.StoredReceipt{
+		ID: get("id"),
+		Receipt: model.Receipt{
+			Retailer:         get("retailer"),
+			PurchaseDate:     get("purchaseDate"),
+			PurchaseTime:     get("purchaseTime"),
+			PurchaseTimezone: get("purchaseTimezone"),
+			Total:            get("total"),
+		},
+		SubmittedBy: get("submittedBy"),
+		Account:     get("account"),
+		Status:      get("status"),
+	}
+	if err := json.Unmarshal([]byte(get("items")), &record.Receipt.Items); err != nil {
+		return nil, fmt.Errorf("items: %w", err)
+	}
+	if points := get("points"); points != "" {
+		if record.Points, err = strconv.Atoi(points); err != nil {
+			return nil, fmt.Errorf("points: %w", err)
+		}
+	}
+	if adjustment := get("adjustment"); adjustment != "" {
+		net, err := strconv.Atoi(adjustment)
+		if err != nil {
+			return nil, fmt.Errorf("adjustment: %w", err)
+		}
+		setAdjustment(record, net)
+	}
+	if submittedAt := get("submittedAt"); submittedAt != "" {
+		if record.SubmittedAt, err = time.Parse(time.RFC3339Nano, submittedAt); err != nil {
+			return nil, fmt.Errorf("submittedAt: %w", err)
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,146 @@
+// Package export writes stored receipts to CSV, NDJSON and a columnar format, and reads them back for import.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+)
+
+// ErrUnknownFormat is returned for a format that is not one of Formats.
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Formats lists the supported formats.
+var Formats = []string{"csv", "ndjson", "columnar"}
+
+// Writer encodes receipts one at a time. Close flushes anything buffered; it does not close the
+// underlying writer.
+type Writer interface {
+	Write(record *service.StoredReceipt) error
+	Close() error
+}
+
+// Reader decodes receipts one at a time, returning io.EOF after the last one.
+type Reader interface {
+	Read() (*service.StoredReceipt, error)
+}
+
+// NewWriter returns a Writer that encodes receipts to w in format.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "csv":
+		return newCSVWriter(w), nil
+	case "ndjson":
+		return newNDJSONWriter(w), nil
+	case "columnar":
+		return newColumnarWriter(w), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// NewReader returns a Reader that decodes receipts in format from r. A header that cannot be read, such as
+// a CSV file without the required columns, is reported as service.ErrInvalidImport.
+func NewReader(format string, r io.Reader) (Reader, error) {
+	var reader Reader
+	var err error
+	switch format {
+	case "csv":
+		reader, err = newCSVReader(r)
+	case "ndjson":
+		reader = &ndjsonReader{decoder: json.NewDecoder(r)}
+	case "columnar":
+		reader, err = newColumnarReader(r)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", service.ErrInvalidImport, err)
+	}
+	return reader, nil
+}
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case "csv":
+		return "text/csv"
+	case "ndjson":
+		return "application/x-ndjson"
+	}
+	return "application/gzip"
+}
+
+// Extension returns the file name extension of format.
+func Extension(format string) string {
+	if format == "columnar" {
+		return ".columnar.gz"
+	}
+	return "." + format
+}
+
+// adjustmentReason is the reason given to the adjustment of an imported receipt whose format only
+// keeps the net delta of its adjustments.
+const adjustmentReason = "imported"
+
+// setAdjustment turns the adjusted points of an imported record into its computed points and a
+// single adjustment of net points.
+func setAdjustment(record *service.StoredReceipt, net int) {
+	if net == 0 {
+		return
+	}
+	record.Points -= net
+	record.Adjustments = []service.Adjustment{{Delta: net, Reason: adjustmentReason}}
+}
+
+// ndjsonRecord is a receipt as written to NDJSON: its points include its adjustments, which are listed
+// in full, and adjustment is their net delta.
+type ndjsonRecord struct {
+	*service.StoredReceipt
+	Points     int `json:"points"`
+	Adjustment int `json:"adjustment"`
+}
+
+// ndjsonWriter writes each receipt as it is stored, one JSON object per line.
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buffered := bufio.NewWriter(w)
+	return &ndjsonWriter{w: buffered, encoder: json.NewEncoder(buffered)}
+}
+
+func (w *ndjsonWriter) Write(record *service.StoredReceipt) error {
+	points := record.AdjustedPoints()
+	return w.encoder.Encode(ndjsonRecord{StoredReceipt: record, Points: points, Adjustment: points - record.Points})
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.w.Flush()
+}
+
+type ndjsonReader struct {
+	decoder *json.Decoder
+}
+
+func (r *ndjsonReader) Read() (*service.StoredReceipt, error) {
+	record := ndjsonRecord{StoredReceipt: &service.StoredReceipt{}}
+	if err := r.decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	record.StoredReceipt.Points = record.Points
+	if len(record.Adjustments) == 0 {
+		setAdjustment(record.StoredReceipt, record.Adjustment)
+		return record.StoredReceipt, nil
+	}
+	// the full history is kept; points are recomputed from it rather than trusting adjustment
+	for _, adjustment := range record.Adjustments {
+		record.StoredReceipt.Points -= adjustment.Delta
+	}
+	return record.StoredReceipt, nil
+}
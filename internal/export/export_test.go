@@ -0,0 +1,189 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func receipt(retailer, date string) *model.Receipt {
+	return &model.Receipt{
+		Retailer:     retailer,
+		PurchaseDate: date,
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}, {ShortDescription: "Pizza, \"large\"", Price: "12.25"}},
+		Total:        "18.74",
+	}
+}
+
+func exportAll(t *testing.T, svc *service.ReceiptService, format string, filter service.ReceiptFilter) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	assert.NoError(t, err)
+	assert.NoError(t, svc.EachReceipt(context.Background(), filter, w.Write))
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, format string, data []byte) []*service.StoredReceipt {
+	t.Helper()
+	r, err := NewReader(format, bytes.NewReader(data))
+	assert.NoError(t, err)
+	var records []*service.StoredReceipt
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records
+		}
+		assert.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	var adjusted string
+	for _, r := range []*model.Receipt{receipt("Target", "2022-01-01"), receipt("Walgreens", "2022-01-31"), receipt("Target", "2022-02-01")} {
+		id, err := svc.ProcessReceipt(context.Background(), r)
+		assert.NoError(t, err)
+		adjusted = id
+	}
+	admin := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "admin", Scopes: []string{auth.ScopeAdmin}})
+	_, _, err := svc.AdjustPoints(admin, adjusted, 5, "goodwill")
+	assert.NoError(t, err)
+	_, _, err = svc.AdjustPoints(admin, adjusted, -2, "correction")
+	assert.NoError(t, err)
+	var stored []*service.StoredReceipt
+	assert.NoError(t, svc.EachReceipt(context.Background(), service.ReceiptFilter{}, func(r *service.StoredReceipt) error {
+		stored = append(stored, r)
+		return nil
+	}))
+	assert.Len(t, stored, 3)
+
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			records := readAll(t, format, exportAll(t, svc, format, service.ReceiptFilter{}))
+			assert.Len(t, records, len(stored))
+			for i := range stored {
+				assert.Equal(t, stored[i].ID, records[i].ID)
+				assert.Equal(t, stored[i].Receipt, records[i].Receipt)
+				assert.Equal(t, stored[i].Points, records[i].Points)
+				assert.Equal(t, stored[i].AdjustedPoints(), records[i].AdjustedPoints())
+				assert.True(t, stored[i].SubmittedAt.Equal(records[i].SubmittedAt))
+				if stored[i].ID == adjusted {
+					assert.Equal(t, stored[i].Points+3, records[i].AdjustedPoints())
+				} else {
+					assert.Empty(t, records[i].Adjustments)
+				}
+			}
+
+			empty := exportAll(t, svc, format, service.ReceiptFilter{Retailer: "nobody"})
+			assert.Empty(t, readAll(t, format, empty))
+		})
+	}
+
+	t.Run("filter", func(t *testing.T) {
+		records := readAll(t, "ndjson", exportAll(t, svc, "ndjson", service.ReceiptFilter{From: "2022-01-01", To: "2022-01-31", Retailer: "target"}))
+		assert.Len(t, records, 1)
+		assert.Equal(t, "2022-01-01", records[0].Receipt.PurchaseDate)
+
+		records = readAll(t, "ndjson", exportAll(t, svc, "ndjson", service.ReceiptFilter{From: "2022-01-31"}))
+		assert.Len(t, records, 2)
+
+		err := svc.EachReceipt(context.Background(), service.ReceiptFilter{From: "January"}, func(*service.StoredReceipt) error { return nil })
+		assert.ErrorIs(t, err, service.ErrInvalidFilter)
+	})
+
+	t.Run("import", func(t *testing.T) {
+		target := service.NewReceiptService(database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db")))
+		defer target.DB.Close()
+		data := exportAll(t, svc, "columnar", service.ReceiptFilter{})
+
+		r, _ := NewReader("columnar", bytes.NewReader(data))
+		result, err := target.ImportReceipts(context.Background(), r.Read, false)
+		assert.NoError(t, err)
+		assert.Equal(t, service.ImportResult{Imported: 3}, result)
+		points, err := service.GetPoints(stored[0].ID, target.DB)
+		assert.NoError(t, err)
+		assert.Equal(t, stored[0].AdjustedPoints(), points)
+
+		// importing again skips every receipt
+		r, _ = NewReader("columnar", bytes.NewReader(data))
+		result, err = target.ImportReceipts(context.Background(), r.Read, false)
+		assert.NoError(t, err)
+		assert.Equal(t, service.ImportResult{Skipped: 3}, result)
+	})
+
+	t.Run("import keeps adjustments", func(t *testing.T) {
+		want, err := svc.PointsHistory(admin, adjusted)
+		assert.NoError(t, err)
+		for _, format := range Formats {
+			target := service.NewReceiptService(database.NewBoltDatabase(filepath.Join(t.TempDir(), format+".db")))
+			r, _ := NewReader(format, bytes.NewReader(exportAll(t, svc, format, service.ReceiptFilter{})))
+			_, err := target.ImportReceipts(admin, r.Read, false)
+			assert.NoError(t, err)
+
+			history, err := target.PointsHistory(admin, adjusted)
+			assert.NoError(t, err, format)
+			assert.Equal(t, want.Points, history.Points, format)
+			assert.Equal(t, want.ComputedPoints, history.ComputedPoints, format)
+			if format == "ndjson" {
+				// only NDJSON keeps each adjustment; the others keep their net delta
+				assert.Equal(t, want.Adjustments, history.Adjustments)
+			} else {
+				assert.Equal(t, []service.Adjustment{{ReceiptID: adjusted, Delta: 3, Reason: "imported", Actor: "admin", CreatedAt: history.Adjustments[0].CreatedAt}}, history.Adjustments, format)
+			}
+			assert.NoError(t, target.DB.Close())
+		}
+	})
+
+	t.Run("import validates and rescores", func(t *testing.T) {
+		target := service.NewReceiptService(database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db")))
+		defer target.DB.Close()
+		csv := "retailer,purchaseDate,purchaseTime,total,items,points\n" +
+			`Target,2022-01-01,13:01,6.49,"[{""shortDescription"":""Mountain Dew 12PK"",""price"":""6.49""}]",1000` + "\n" +
+			`Target,01/01/2022,13:01,6.49,[],5` + "\n"
+
+		r, err := NewReader("csv", strings.NewReader(csv))
+		assert.NoError(t, err)
+		result, err := target.ImportReceipts(context.Background(), r.Read, true)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.Imported)
+		assert.Equal(t, 1, result.Rejected)
+		assert.Equal(t, 2, result.Errors[0].Record)
+		assert.Contains(t, result.Errors[0].Error, "purchaseDate")
+
+		records := readAll(t, "ndjson", exportAll(t, target, "ndjson", service.ReceiptFilter{}))
+		assert.Equal(t, 12, records[0].Points)
+	})
+}
+
+func TestReaderErrors(t *testing.T) {
+	_, err := NewReader("xml", strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+
+	_, err = NewReader("csv", strings.NewReader("retailer,total\n"))
+	assert.ErrorContains(t, err, "no purchaseDate column")
+	assert.ErrorIs(t, err, service.ErrInvalidImport)
+
+	_, err = NewReader("columnar", strings.NewReader(`{"format":"receipts-columnar","version":1}`))
+	assert.ErrorContains(t, err, "not gzip compressed")
+	assert.ErrorIs(t, err, service.ErrInvalidImport)
+
+	r, err := NewReader("csv", strings.NewReader("retailer,purchaseDate,purchaseTime,total,items\nTarget,2022-01-01,13:01,6.49,not json\n"))
+	assert.NoError(t, err)
+	_, err = r.Read()
+	assert.ErrorContains(t, err, "items")
+}
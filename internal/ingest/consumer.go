@@ -0,0 +1,27 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned by Next once a consumer has been closed.
+var ErrClosed = errors.New("consumer closed")
+
+// Message is a single receipt read from a queue.
+type Message struct {
+	// Offset is the position immediately after this message; SeekOffset(Offset) resumes with the next one.
+	Offset int64
+	Data   []byte
+}
+
+// Consumer reads receipts from a queue in order.
+type Consumer interface {
+	// Name identifies the queue; checkpoints are stored under this name.
+	Name() string
+	// SeekOffset positions the consumer so that Next returns the message following offset.
+	SeekOffset(offset int64) error
+	// Next blocks until a message is available, ctx is done or the consumer is closed.
+	Next(ctx context.Context) (Message, error)
+	Close() error
+}
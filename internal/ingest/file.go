@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileConsumer tails a newline delimited JSON file, one receipt per line.
+// Offsets are byte positions in the file, so a restarted consumer resumes after the last committed line.
+type FileConsumer struct {
+	path         string
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial []byte
+	closed  bool
+}
+
+// NewFileConsumer opens the NDJSON file at path for tailing.
+func NewFileConsumer(path string) (*FileConsumer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileConsumer{
+		path:         path,
+		PollInterval: 500 * time.Millisecond,
+		file:         file,
+		reader:       bufio.NewReader(file),
+	}, nil
+}
+
+func (fc *FileConsumer) Name() string {
+	return "file:" + fc.path
+}
+
+func (fc *FileConsumer) SeekOffset(offset int64) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if _, err := fc.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	fc.reader.Reset(fc.file)
+	fc.offset = offset
+	fc.partial = nil
+	return nil
+}
+
+// Next returns the next complete line, waiting for the file to grow when the end is reached.
+// Blank lines are skipped.
+func (fc *FileConsumer) Next(ctx context.Context) (Message, error) {
+	for {
+		msg, err := fc.readLine()
+		if err == nil {
+			if len(bytes.TrimSpace(msg.Data)) == 0 {
+				continue
+			}
+			return msg, nil
+		}
+		if !errors.Is(err, io.EOF) {
+			return Message{}, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-time.After(fc.PollInterval):
+		}
+	}
+}
+
+func (fc *FileConsumer) readLine() (Message, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.closed {
+		return Message{}, ErrClosed
+	}
+
+	line, err := fc.reader.ReadBytes('\n')
+	if err != nil {
+		// keep the incomplete line until the writer finishes it
+		fc.partial = append(fc.partial, line...)
+		return Message{}, err
+	}
+	if len(fc.partial) > 0 {
+		line = append(fc.partial, line...)
+		fc.partial = nil
+	}
+	fc.offset += int64(len(line))
+	return Message{Offset: fc.offset, Data: bytes.TrimRight(line, "\r\n")}, nil
+}
+
+func (fc *FileConsumer) Close() error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.closed = true
+	return fc.file.Close()
+}
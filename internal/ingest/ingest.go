@@ -0,0 +1,205 @@
+// Package ingest feeds receipts published to a queue through the receipt service.
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeadLetter is a message that could never be processed, stored with the reason it was rejected.
+type DeadLetter struct {
+	Consumer string    `json:"consumer"`
+	Offset   int64     `json:"offset"`
+	Data     string    `json:"data"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// Ingester processes messages from consumers with at-least-once semantics: a message's offset is
+// only checkpointed after its receipt has been stored or dead-lettered, so a crash in between
+// causes the message to be processed again on restart.
+type Ingester struct {
+	Service *service.ReceiptService
+	// RetryDelay is the initial wait before retrying a message that failed with a non-validation error.
+	// It doubles on every attempt up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+// NewIngester creates an Ingester that processes receipts with svc.
+func NewIngester(svc *service.ReceiptService) *Ingester {
+	return &Ingester{Service: svc, RetryDelay: 100 * time.Millisecond, MaxRetryDelay: 10 * time.Second}
+}
+
+// Run consumes messages from c, resuming from its last checkpoint, until ctx is done or c is closed.
+func (in *Ingester) Run(ctx context.Context, c Consumer) error {
+	offset, err := in.Checkpoint(c.Name())
+	if err != nil {
+		return err
+	}
+	if err := c.SeekOffset(offset); err != nil {
+		return err
+	}
+
+	// receipts from a queue are attributed to the queue rather than to an api key
+	ingestCtx := auth.WithPrincipal(ctx, &auth.Principal{ID: "ingest:" + c.Name(), Name: c.Name()})
+	for {
+		msg, err := c.Next(ctx)
+		if err != nil {
+			if errors.Is(err, ErrClosed) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := in.handle(ingestCtx, c.Name(), msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handle processes one message, retrying transient failures until it succeeds or ctx is done.
+func (in *Ingester) handle(ctx context.Context, name string, msg Message) error {
+	var receipt model.Receipt
+	if err := json.Unmarshal(msg.Data, &receipt); err != nil {
+		return in.deadLetter(name, msg, err)
+	}
+
+	delay := in.RetryDelay
+	for {
+		id, err := in.Service.ProcessReceipt(ctx, &receipt)
+		if err == nil {
+			log.Printf("ingested receipt %s from %s at offset %d\n", id, name, msg.Offset)
+			return in.commit(name, msg.Offset)
+		}
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) || errors.Is(err, service.ErrReceiptBlocked) {
+			return in.deadLetter(name, msg, err)
+		}
+
+		log.Printf("failed to ingest message from %s at offset %d, retrying in %s: %v\n", name, msg.Offset, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, in.MaxRetryDelay)
+	}
+}
+
+// deadLetter stores msg in the dead letter bucket and checkpoints past it in the same transaction.
+func (in *Ingester) deadLetter(name string, msg Message, reason error) error {
+	log.Printf("dead-lettering message from %s at offset %d: %v\n", name, msg.Offset, reason)
+	data, err := json.Marshal(DeadLetter{
+		Consumer: name,
+		Offset:   msg.Offset,
+		Data:     string(msg.Data),
+		Error:    reason.Error(),
+		Time:     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return in.Service.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("deadletters"))
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(sequenceKey(seq), data); err != nil {
+			return err
+		}
+		return putCheckpoint(tx, name, msg.Offset)
+	})
+}
+
+func (in *Ingester) commit(name string, offset int64) error {
+	return in.Service.DB.Update(func(tx *bolt.Tx) error {
+		return putCheckpoint(tx, name, offset)
+	})
+}
+
+// Checkpoint returns the last committed offset for the named consumer, or 0 if it has none.
+func (in *Ingester) Checkpoint(name string) (int64, error) {
+	var offset int64
+	err := in.Service.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte("offsets")).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		var converr error
+		offset, converr = strconv.ParseInt(string(data), 10, 64)
+		return converr
+	})
+	return offset, err
+}
+
+// DeadLetters returns every dead-lettered message in the order they were rejected.
+func (in *Ingester) DeadLetters() ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := in.Service.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("deadletters")).ForEach(func(_, v []byte) error {
+			var letter DeadLetter
+			if err := json.Unmarshal(v, &letter); err != nil {
+				return err
+			}
+			letters = append(letters, letter)
+			return nil
+		})
+	})
+	return letters, err
+}
+
+func putCheckpoint(tx *bolt.Tx, name string, offset int64) error {
+	return tx.Bucket([]byte("offsets")).Put([]byte(name), []byte(strconv.FormatInt(offset, 10)))
+}
+
+// sequenceKey encodes seq big-endian so keys sort in insertion order.
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// PurgeDeadLetters deletes the dead-lettered messages rejected before cutoff and returns how many there were.
+// Dead letters hold the raw message, so they are subject to the same retention as receipts.
+func PurgeDeadLetters(db *bolt.DB, cutoff time.Time) (int, error) {
+	var purged int
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("deadletters"))
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var letter DeadLetter
+			if err := json.Unmarshal(v, &letter); err != nil {
+				return err
+			}
+			if letter.Time.Before(cutoff) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		purged = len(expired)
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+const validReceipt = `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"}],"total":"6.49"}`
+
+func newTestIngester(t *testing.T) *Ingester {
+	t.Helper()
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	t.Cleanup(func() { db.Close() })
+	return NewIngester(service.NewReceiptService(db))
+}
+
+// runUntil runs the ingester until the consumer's checkpoint reaches offset.
+func runUntil(t *testing.T, in *Ingester, c Consumer, offset int64) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- in.Run(ctx, c) }()
+	assert.Eventually(t, func() bool {
+		checkpoint, _ := in.Checkpoint(c.Name())
+		return checkpoint >= offset
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestIngesterMemoryConsumer(t *testing.T) {
+	in := newTestIngester(t)
+	c := NewMemoryConsumer("test")
+	c.Publish([]byte(validReceipt))
+	c.Publish([]byte(`{"retailer":`))
+	c.Publish([]byte(`{"retailer":"Target","purchaseDate":"2022-01-62","items":[],"total":"1.00"}`))
+	c.Publish([]byte(validReceipt))
+
+	runUntil(t, in, c, 4)
+
+	letters, err := in.DeadLetters()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 2)
+	assert.Equal(t, int64(2), letters[0].Offset)
+	assert.Equal(t, `{"retailer":`, letters[0].Data)
+	assert.Equal(t, int64(3), letters[1].Offset)
+	assert.Equal(t, "field `purchaseDate` is not in the correct format", letters[1].Error)
+
+	t.Run("resumes from checkpoint", func(t *testing.T) {
+		c.Publish([]byte(`not json`))
+		runUntil(t, in, c, 5)
+		// only the new message is dead-lettered, earlier ones are not redelivered
+		letters, err := in.DeadLetters()
+		assert.NoError(t, err)
+		assert.Len(t, letters, 3)
+		assert.Equal(t, int64(5), letters[2].Offset)
+	})
+}
+
+func TestIngesterFileConsumer(t *testing.T) {
+	in := newTestIngester(t)
+	path := filepath.Join(t.TempDir(), "receipts.ndjson")
+	assert.NoError(t, os.WriteFile(path, []byte(validReceipt+"\n\n"), 0600))
+
+	c, err := NewFileConsumer(path)
+	assert.NoError(t, err)
+	defer c.Close()
+	c.PollInterval = 10 * time.Millisecond
+
+	firstLine := int64(len(validReceipt) + 1)
+	runUntil(t, in, c, firstLine)
+
+	// append a line in two writes to check partial lines are held until complete
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	defer f.Close()
+	half := len(validReceipt) / 2
+	_, err = f.WriteString(validReceipt[:half])
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- in.Run(ctx, c) }()
+	time.Sleep(50 * time.Millisecond)
+	_, err = f.WriteString(validReceipt[half:] + "\n")
+	assert.NoError(t, err)
+
+	end := firstLine + 1 + int64(len(validReceipt)+1)
+	assert.Eventually(t, func() bool {
+		checkpoint, _ := in.Checkpoint(c.Name())
+		return checkpoint == end
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+
+	letters, err := in.DeadLetters()
+	assert.NoError(t, err)
+	assert.Empty(t, letters)
+}
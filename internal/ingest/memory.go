@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryConsumer is an in-process queue, mainly for tests.
+type MemoryConsumer struct {
+	name     string
+	mu       sync.Mutex
+	messages [][]byte
+	next     int
+	closed   bool
+	notify   chan struct{}
+}
+
+// NewMemoryConsumer creates an empty in-process queue.
+func NewMemoryConsumer(name string) *MemoryConsumer {
+	return &MemoryConsumer{name: name, notify: make(chan struct{})}
+}
+
+// Publish appends a message to the queue.
+func (mc *MemoryConsumer) Publish(data []byte) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.messages = append(mc.messages, data)
+	close(mc.notify)
+	mc.notify = make(chan struct{})
+}
+
+func (mc *MemoryConsumer) Name() string {
+	return mc.name
+}
+
+func (mc *MemoryConsumer) SeekOffset(offset int64) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.next = int(offset)
+	return nil
+}
+
+func (mc *MemoryConsumer) Next(ctx context.Context) (Message, error) {
+	for {
+		mc.mu.Lock()
+		if mc.closed {
+			mc.mu.Unlock()
+			return Message{}, ErrClosed
+		}
+		if mc.next < len(mc.messages) {
+			data := mc.messages[mc.next]
+			mc.next++
+			msg := Message{Offset: int64(mc.next), Data: data}
+			mc.mu.Unlock()
+			return msg, nil
+		}
+		notify := mc.notify
+		mc.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+func (mc *MemoryConsumer) Close() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if !mc.closed {
+		mc.closed = true
+		close(mc.notify)
+		mc.notify = make(chan struct{})
+	}
+	return nil
+}
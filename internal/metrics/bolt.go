@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltCollector reports bbolt's own statistics and the size of the database file at scrape time.
+type boltCollector struct {
+	db *bolt.DB
+
+	readTxs      *prometheus.Desc
+	openReadTxs  *prometheus.Desc
+	writes       *prometheus.Desc
+	pageAllocs   *prometheus.Desc
+	pageBytes    *prometheus.Desc
+	freePages    *prometheus.Desc
+	pendingPages *prometheus.Desc
+	freeBytes    *prometheus.Desc
+	freelistUsed *prometheus.Desc
+	fileSize     *prometheus.Desc
+}
+
+func newBoltCollector(db *bolt.DB) *boltCollector {
+	return &boltCollector{
+		db:           db,
+		readTxs:      prometheus.NewDesc("bolt_read_tx_total", "Read transactions started.", nil, nil),
+		openReadTxs:  prometheus.NewDesc("bolt_open_read_tx", "Read transactions currently open.", nil, nil),
+		writes:       prometheus.NewDesc("bolt_writes_total", "Page writes performed by committed transactions.", nil, nil),
+		pageAllocs:   prometheus.NewDesc("bolt_page_allocations_total", "Pages allocated by transactions.", nil, nil),
+		pageBytes:    prometheus.NewDesc("bolt_page_allocated_bytes_total", "Bytes allocated for pages by transactions.", nil, nil),
+		freePages:    prometheus.NewDesc("bolt_free_pages", "Pages on the freelist.", nil, nil),
+		pendingPages: prometheus.NewDesc("bolt_pending_pages", "Pages freed by transactions that may still be read.", nil, nil),
+		freeBytes:    prometheus.NewDesc("bolt_free_bytes", "Bytes in free pages.", nil, nil),
+		freelistUsed: prometheus.NewDesc("bolt_freelist_bytes", "Bytes used by the freelist itself.", nil, nil),
+		fileSize:     prometheus.NewDesc("bolt_file_size_bytes", "Size of the database file.", nil, nil),
+	}
+}
+
+func (c *boltCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		c.readTxs, c.openReadTxs, c.writes, c.pageAllocs, c.pageBytes,
+		c.freePages, c.pendingPages, c.freeBytes, c.freelistUsed, c.fileSize,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *boltCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.readTxs, prometheus.CounterValue, float64(stats.TxN))
+	ch <- prometheus.MustNewConstMetric(c.openReadTxs, prometheus.GaugeValue, float64(stats.OpenTxN))
+	ch <- prometheus.MustNewConstMetric(c.writes, prometheus.CounterValue, float64(stats.TxStats.GetWrite()))
+	ch <- prometheus.MustNewConstMetric(c.pageAllocs, prometheus.CounterValue, float64(stats.TxStats.GetPageCount()))
+	ch <- prometheus.MustNewConstMetric(c.pageBytes, prometheus.CounterValue, float64(stats.TxStats.GetPageAlloc()))
+	ch <- prometheus.MustNewConstMetric(c.freePages, prometheus.GaugeValue, float64(stats.FreePageN))
+	ch <- prometheus.MustNewConstMetric(c.pendingPages, prometheus.GaugeValue, float64(stats.PendingPageN))
+	ch <- prometheus.MustNewConstMetric(c.freeBytes, prometheus.GaugeValue, float64(stats.FreeAlloc))
+	ch <- prometheus.MustNewConstMetric(c.freelistUsed, prometheus.GaugeValue, float64(stats.FreelistInuse))
+	if info, err := os.Stat(c.db.Path()); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.fileSize, prometheus.GaugeValue, float64(info.Size()))
+	}
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"github.com/pranathireddyk/receipt-processor/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cacheCollector reports a cache's counters at scrape time.
+type cacheCollector struct {
+	stats func() cache.Stats
+	size  func() int
+
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+	entries   *prometheus.Desc
+}
+
+// RegisterCache reports the hits, misses, evictions and size of a cache, labelled with its name.
+func (m *Metrics) RegisterCache(name string, stats func() cache.Stats, size func() int) {
+	labels := prometheus.Labels{"cache": name}
+	m.Registry.MustRegister(&cacheCollector{
+		stats:     stats,
+		size:      size,
+		hits:      prometheus.NewDesc("cache_hits_total", "Lookups that found a cached value.", nil, labels),
+		misses:    prometheus.NewDesc("cache_misses_total", "Lookups that found no cached value.", nil, labels),
+		evictions: prometheus.NewDesc("cache_evictions_total", "Entries dropped to make room for new ones.", nil, labels),
+		entries:   prometheus.NewDesc("cache_entries", "Entries currently cached.", nil, labels),
+	})
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(c.size()))
+}
@@ -0,0 +1,115 @@
+// Package metrics collects request, scoring and storage metrics and serves them in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Metrics holds the application's collectors in its own registry.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	receiptsProcessed  prometheus.Counter
+	validationFailures *prometheus.CounterVec
+	points             prometheus.Histogram
+	ruleHits           *prometheus.CounterVec
+	rulePoints         *prometheus.CounterVec
+}
+
+// New creates Metrics with the Go runtime, process and bbolt collectors for db registered.
+func New(db *bolt.DB) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method, route and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		receiptsProcessed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "receipts_processed_total",
+			Help: "Receipts scored and stored.",
+		}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "receipt_validation_failures_total",
+			Help: "Receipts rejected by validation, by the field that failed.",
+		}, []string{"field"}),
+		points: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "receipt_points",
+			Help:    "Points awarded per receipt.",
+			Buckets: []float64{0, 10, 25, 50, 75, 100, 150, 200, 300, 500, 1000},
+		}),
+		ruleHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rule_hits_total",
+			Help: "Receipts each scoring rule awarded points to.",
+		}, []string{"rule"}),
+		rulePoints: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rule_points_total",
+			Help: "Points awarded by each scoring rule.",
+		}, []string{"rule"}),
+	}
+	m.Registry.MustRegister(
+		m.requests, m.requestDuration, m.receiptsProcessed, m.validationFailures, m.points, m.ruleHits, m.rulePoints,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		newBoltCollector(db),
+	)
+	// report every rule from the start, so rates are defined before the first hit
+	for _, rule := range service.DefaultRules {
+		m.ruleHits.WithLabelValues(rule.Name)
+		m.rulePoints.WithLabelValues(rule.Name)
+	}
+	return m
+}
+
+// Observe records a receipt event. It is meant to be passed to ReceiptService.Subscribe.
+func (m *Metrics) Observe(event service.Event) {
+	switch event.Type {
+	case service.EventReceiptScored:
+		m.receiptsProcessed.Inc()
+		m.points.Observe(float64(event.Points))
+		for _, hit := range event.Rules {
+			m.ruleHits.WithLabelValues(hit.Rule).Inc()
+			m.rulePoints.WithLabelValues(hit.Rule).Add(float64(hit.Points))
+		}
+	case service.EventReceiptRejected:
+		field := event.Field
+		if field == "" {
+			field = "unknown"
+		}
+		m.validationFailures.WithLabelValues(field).Inc()
+	}
+}
+
+// Middleware records the count and latency of every request. Requests that match no route are
+// grouped under the route "unmatched" to keep the number of series bounded.
+func (m *Metrics) Middleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(c.Writer.Status())
+	m.requests.WithLabelValues(c.Request.Method, route, status).Inc()
+	m.requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	m := New(db)
+	svc := service.NewReceiptService(db)
+	svc.Subscribe(m.Observe)
+
+	t.Run("scoring", func(t *testing.T) {
+		receipt := &model.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-01-01",
+			PurchaseTime: "13:01",
+			Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+			Total:        "6.49",
+		}
+		_, err := svc.ProcessReceipt(context.Background(), receipt)
+		assert.NoError(t, err)
+		receipt.Total = "six"
+		_, err = svc.ProcessReceipt(context.Background(), receipt)
+		assert.Error(t, err)
+
+		body := scrape(t, m)
+		assert.Contains(t, body, "receipts_processed_total 1\n")
+		assert.Contains(t, body, `receipt_validation_failures_total{field="total"} 1`)
+		assert.Contains(t, body, `receipt_points_bucket{le="10"} 0`)
+		assert.Contains(t, body, `receipt_points_bucket{le="25"} 1`)
+		assert.Contains(t, body, "receipt_points_sum 12\n")
+		assert.Contains(t, body, `rule_hits_total{rule="retailer_name"} 1`)
+		assert.Contains(t, body, `rule_points_total{rule="odd_day"} 6`)
+		assert.Contains(t, body, `rule_hits_total{rule="round_total"} 0`)
+	})
+
+	t.Run("requests", func(t *testing.T) {
+		router := gin.New()
+		router.Use(m.Middleware)
+		router.GET("/receipts/:id/points", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+		for _, path := range []string{"/receipts/1/points", "/receipts/2/points", "/missing"} {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+
+		body := scrape(t, m)
+		assert.Contains(t, body, `http_requests_total{method="GET",route="/receipts/:id/points",status="404"} 2`)
+		assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+		assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/receipts/:id/points",status="404"} 2`)
+	})
+
+	t.Run("points cache", func(t *testing.T) {
+		svc.PointsCache.Purge()
+		m.RegisterCache("points", svc.PointsCache.Stats, svc.PointsCache.Len)
+		id, err := svc.ProcessReceipt(context.Background(), &model.Receipt{Retailer: "Target", Total: "1.00"})
+		assert.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			_, err = svc.GetPoints(context.Background(), id)
+			assert.NoError(t, err)
+		}
+		_, err = svc.GetPoints(context.Background(), "7fb1377b-b223-49d9-a31a-5a02701dd310")
+		assert.ErrorIs(t, err, service.ErrIdNotFound)
+
+		body := scrape(t, m)
+		assert.Contains(t, body, `cache_hits_total{cache="points"} 3`)
+		assert.Contains(t, body, `cache_misses_total{cache="points"} 1`)
+		assert.Contains(t, body, `cache_entries{cache="points"} 1`)
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		body := scrape(t, m)
+		for _, name := range []string{"bolt_read_tx_total", "bolt_writes_total", "bolt_free_pages", "bolt_file_size_bytes", "go_goroutines"} {
+			assert.Contains(t, body, "\n"+name+" ")
+		}
+	})
+}
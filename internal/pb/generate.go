@@ -0,0 +1,4 @@
+// Package pb contains the protobuf and gRPC definitions for the receipt processor.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative receipt.proto
@@ -0,0 +1,224 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: receipt.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ReceiptProcessor_ProcessReceipt_FullMethodName = "/receipt.v1.ReceiptProcessor/ProcessReceipt"
+	ReceiptProcessor_GetPoints_FullMethodName      = "/receipt.v1.ReceiptProcessor/GetPoints"
+	ReceiptProcessor_SubmitBatch_FullMethodName    = "/receipt.v1.ReceiptProcessor/SubmitBatch"
+)
+
+// ReceiptProcessorClient is the client API for ReceiptProcessor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ReceiptProcessorClient interface {
+	// ProcessReceipt scores and stores a receipt, returning its id.
+	ProcessReceipt(ctx context.Context, in *ProcessReceiptRequest, opts ...grpc.CallOption) (*ProcessReceiptResponse, error)
+	// GetPoints returns the points awarded to a previously processed receipt.
+	GetPoints(ctx context.Context, in *GetPointsRequest, opts ...grpc.CallOption) (*GetPointsResponse, error)
+	// SubmitBatch processes every receipt sent on the stream and replies with one
+	// result per receipt, in the order they were received.
+	SubmitBatch(ctx context.Context, opts ...grpc.CallOption) (ReceiptProcessor_SubmitBatchClient, error)
+}
+
+type receiptProcessorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReceiptProcessorClient(cc grpc.ClientConnInterface) ReceiptProcessorClient {
+	return &receiptProcessorClient{cc}
+}
+
+func (c *receiptProcessorClient) ProcessReceipt(ctx context.Context, in *ProcessReceiptRequest, opts ...grpc.CallOption) (*ProcessReceiptResponse, error) {
+	out := new(ProcessReceiptResponse)
+	err := c.cc.Invoke(ctx, ReceiptProcessor_ProcessReceipt_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *receiptProcessorClient) GetPoints(ctx context.Context, in *GetPointsRequest, opts ...grpc.CallOption) (*GetPointsResponse, error) {
+	out := new(GetPointsResponse)
+	err := c.cc.Invoke(ctx, ReceiptProcessor_GetPoints_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *receiptProcessorClient) SubmitBatch(ctx context.Context, opts ...grpc.CallOption) (ReceiptProcessor_SubmitBatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ReceiptProcessor_ServiceDesc.Streams[0], ReceiptProcessor_SubmitBatch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &receiptProcessorSubmitBatchClient{stream}
+	return x, nil
+}
+
+type ReceiptProcessor_SubmitBatchClient interface {
+	Send(*ProcessReceiptRequest) error
+	Recv() (*BatchResult, error)
+	grpc.ClientStream
+}
+
+type receiptProcessorSubmitBatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *receiptProcessorSubmitBatchClient) Send(m *ProcessReceiptRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *receiptProcessorSubmitBatchClient) Recv() (*BatchResult, error) {
+	m := new(BatchResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ReceiptProcessorServer is the server API for ReceiptProcessor service.
+// All implementations must embed UnimplementedReceiptProcessorServer
+// for forward compatibility
+type ReceiptProcessorServer interface {
+	// ProcessReceipt scores and stores a receipt, returning its id.
+	ProcessReceipt(context.Context, *ProcessReceiptRequest) (*ProcessReceiptResponse, error)
+	// GetPoints returns the points awarded to a previously processed receipt.
+	GetPoints(context.Context, *GetPointsRequest) (*GetPointsResponse, error)
+	// SubmitBatch processes every receipt sent on the stream and replies with one
+	// result per receipt, in the order they were received.
+	SubmitBatch(ReceiptProcessor_SubmitBatchServer) error
+	mustEmbedUnimplementedReceiptProcessorServer()
+}
+
+// UnimplementedReceiptProcessorServer must be embedded to have forward compatible implementations.
+type UnimplementedReceiptProcessorServer struct {
+}
+
+func (UnimplementedReceiptProcessorServer) ProcessReceipt(context.Context, *ProcessReceiptRequest) (*ProcessReceiptResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ProcessReceipt not implemented")
+}
+func (UnimplementedReceiptProcessorServer) GetPoints(context.Context, *GetPointsRequest) (*GetPointsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPoints not implemented")
+}
+func (UnimplementedReceiptProcessorServer) SubmitBatch(ReceiptProcessor_SubmitBatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubmitBatch not implemented")
+}
+func (UnimplementedReceiptProcessorServer) mustEmbedUnimplementedReceiptProcessorServer() {}
+
+// UnsafeReceiptProcessorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReceiptProcessorServer will
+// result in compilation errors.
+type UnsafeReceiptProcessorServer interface {
+	mustEmbedUnimplementedReceiptProcessorServer()
+}
+
+func RegisterReceiptProcessorServer(s grpc.ServiceRegistrar, srv ReceiptProcessorServer) {
+	s.RegisterService(&ReceiptProcessor_ServiceDesc, srv)
+}
+
+func _ReceiptProcessor_ProcessReceipt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProcessReceiptRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReceiptProcessorServer).ProcessReceipt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReceiptProcessor_ProcessReceipt_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReceiptProcessorServer).ProcessReceipt(ctx, req.(*ProcessReceiptRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReceiptProcessor_GetPoints_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPointsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReceiptProcessorServer).GetPoints(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReceiptProcessor_GetPoints_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReceiptProcessorServer).GetPoints(ctx, req.(*GetPointsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReceiptProcessor_SubmitBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ReceiptProcessorServer).SubmitBatch(&receiptProcessorSubmitBatchServer{stream})
+}
+
+type ReceiptProcessor_SubmitBatchServer interface {
+	Send(*BatchResult) error
+	Recv() (*ProcessReceiptRequest, error)
+	grpc.ServerStream
+}
+
+type receiptProcessorSubmitBatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *receiptProcessorSubmitBatchServer) Send(m *BatchResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *receiptProcessorSubmitBatchServer) Recv() (*ProcessReceiptRequest, error) {
+	m := new(ProcessReceiptRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ReceiptProcessor_ServiceDesc is the grpc.ServiceDesc for ReceiptProcessor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ReceiptProcessor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "receipt.v1.ReceiptProcessor",
+	HandlerType: (*ReceiptProcessorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ProcessReceipt",
+			Handler:    _ReceiptProcessor_ProcessReceipt_Handler,
+		},
+		{
+			MethodName: "GetPoints",
+			Handler:    _ReceiptProcessor_GetPoints_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubmitBatch",
+			Handler:       _ReceiptProcessor_SubmitBatch_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "receipt.proto",
+}
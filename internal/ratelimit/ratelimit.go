@@ -0,0 +1,146 @@
+// Package ratelimit implements per-client token bucket rate limiting.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Rate requests per second on average, with bursts of up to Burst requests.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses a limit written as "rate" or "rate:burst", where rate is requests per second.
+// Without a burst, the burst is the rate rounded up.
+func ParseLimit(s string) (Limit, error) {
+	rate, burst, hasBurst := strings.Cut(s, ":")
+	var l Limit
+	var err error
+	if l.Rate, err = strconv.ParseFloat(rate, 64); err != nil || l.Rate <= 0 {
+		return l, fmt.Errorf("invalid rate %q", rate)
+	}
+	l.Burst = int(math.Ceil(l.Rate))
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst < 1 {
+			return l, fmt.Errorf("invalid burst %q", burst)
+		}
+	}
+	return l, nil
+}
+
+// Result is the outcome of a call to Allow.
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size and Remaining the whole tokens left in it.
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed, if this one was not.
+	RetryAfter time.Duration
+}
+
+// DefaultMaxKeys is the default number of clients a Limiter keeps a bucket for.
+const DefaultMaxKeys = 100000
+
+// Limiter keeps one token bucket per client key. Buckets that have refilled completely are
+// forgotten, so idle clients cost no memory.
+type Limiter struct {
+	Limit Limit
+	// MaxKeys caps the number of buckets kept. When a new client arrives at the cap, full buckets are dropped
+	// and, if none are, the least recently used bucket is, so a flood of clients cannot exhaust memory.
+	// Zero means no cap.
+	MaxKeys int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewLimiter creates a Limiter enforcing limit.
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{Limit: limit, MaxKeys: DefaultMaxKeys, buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Allow takes a token from key's bucket if one is available.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	burst := float64(l.Limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		if l.MaxKeys > 0 && len(l.buckets) >= l.MaxKeys {
+			l.evict(now)
+		}
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*l.Limit.Rate)
+	b.updated = now
+
+	result := Result{Limit: l.Limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = l.duration(burst - b.tokens)
+	return result
+}
+
+// sweep drops buckets that would be full by now, at most once a minute.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	l.dropFull(now)
+}
+
+// evict makes room for a new bucket by dropping the full ones, or else the least recently used one.
+func (l *Limiter) evict(now time.Time) {
+	if l.dropFull(now) > 0 {
+		return
+	}
+	var oldest string
+	for key, b := range l.buckets {
+		if oldest == "" || b.updated.Before(l.buckets[oldest].updated) {
+			oldest = key
+		}
+	}
+	delete(l.buckets, oldest)
+}
+
+// dropFull drops buckets that would be full by now and returns how many it dropped.
+func (l *Limiter) dropFull(now time.Time) int {
+	dropped := 0
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.Limit.Rate >= float64(l.Limit.Burst) {
+			delete(l.buckets, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// duration returns how long it takes to refill tokens.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.Limit.Rate * float64(time.Second))
+}
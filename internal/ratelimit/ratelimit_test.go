@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(Limit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	t.Run("burst then refill", func(t *testing.T) {
+		for i := 2; i >= 0; i-- {
+			result := l.Allow("a")
+			assert.True(t, result.Allowed)
+			assert.Equal(t, 3, result.Limit)
+			assert.Equal(t, i, result.Remaining)
+		}
+		result := l.Allow("a")
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+		assert.Equal(t, 1500*time.Millisecond, result.Reset)
+
+		// other clients have their own bucket
+		assert.True(t, l.Allow("b").Allowed)
+
+		now = now.Add(500 * time.Millisecond)
+		assert.True(t, l.Allow("a").Allowed)
+		assert.False(t, l.Allow("a").Allowed)
+	})
+
+	t.Run("idle buckets are swept", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		l.Allow("c")
+		assert.Len(t, l.buckets, 1)
+	})
+
+	t.Run("the number of buckets is capped", func(t *testing.T) {
+		l.MaxKeys = 2
+		defer func() { l.MaxKeys = DefaultMaxKeys }()
+		now = now.Add(time.Second)
+		assert.True(t, l.Allow("d").Allowed)
+		assert.True(t, l.Allow("d").Allowed)
+		assert.Len(t, l.buckets, 2)
+
+		// the full bucket of c makes room for e
+		assert.True(t, l.Allow("e").Allowed)
+		assert.Len(t, l.buckets, 2)
+		assert.NotContains(t, l.buckets, "c")
+
+		// with no full bucket left, the least recently used one goes
+		now = now.Add(time.Millisecond)
+		l.Allow("e")
+		l.Allow("f")
+		assert.Len(t, l.buckets, 2)
+		assert.NotContains(t, l.buckets, "d")
+		assert.Contains(t, l.buckets, "e")
+	})
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("10:20")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 10, Burst: 20}, limit)
+	limit, err = ParseLimit("0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 0.5, Burst: 1}, limit)
+
+	for _, spec := range []string{"", "fast", "-1", "10:0", "10:x"} {
+		_, err := ParseLimit(spec)
+		assert.Error(t, err, spec)
+	}
+}
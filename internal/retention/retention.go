@@ -0,0 +1,109 @@
+// Package retention runs the janitor that removes receipts, dead letters and failed webhook deliveries once their
+// retention period has passed.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/ingest"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/pranathireddyk/receipt-processor/internal/webhook"
+)
+
+// Janitor applies retention every Interval: each tenant's receipts follow the tenant's own Retention, or
+// Default if it has none, dead letters are deleted after DeadLetterDays and failed webhook deliveries after
+// WebhookFailureDays. A zero number of days keeps data forever.
+type Janitor struct {
+	Service            *service.ReceiptService
+	Default            service.Retention
+	DeadLetterDays     int
+	WebhookFailureDays int
+	Interval           time.Duration
+
+	now func() time.Time
+}
+
+// NewJanitor creates a Janitor for svc that runs hourly and keeps everything until configured otherwise.
+func NewJanitor(svc *service.ReceiptService) *Janitor {
+	return &Janitor{Service: svc, Interval: time.Hour, now: time.Now}
+}
+
+// Run applies retention once right away and then every Interval until ctx is done. Failures are logged
+// and retried at the next interval.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+	for {
+		if err := j.RunOnce(); err != nil {
+			log.Printf("retention failed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce applies retention to every tenant, to the dead letters and to the failed webhook deliveries.
+func (j *Janitor) RunOnce() error {
+	tenants, err := j.Service.Tenants()
+	if err != nil {
+		return err
+	}
+	policies := map[string]service.Retention{service.DefaultTenant: j.Default}
+	for _, tenant := range tenants {
+		policies[tenant.ID] = j.Default
+		if tenant.Retention != nil {
+			policies[tenant.ID] = *tenant.Retention
+		}
+	}
+
+	now := j.now()
+	for tenant, retention := range policies {
+		if retention.Days == 0 {
+			continue
+		}
+		n, err := j.Service.PurgeReceipts(tenant, cutoff(now, retention.Days), retention)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		if n > 0 {
+			log.Printf("retention: %s %d receipts of tenant %s\n", actionLog(retention.Action), n, tenant)
+		}
+	}
+	if j.DeadLetterDays > 0 {
+		n, err := ingest.PurgeDeadLetters(j.Service.DB, cutoff(now, j.DeadLetterDays))
+		if err != nil {
+			return fmt.Errorf("dead letters: %w", err)
+		}
+		if n > 0 {
+			log.Printf("retention: deleted %d dead letters\n", n)
+		}
+	}
+	if j.WebhookFailureDays > 0 {
+		n, err := webhook.PurgeFailures(j.Service.DB, cutoff(now, j.WebhookFailureDays))
+		if err != nil {
+			return fmt.Errorf("webhook failures: %w", err)
+		}
+		if n > 0 {
+			log.Printf("retention: deleted %d failed webhook deliveries\n", n)
+		}
+	}
+	return nil
+}
+
+// cutoff returns the time before which data older than days has expired.
+func cutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+func actionLog(action string) string {
+	if action == service.RetentionAnonymize {
+		return "anonymized"
+	}
+	return "deleted"
+}
@@ -0,0 +1,114 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/ingest"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/pranathireddyk/receipt-processor/internal/webhook"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestJanitor(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	_, err := svc.CreateTenant(service.Tenant{ID: "acme", Name: "Acme", Retention: &service.Retention{Days: 30, Action: service.RetentionAnonymize}})
+	assert.NoError(t, err)
+	_, err = svc.CreateTenant(service.Tenant{ID: "forever", Name: "Forever", Retention: &service.Retention{}})
+	assert.NoError(t, err)
+
+	receipt := &model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+		Items: []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, Total: "6.49"}
+	process := func(tenant string) string {
+		ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "pos", Account: "alice", Tenant: tenant})
+		id, err := svc.ProcessReceipt(ctx, receipt)
+		assert.NoError(t, err)
+		return id
+	}
+	defaultID, acmeID, foreverID := process(""), process("acme"), process("forever")
+	admin := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "admin", Scopes: []string{auth.ScopeAdmin}})
+	_, _, err = svc.AdjustPoints(admin, defaultID, 3, "goodwill")
+	assert.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		data, _ := json.Marshal(ingest.DeadLetter{Consumer: "file", Data: "{}", Time: time.Now().UTC()})
+		if err := tx.Bucket([]byte("deadletters")).Put([]byte{0, 0, 0, 0, 0, 0, 0, 1}, data); err != nil {
+			return err
+		}
+		data, _ = json.Marshal(webhook.Delivery{ID: "failed", Payload: []byte("{}"), FailedAt: time.Now().UTC()})
+		return tx.Bucket([]byte("webhookfailures")).Put([]byte("failed"), data)
+	})
+	assert.NoError(t, err)
+	failures := func() int {
+		var n int
+		assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket([]byte("webhookfailures")).Stats().KeyN
+			return nil
+		}))
+		return n
+	}
+
+	j := NewJanitor(svc)
+	j.Default = service.Retention{Days: 90}
+	j.DeadLetterDays = 7
+	j.WebhookFailureDays = 30
+	j.now = func() time.Time { return time.Now().AddDate(0, 0, 5) }
+
+	t.Run("nothing has expired yet", func(t *testing.T) {
+		assert.NoError(t, j.RunOnce())
+		letters, err := ingest.NewIngester(svc).DeadLetters()
+		assert.NoError(t, err)
+		assert.Len(t, letters, 1)
+		assert.Equal(t, 1, failures())
+		_, err = svc.GetReceipt(context.Background(), defaultID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("expired data is purged", func(t *testing.T) {
+		j.now = func() time.Time { return time.Now().AddDate(0, 0, 100) }
+		assert.NoError(t, j.RunOnce())
+
+		letters, err := ingest.NewIngester(svc).DeadLetters()
+		assert.NoError(t, err)
+		assert.Empty(t, letters)
+		assert.Equal(t, 0, failures())
+
+		// the default tenant deletes receipts but keeps their points and adjustments
+		_, err = svc.GetReceipt(context.Background(), defaultID)
+		assert.ErrorIs(t, err, service.ErrIdNotFound)
+		points, err := service.GetPoints(defaultID, db)
+		assert.NoError(t, err)
+		assert.Equal(t, 15, points)
+
+		acme := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "admin", Tenant: "acme"})
+		record, err := svc.GetReceipt(acme, acmeID)
+		assert.NoError(t, err)
+		assert.True(t, record.Anonymized)
+		assert.Empty(t, record.Account)
+		assert.Empty(t, record.Receipt.PurchaseTime)
+		assert.Empty(t, record.Receipt.Items[0].ShortDescription)
+		assert.Equal(t, "6.49", record.Receipt.Items[0].Price)
+		assert.Equal(t, 12, record.Points)
+
+		// balances are kept whether the receipts were deleted or anonymized
+		balance, err := svc.Balance(context.Background(), "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, service.Balance{Account: "alice", Points: 15}, balance)
+		balance, err = svc.Balance(acme, "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, service.Balance{Account: "alice", Points: 12}, balance)
+
+		forever := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "admin", Tenant: "forever"})
+		record, err = svc.GetReceipt(forever, foreverID)
+		assert.NoError(t, err)
+		assert.False(t, record.Anonymized)
+	})
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+)
+
+type adjustmentRequest struct {
+	Delta  int    `json:"delta" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+func (rs *ReceiptServer) adjustPoints(c *gin.Context) {
+	var req adjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(err, c)
+		return
+	}
+
+	adjustment, points, err := rs.Service.AdjustPoints(c.Request.Context(), c.Params.ByName("id"), req.Delta, req.Reason)
+	if err != nil {
+		handleAdjustmentError(err, c)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"adjustment": adjustment, "points": points})
+}
+
+// getPointsHistory responds with the receipt's points, the points it was scored with and its adjustments.
+func (rs *ReceiptServer) getPointsHistory(c *gin.Context) {
+	history, err := rs.Service.PointsHistory(c.Request.Context(), c.Params.ByName("id"))
+	if err != nil {
+		handleGetPointsError(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func handleAdjustmentError(err error, c *gin.Context) {
+	if errors.Is(err, service.ErrInvalidAdjustment) {
+		handleError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	handleGetPointsError(err, c)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdjustPoints(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	adminKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+	posKey := createTestKey(t, server.Keys, auth.ScopeSubmit, auth.ScopeRead)
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", key)
+		server.ServeHTTP(w, req)
+		return w
+	}
+	points := func(id string) int {
+		w := do("GET", "/receipts/"+id+"/points", posKey, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]int
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["points"]
+	}
+	var adjusted []service.Event
+	server.Service.Subscribe(func(event service.Event) {
+		if event.Type == service.EventPointsAdjusted {
+			adjusted = append(adjusted, event)
+		}
+	})
+
+	id := decodeResponse(do("POST", "/receipts/process", posKey, simpleReceiptJSON), t).ID
+	computed := points(id)
+
+	t.Run("requires the admin scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do("POST", "/receipts/"+id+"/adjustments", posKey, `{"delta": 10, "reason": "goodwill"}`).Code)
+	})
+
+	t.Run("rejects invalid adjustments", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/receipts/"+id+"/adjustments", adminKey, `{"delta": 10}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/receipts/"+id+"/adjustments", adminKey, `{"delta": 0, "reason": "nothing"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/receipts/"+id+"/adjustments", adminKey, `{"delta": -100000, "reason": "too much"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/receipts/not-a-uuid/adjustments", adminKey, `{"delta": 10, "reason": "goodwill"}`).Code)
+		assert.Equal(t, http.StatusNotFound, do("POST", "/receipts/7fb1377b-b223-49d9-a31a-5a02701dd310/adjustments", adminKey, `{"delta": 10, "reason": "goodwill"}`).Code)
+		assert.Equal(t, computed, points(id))
+		assert.Empty(t, adjusted)
+	})
+
+	t.Run("adds to the computed points", func(t *testing.T) {
+		w := do("POST", "/receipts/"+id+"/adjustments", adminKey, `{"delta": 25, "reason": "goodwill"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, http.StatusCreated, do("POST", "/receipts/"+id+"/adjustments", adminKey, `{"delta": -5, "reason": "scoring mistake"}`).Code)
+		assert.Equal(t, computed+20, points(id))
+		assert.Len(t, adjusted, 2)
+		assert.Equal(t, computed+20, adjusted[1].Points)
+
+		w = do("GET", "/receipts/"+id+"/points?history=true", posKey, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var history service.PointsHistory
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+		assert.Equal(t, computed+20, history.Points)
+		assert.Equal(t, computed, history.ComputedPoints)
+		assert.Len(t, history.Adjustments, 2)
+		assert.Equal(t, 25, history.Adjustments[0].Delta)
+		assert.Equal(t, "scoring mistake", history.Adjustments[1].Reason)
+		assert.NotEmpty(t, history.Adjustments[0].Actor)
+	})
+
+	t.Run("are erased with the receipt", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, do("DELETE", "/receipts/"+id, adminKey, "").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/receipts/"+id+"/points?history=true", posKey, "").Code)
+	})
+}
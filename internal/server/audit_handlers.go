@@ -0,0 +1,101 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+)
+
+// maxRequestIDLength bounds the client supplied request ids kept in the audit log.
+const maxRequestIDLength = 128
+
+// Page sizes of GET /audit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// requestID gives every request an id, taken from the X-Request-ID header when the client sent a usable one,
+// and echoes it in the response so a client can find its changes in the audit log.
+func (rs *ReceiptServer) requestID(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if !validRequestID(id) {
+		id = uuid.New().String()
+	}
+	c.Header("X-Request-ID", id)
+	c.Request = c.Request.WithContext(audit.WithRequestID(c.Request.Context(), id))
+	c.Next()
+}
+
+// validRequestID reports whether id is short and printable ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// audit records a configuration change in the audit log, attributed to the request's principal. before and
+// after are the changed object as the API shows it, or nil when it did not exist. Configuration stores commit
+// their own transactions, so the entry follows the change in a separate one; a failure is logged, since the
+// change has already been made.
+func (rs *ReceiptServer) audit(c *gin.Context, action, tenant, target string, before, after any) {
+	ctx := c.Request.Context()
+	entry := audit.Entry{
+		RequestID: audit.RequestIDFrom(ctx),
+		Action:    action,
+		Tenant:    tenant,
+		Target:    target,
+		Before:    audit.HashJSON(before),
+		After:     audit.HashJSON(after),
+	}
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		entry.Actor, entry.Subject = p.ID, p.Account
+	}
+	if err := audit.Record(rs.Service.DB, entry); err != nil {
+		log.Printf("failed to record %s of %s in the audit log: %v\n", action, target, err)
+	}
+}
+
+// listAudit responds with the audit log entries after the sequence number in the after query parameter, oldest
+// first, up to limit of them.
+func (rs *ReceiptServer) listAudit(c *gin.Context) {
+	after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "after must be a sequence number")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditLimit)))
+	if err != nil || limit < 1 || limit > maxAuditLimit {
+		handleError(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+		return
+	}
+	entries, err := audit.Entries(rs.Service.DB, after, limit)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to read the audit log")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// verifyAudit walks the audit log chain and responds with the report. A broken chain is reported in its breaks.
+func (rs *ReceiptServer) verifyAudit(c *gin.Context) {
+	report, err := audit.Verify(rs.Service.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to verify the audit log")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
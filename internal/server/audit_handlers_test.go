@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	adminKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+	posKey := createTestKey(t, server.Keys, auth.ScopeSubmit, auth.ScopeRead)
+	do := func(method, path, key, requestID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", key)
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+	entries := func() []audit.Entry {
+		w := do("GET", "/audit", adminKey, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string][]audit.Entry
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["entries"]
+	}
+
+	t.Run("request ids", func(t *testing.T) {
+		w := do("GET", "/healthz", "", "", "")
+		assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+		assert.Equal(t, "client-id-1", do("GET", "/healthz", "", "client-id-1", "").Header().Get("X-Request-ID"))
+		assert.NotEqual(t, "has spaces", do("GET", "/healthz", "", "has spaces", "").Header().Get("X-Request-ID"))
+	})
+
+	t.Run("records mutating requests", func(t *testing.T) {
+		w := do("POST", "/receipts/process", posKey, "submit-1", simpleReceiptJSON)
+		id := decodeResponse(w, t).ID
+		assert.Equal(t, http.StatusCreated, do("POST", "/receipts/"+id+"/adjustments", adminKey, "adjust-1", `{"delta": 5, "reason": "goodwill"}`).Code)
+		assert.Equal(t, http.StatusCreated, do("POST", "/tenants", adminKey, "tenant-1", `{"id": "acme", "name": "Acme"}`).Code)
+		assert.Equal(t, http.StatusNoContent, do("DELETE", "/receipts/"+id, adminKey, "delete-1", "").Code)
+		do("GET", "/receipts/"+id+"/points", posKey, "", "")
+
+		got := entries()
+		assert.Len(t, got, 4)
+		assert.Equal(t, audit.ActionReceiptSubmitted, got[0].Action)
+		assert.Equal(t, "submit-1", got[0].RequestID)
+		assert.Equal(t, id, got[0].Target)
+		assert.NotEmpty(t, got[0].Actor)
+		assert.NotEmpty(t, got[0].After)
+		assert.Empty(t, got[0].Before)
+		assert.Equal(t, audit.ActionPointsAdjusted, got[1].Action)
+		assert.NotEqual(t, got[1].Before, got[1].After)
+		assert.Equal(t, audit.ActionTenantCreated, got[2].Action)
+		assert.Equal(t, "acme", got[2].Target)
+		assert.Equal(t, audit.ActionReceiptDeleted, got[3].Action)
+		assert.Equal(t, got[0].After, got[3].Before)
+		assert.Empty(t, got[3].After)
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do("GET", "/audit/verify", posKey, "", "").Code)
+		w := do("GET", "/audit/verify", adminKey, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report audit.Report
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, 4, report.Entries)
+		assert.Empty(t, report.Breaks)
+	})
+
+	t.Run("rejects invalid pages", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do("GET", "/audit?after=x", adminKey, "", "").Code)
+		assert.Equal(t, http.StatusBadRequest, do("GET", "/audit?limit=0", adminKey, "", "").Code)
+	})
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+)
+
+// requireScope authenticates the request's api key or JWT and rejects it unless the principal has scope.
+// The credential is read from the X-API-Key header or an Authorization: Bearer header. Operator credentials
+// select the tenant to act in with the X-Tenant-ID header; other credentials may only name their own tenant.
+func (rs *ReceiptServer) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := rs.authenticate(c, scope)
+		if principal == nil {
+			return
+		}
+		principal, err := principal.ForTenant(c.GetHeader("X-Tenant-ID"))
+		if err != nil {
+			handleError(c, http.StatusForbidden, err.Error())
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+// requireOperator rejects the request unless it is made with an admin credential that is bound to no tenant.
+func (rs *ReceiptServer) requireOperator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := rs.authenticate(c, auth.ScopeAdmin)
+		if principal == nil {
+			return
+		}
+		if principal.Tenant != "" {
+			handleError(c, http.StatusForbidden, auth.ErrForbidden.Error())
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+// authenticate returns the request's principal if it has scope. Otherwise it writes the error response,
+// aborts the request and returns nil.
+func (rs *ReceiptServer) authenticate(c *gin.Context, scope string) *auth.Principal {
+	principal, err := rs.verifyCredential(c)
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			log.Println(err)
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="receipt-processor"`)
+		handleError(c, http.StatusUnauthorized, auth.ErrUnauthenticated.Error())
+		c.Abort()
+		return nil
+	}
+	if !principal.HasScope(scope) {
+		handleError(c, http.StatusForbidden, auth.ErrForbidden.Error())
+		c.Abort()
+		return nil
+	}
+	return principal
+}
+
+// verifiedCredentialKey holds the verifiedCredential of a request in its gin context.
+const verifiedCredentialKey = "verifiedCredential"
+
+// verifiedCredential is the outcome of checking a request's credential.
+type verifiedCredential struct {
+	principal *auth.Principal
+	err       error
+}
+
+// verifyCredential returns the principal of the request's credential. The credential is checked once per
+// request, so the rate limiter and the route's authentication share the result.
+func (rs *ReceiptServer) verifyCredential(c *gin.Context) (*auth.Principal, error) {
+	if v, ok := c.Get(verifiedCredentialKey); ok {
+		verified := v.(verifiedCredential)
+		return verified.principal, verified.err
+	}
+	authenticator := &auth.Multi{Keys: rs.Keys, JWT: rs.JWT}
+	principal, err := authenticator.Authenticate(requestToken(c.Request))
+	c.Set(verifiedCredentialKey, verifiedCredential{principal: principal, err: err})
+	return principal, err
+}
+
+// requestToken returns the credential sent with the request, or "" if there is none.
+func requestToken(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type apiKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Tenant binds the key to a tenant. Keys created by tenant admins are always bound to their tenant.
+	Tenant string   `json:"tenant"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+func (rs *ReceiptServer) createAPIKey(c *gin.Context) {
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(err, c)
+		return
+	}
+	if principal := auth.PrincipalFrom(c.Request.Context()); principal.Tenant != "" {
+		if req.Tenant != "" && req.Tenant != principal.Tenant {
+			handleError(c, http.StatusForbidden, auth.ErrWrongTenant.Error())
+			return
+		}
+		req.Tenant = principal.Tenant
+	}
+	if req.Tenant != "" {
+		if _, err := rs.Service.Tenant(req.Tenant); err != nil {
+			handleTenantError(err, c)
+			return
+		}
+	}
+
+	key, token, err := rs.Keys.Create(req.Name, req.Tenant, req.Scopes)
+	if err != nil {
+		handleAPIKeyError(err, c)
+		return
+	}
+	rs.audit(c, audit.ActionKeyCreated, key.Tenant, key.ID, nil, key)
+	// the key itself is only ever returned here
+	c.JSON(http.StatusCreated, gin.H{"id": key.ID, "name": key.Name, "tenant": key.Tenant, "scopes": key.Scopes, "createdAt": key.CreatedAt, "key": token})
+}
+
+func (rs *ReceiptServer) listAPIKeys(c *gin.Context) {
+	keys, err := rs.tenantAPIKeys(c)
+	if err != nil {
+		handleAPIKeyError(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (rs *ReceiptServer) revokeAPIKey(c *gin.Context) {
+	keys, err := rs.tenantAPIKeys(c)
+	if err != nil {
+		handleAPIKeyError(err, c)
+		return
+	}
+	id := c.Params.ByName("id")
+	// keys of other tenants are reported as not found
+	i := slices.IndexFunc(keys, func(key auth.APIKey) bool { return key.ID == id })
+	if i < 0 {
+		handleAPIKeyError(auth.ErrKeyNotFound, c)
+		return
+	}
+	if err := rs.Keys.Revoke(id); err != nil {
+		handleAPIKeyError(err, c)
+		return
+	}
+	rs.audit(c, audit.ActionKeyRevoked, keys[i].Tenant, id, keys[i], nil)
+	c.Status(http.StatusNoContent)
+}
+
+// tenantAPIKeys returns the api keys the request's principal may manage: every key for operators,
+// otherwise only the keys bound to its tenant.
+func (rs *ReceiptServer) tenantAPIKeys(c *gin.Context) ([]auth.APIKey, error) {
+	keys, err := rs.Keys.List()
+	if err != nil {
+		return nil, err
+	}
+	if tenant := auth.PrincipalFrom(c.Request.Context()).Tenant; tenant != "" {
+		keys = slices.DeleteFunc(keys, func(key auth.APIKey) bool { return key.Tenant != tenant })
+	}
+	return keys, nil
+}
+
+func handleAPIKeyError(err error, c *gin.Context) {
+	if errors.Is(err, auth.ErrInvalidKey) {
+		handleError(c, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, auth.ErrKeyNotFound) {
+		handleError(c, http.StatusNotFound, err.Error())
+	} else {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to update api keys, please try again")
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+const simpleReceiptJSON = `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"}],"total":"6.49"}`
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	adminKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+
+	do := func(method, path, key string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("missing or unknown key", func(t *testing.T) {
+		w := do("POST", "/receipts/process", "", simpleReceiptJSON)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		w = do("GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab/points", "rpk_unknown", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	var submitKey, submitKeyID string
+	t.Run("create key", func(t *testing.T) {
+		w := do("POST", "/keys", adminKey, `{"name":"pos-terminal","scopes":["submit"]}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		submitKey = response["key"].(string)
+		submitKeyID = response["id"].(string)
+
+		w = do("POST", "/keys", adminKey, `{"name":"bad","scopes":["everything"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		// only admins manage keys
+		w = do("POST", "/keys", submitKey, `{"name":"escalate","scopes":["admin"]}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("scopes and attribution", func(t *testing.T) {
+		w := do("POST", "/receipts/process", submitKey, simpleReceiptJSON)
+		assert.Equal(t, http.StatusOK, w.Code)
+		receiptResponse := decodeResponse(w, t)
+
+		// a submit-only key cannot read points
+		w = do("GET", "/receipts/"+receiptResponse.ID+"/points", submitKey, "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		record, err := server.Service.GetReceipt(context.Background(), receiptResponse.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, submitKeyID, record.SubmittedBy)
+	})
+
+	t.Run("list and revoke keys", func(t *testing.T) {
+		w := do("GET", "/keys", adminKey, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "hash")
+		assert.NotContains(t, w.Body.String(), submitKey)
+
+		w = do("DELETE", "/keys/"+submitKeyID, adminKey, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = do("POST", "/receipts/process", submitKey, simpleReceiptJSON)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = do("DELETE", "/keys/"+submitKeyID, adminKey, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestJWTReceiptOwnership(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	sign := setupTestJWT(t, server)
+	adminKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+
+	tokenFor := func(sub string) string { return sign(jwt.MapClaims{"sub": sub}) }
+	doTenant := func(method, path, token, tenant, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+	do := func(method, path, token string, body string) *httptest.ResponseRecorder {
+		return doTenant(method, path, token, "", body)
+	}
+
+	alice, bob := tokenFor("alice"), tokenFor("bob")
+	w := do("POST", "/receipts/process", alice, simpleReceiptJSON)
+	assert.Equal(t, http.StatusOK, w.Code)
+	id := decodeResponse(w, t).ID
+
+	assert.Equal(t, http.StatusOK, do("GET", "/receipts/"+id+"/points", alice, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/receipts/"+id+"/points", bob, "").Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/receipts/"+id+"/points", adminKey, "").Code)
+	// end users get submit and read only
+	assert.Equal(t, http.StatusForbidden, do("GET", "/keys", alice, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/receipts/"+id+"/points", "not.a.jwt", "").Code)
+
+	record, err := server.Service.GetReceipt(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", record.Account)
+
+	t.Run("tokens without a tenant are not operators", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, do("POST", "/tenants", adminKey, `{"id":"acme","name":"Acme Rewards"}`).Code)
+		mallory := sign(jwt.MapClaims{"sub": "mallory", "scope": "read submit admin"})
+		assert.Equal(t, http.StatusForbidden, doTenant("POST", "/receipts/process", mallory, "acme", simpleReceiptJSON).Code)
+		assert.Equal(t, http.StatusForbidden, doTenant("GET", "/review", mallory, "acme", "").Code)
+		assert.Equal(t, http.StatusForbidden, do("GET", "/tenants", mallory, "").Code)
+		assert.Equal(t, http.StatusForbidden, do("GET", "/audit", mallory, "").Code)
+		// a token with a tenant claim stays in it too
+		acme := sign(jwt.MapClaims{"sub": "carol", "tenant": "acme"})
+		assert.Equal(t, http.StatusForbidden, doTenant("GET", "/balance", acme, "default", "").Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/balance", acme, "").Code)
+	})
+}
+
+// setupTestJWT makes server accept JWTs signed by a new key and returns a func that signs claims with it.
+// Tokens expire in an hour.
+func setupTestJWT(t *testing.T, server *ReceiptServer) func(claims jwt.MapClaims) string {
+	t.Helper()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	data, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "test", "n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()), "e": "AQAB",
+	}}})
+	assert.NoError(t, os.WriteFile(jwks, data, 0600))
+	verifier, err := auth.NewJWTVerifier(jwks)
+	assert.NoError(t, err)
+	server.JWT = verifier
+
+	return func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+}
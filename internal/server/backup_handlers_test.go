@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/backup"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadBackup(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+
+	get := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/backup", nil)
+		req.Header.Set("X-API-Key", key)
+		server.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusForbidden, get(createTestKey(t, server.Keys, auth.ScopeRead)).Code)
+
+	w := get(createTestKey(t, server.Keys, auth.ScopeAdmin))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	path := filepath.Join(t.TempDir(), "backup.db")
+	assert.NoError(t, os.WriteFile(path, w.Body.Bytes(), 0600))
+	assert.NoError(t, backup.Validate(path))
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/eventlog"
+)
+
+// heartbeatInterval is how often an idle event stream sends a comment to keep proxies from closing it.
+var heartbeatInterval = 15 * time.Second
+
+// streamEvents serves receipt events as Server-Sent Events. Clients may filter by ?retailer= and resume
+// after a disconnect by sending the Last-Event-ID header; events still in the log are replayed first.
+// Principals acting in a tenant only see that tenant's events, and principals acting for an account only see
+// the events of its receipts unless they have the admin scope.
+func (rs *ReceiptServer) streamEvents(c *gin.Context) {
+	var lastID uint64
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			handleError(c, http.StatusBadRequest, "Last-Event-ID is not a valid event id")
+			return
+		}
+		lastID = id
+	}
+	retailer := c.Query("retailer")
+	principal := auth.PrincipalFrom(c.Request.Context())
+	tenant := principal.Tenant
+	var account string
+	if principal.Account != "" && !principal.HasScope(auth.ScopeAdmin) {
+		account = principal.Account
+	}
+
+	// listen before reading the backlog so no event falls between the two
+	live, stop := rs.Events.Listen()
+	defer stop()
+	backlog, err := rs.Events.Since(lastID)
+	if err != nil {
+		handleError(c, http.StatusInternalServerError, "failed to read events")
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	send := func(entry eventlog.Entry) {
+		if entry.ID <= lastID {
+			return
+		}
+		lastID = entry.ID
+		if retailer != "" && !strings.EqualFold(entry.Event.Retailer, retailer) {
+			return
+		}
+		if tenant != "" && entry.Event.Tenant != tenant {
+			return
+		}
+		if account != "" && entry.Event.Account != account {
+			return
+		}
+		sse.Encode(c.Writer, sse.Event{
+			Id:    strconv.FormatUint(entry.ID, 10),
+			Event: entry.Event.Type,
+			Data:  entry.Event,
+		})
+	}
+	for _, entry := range backlog {
+		send(entry)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case entry, ok := <-live:
+			if !ok {
+				return
+			}
+			send(entry)
+		case <-heartbeat.C:
+			c.Writer.WriteString(": keep-alive\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/eventlog"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+type sseMessage struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvents reads n events from an SSE response body.
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) []sseMessage {
+	t.Helper()
+	var messages []sseMessage
+	var current sseMessage
+	for len(messages) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.event != "" {
+				messages = append(messages, current)
+			}
+			current = sseMessage{}
+		case strings.HasPrefix(line, "id:"):
+			current.id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			current.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			current.data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	return messages
+}
+
+func TestStreamEvents(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	events := eventlog.NewLog(db)
+	svc.SubscribeTx(events.Record)
+	svc.Subscribe(events.Notify)
+	server := NewReceiptServer()
+	server.Service = svc
+	server.Events = events
+	server.Keys = auth.NewKeyStore(db)
+	apiKey := createTestKey(t, server.Keys, auth.ScopeRead)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	receipt := func(retailer string) *model.Receipt {
+		return &model.Receipt{Retailer: retailer, PurchaseDate: "2022-03-20", PurchaseTime: "14:33",
+			Items: []model.Item{{ShortDescription: "Gatorade", Price: "2.25"}}, Total: "9.00"}
+	}
+	targetID, err := svc.ProcessReceipt(context.Background(), receipt("Target"))
+	assert.NoError(t, err)
+	_, err = svc.ProcessReceipt(context.Background(), receipt("Walgreens"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events?retailer=target", nil)
+	req.Header.Set("X-API-Key", apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+
+	// replayed from the log, Walgreens is filtered out
+	messages := readEvents(t, scanner, 1)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "1", messages[0].id)
+	assert.Equal(t, service.EventReceiptScored, messages[0].event)
+	var event service.Event
+	assert.NoError(t, json.Unmarshal([]byte(messages[0].data), &event))
+	assert.Equal(t, targetID, event.ReceiptID)
+	assert.Equal(t, 91, event.Points)
+	assert.NotEmpty(t, event.Rules)
+
+	// delivered live
+	_, err = svc.ProcessReceipt(context.Background(), receipt("Target"))
+	assert.NoError(t, err)
+	messages = readEvents(t, scanner, 1)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "3", messages[0].id)
+
+	t.Run("resume with Last-Event-ID", func(t *testing.T) {
+		req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set("Last-Event-ID", "1")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		messages := readEvents(t, bufio.NewScanner(resp.Body), 2)
+		assert.Len(t, messages, 2)
+		assert.Equal(t, "2", messages[0].id)
+		assert.Equal(t, "3", messages[1].id)
+	})
+
+	t.Run("end users only see their own receipts", func(t *testing.T) {
+		sign := setupTestJWT(t, server)
+		earlier, err := events.Since(0)
+		assert.NoError(t, err)
+		lastID := strconv.FormatUint(earlier[len(earlier)-1].ID, 10)
+		for _, account := range []string{"alice", "bob"} {
+			ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "jwt:" + account, Account: account, Tenant: auth.DefaultTenant, Scopes: []string{auth.ScopeSubmit}})
+			_, err := svc.ProcessReceipt(ctx, receipt(account+"'s shop"))
+			assert.NoError(t, err)
+		}
+
+		// after the earlier events, alice's receipt comes before bob's
+		for token, account := range map[string]string{
+			sign(jwt.MapClaims{"sub": "alice"}):                   "alice",
+			sign(jwt.MapClaims{"sub": "bob"}):                     "bob",
+			sign(jwt.MapClaims{"sub": "carol", "scope": "admin"}): "alice",
+		} {
+			req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Last-Event-ID", lastID)
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			messages := readEvents(t, bufio.NewScanner(resp.Body), 1)
+			resp.Body.Close()
+			if assert.Len(t, messages, 1) {
+				var event service.Event
+				assert.NoError(t, json.Unmarshal([]byte(messages[0].data), &event))
+				assert.Equal(t, account, event.Account)
+			}
+		}
+	})
+
+	t.Run("invalid Last-Event-ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/events", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set("Last-Event-ID", "abc")
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
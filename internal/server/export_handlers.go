@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/export"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+)
+
+// DefaultMaxImportBytes is the default body limit of POST /receipts/import, which takes whole files.
+const DefaultMaxImportBytes = 256 << 20
+
+// exportReceipts streams the receipts of the principal's tenant that match the from, to and retailer
+// query parameters, in the format given by the format parameter (csv by default).
+func (rs *ReceiptServer) exportReceipts(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	filter := service.ReceiptFilter{From: c.Query("from"), To: c.Query("to"), Retailer: c.Query("retailer")}
+	if err := filter.Validate(); err != nil {
+		handleExportError(err, c)
+		return
+	}
+	w, err := export.NewWriter(format, c.Writer)
+	if err != nil {
+		handleExportError(err, c)
+		return
+	}
+	// errors after this are only logged, since the status has been sent by then
+	tenant := auth.PrincipalFrom(c.Request.Context()).Tenant
+	if tenant == "" {
+		tenant = service.DefaultTenant
+	}
+	if _, err := rs.Service.Tenant(tenant); err != nil {
+		handleExportError(err, c)
+		return
+	}
+
+	name := "receipts-" + time.Now().UTC().Format("20060102T150405Z") + export.Extension(format)
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Status(http.StatusOK)
+	err = rs.Service.EachReceipt(c.Request.Context(), filter, w.Write)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		// the status has been sent, so the client sees a truncated file
+		log.Printf("export failed: %v\n", err)
+	}
+}
+
+// importReceipts stores the receipts in the request body, in the format given by the format parameter
+// (csv by default), in the principal's tenant. With rescore=true, points are recalculated.
+func (rs *ReceiptServer) importReceipts(c *gin.Context) {
+	rescore, err := strconv.ParseBool(c.DefaultQuery("rescore", "false"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "rescore must be true or false")
+		return
+	}
+	r, err := export.NewReader(c.DefaultQuery("format", "csv"), c.Request.Body)
+	if err != nil {
+		handleExportError(err, c)
+		return
+	}
+
+	result, err := rs.Service.ImportReceipts(c.Request.Context(), r.Read, rescore)
+	if err != nil {
+		handleExportError(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func handleExportError(err error, c *gin.Context) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		handleBindError(err, c)
+	} else if errors.Is(err, service.ErrTenantNotFound) {
+		handleError(c, http.StatusNotFound, err.Error())
+	} else if errors.Is(err, service.ErrInvalidFilter) || errors.Is(err, service.ErrInvalidImport) || errors.Is(err, export.ErrUnknownFormat) {
+		handleError(c, http.StatusBadRequest, err.Error())
+	} else {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to transfer receipts, please try again")
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	adminKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+	submitKey := createTestKey(t, server.Keys, auth.ScopeSubmit, auth.ScopeRead)
+
+	do := func(method, path, key, tenant, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", key)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, do("POST", "/receipts/process", submitKey, "", simpleReceiptJSON).Code)
+
+	assert.Equal(t, http.StatusForbidden, do("GET", "/receipts/export", submitKey, "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/receipts/export?format=xml", adminKey, "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/receipts/export?from=yesterday", adminKey, "", "").Code)
+	w := do("GET", "/receipts/export", adminKey, "nobody", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+
+	w = do("GET", "/receipts/export?format=csv&retailer=Target", adminKey, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "id,tenant,retailer"))
+	exported := w.Body.String()
+
+	w = do("POST", "/tenants", adminKey, "", `{"id":"brand","name":"Brand Club","rules":["retailer_name"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = do("POST", "/receipts/import?format=csv&rescore=true", adminKey, "brand", exported)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result service.ImportResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, service.ImportResult{Imported: 1}, result)
+
+	w = do("GET", "/receipts/export?format=ndjson", adminKey, "brand", "")
+	var record service.StoredReceipt
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &record))
+	assert.Equal(t, "brand", record.Tenant)
+	assert.Equal(t, 6, record.Points)
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/receipts/import?format=ndjson", adminKey, "", "{not json").Code)
+	for _, tc := range []struct{ name, format, body string }{
+		{"csv without required columns", "csv", "retailer,total\nTarget,6.49\n"},
+		{"empty csv", "csv", ""},
+		{"columnar that is not gzip compressed", "columnar", `{"format":"receipts-columnar","version":1}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do("POST", "/receipts/import?format="+tc.format, adminKey, "", tc.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "invalid import")
+		})
+	}
+
+	server.MaxImportBytes = 10
+	assert.Equal(t, http.StatusRequestEntityTooLarge, do("POST", "/receipts/import?format=csv", adminKey, "", exported).Code)
+}
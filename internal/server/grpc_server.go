@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/pb"
+	"github.com/pranathireddyk/receipt-processor/internal/ratelimit"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/pranathireddyk/receipt-processor/internal/tracing"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// GRPCReceiptServer serves the ReceiptProcessor gRPC API using the same service as ReceiptServer.
+type GRPCReceiptServer struct {
+	pb.UnimplementedReceiptProcessorServer
+	Service *service.ReceiptService
+}
+
+// methodScopes is the scope each gRPC method requires, matching the HTTP routes.
+var methodScopes = map[string]string{
+	pb.ReceiptProcessor_ProcessReceipt_FullMethodName: auth.ScopeSubmit,
+	pb.ReceiptProcessor_GetPoints_FullMethodName:      auth.ScopeRead,
+	pb.ReceiptProcessor_SubmitBatch_FullMethodName:    auth.ScopeSubmit,
+}
+
+// methodRoutes is the HTTP route each gRPC method shares its rate limit with.
+var methodRoutes = map[string]string{
+	pb.ReceiptProcessor_ProcessReceipt_FullMethodName: "POST /receipts/process",
+	pb.ReceiptProcessor_GetPoints_FullMethodName:      "GET /receipts/:id/points",
+	pb.ReceiptProcessor_SubmitBatch_FullMethodName:    "POST /receipts/process",
+}
+
+// NewGRPCReceiptServer creates a grpc.Server with the ReceiptProcessor service registered.
+// Calls are authenticated by authenticator the same way as HTTP requests, and limited by the limiter of their
+// method's HTTP route in rateLimits, as in ReceiptServer.RateLimits. Passing the same limiters as the HTTP
+// server gives clients one quota across both transports.
+func NewGRPCReceiptServer(svc *service.ReceiptService, authenticator auth.Authenticator, rateLimits map[string]*ratelimit.Limiter, opts ...grpc.ServerOption) *grpc.Server {
+	a := &grpcAuthenticator{authenticator: authenticator, rateLimits: rateLimits}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor, a.limitUnary, a.unary),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor, a.limitStream, a.stream))
+	s := grpc.NewServer(opts...)
+	pb.RegisterReceiptProcessorServer(s, &GRPCReceiptServer{Service: svc})
+	return s
+}
+
+func (gs *GRPCReceiptServer) ProcessReceipt(ctx context.Context, req *pb.ProcessReceiptRequest) (*pb.ProcessReceiptResponse, error) {
+	id, err := gs.Service.ProcessReceipt(ctx, receiptFromProto(req.GetReceipt()))
+	if err != nil {
+		return nil, processReceiptStatus(err).Err()
+	}
+	return &pb.ProcessReceiptResponse{Id: id}, nil
+}
+
+func (gs *GRPCReceiptServer) GetPoints(ctx context.Context, req *pb.GetPointsRequest) (*pb.GetPointsResponse, error) {
+	points, err := gs.Service.GetPoints(ctx, req.GetId())
+	if err != nil {
+		return nil, getPointsStatus(err).Err()
+	}
+	return &pb.GetPointsResponse{Points: int64(points)}, nil
+}
+
+func (gs *GRPCReceiptServer) SubmitBatch(stream pb.ReceiptProcessor_SubmitBatchServer) error {
+	for index := int32(0); ; index++ {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result := &pb.BatchResult{Index: index}
+		id, err := gs.Service.ProcessReceipt(stream.Context(), receiptFromProto(req.GetReceipt()))
+		if err != nil {
+			st := processReceiptStatus(err)
+			result.Code = int32(st.Code())
+			result.Error = st.Message()
+		} else {
+			result.Id = id
+		}
+		if err := stream.Send(result); err != nil {
+			return err
+		}
+	}
+}
+
+// processReceiptStatus maps service errors to the gRPC equivalent of handleProcessReceiptError.
+func processReceiptStatus(err error) *status.Status {
+	var validationErr *model.ValidationError
+	if errors.As(err, &validationErr) {
+		st := status.New(codes.InvalidArgument, err.Error())
+		if validationErr.Code == "" {
+			return st
+		}
+		// clients read the code from an ErrorInfo detail, as HTTP clients do from the code field
+		detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{Reason: validationErr.Code, Metadata: map[string]string{"field": validationErr.Field}})
+		if detailErr != nil {
+			return st
+		}
+		return detailed
+	} else if errors.Is(err, service.ErrTenantNotFound) {
+		return status.New(codes.NotFound, err.Error())
+	} else if errors.Is(err, service.ErrReceiptBlocked) {
+		return status.New(codes.FailedPrecondition, service.ErrReceiptBlocked.Error())
+	}
+	log.Println(err)
+	return status.New(codes.Internal, "failed to process the receipt, please try again")
+}
+
+// getPointsStatus maps service errors to the gRPC equivalent of handleGetPointsError.
+func getPointsStatus(err error) *status.Status {
+	if errors.Is(err, service.ErrInvalidId) {
+		return status.New(codes.InvalidArgument, err.Error())
+	} else if errors.Is(err, service.ErrIdNotFound) {
+		return status.New(codes.NotFound, err.Error())
+	}
+	return status.New(codes.Internal, "failed to get points for the id")
+}
+
+// grpcAuthenticator is the gRPC equivalent of ReceiptServer.requireScope and ReceiptServer.rateLimit.
+type grpcAuthenticator struct {
+	authenticator auth.Authenticator
+	rateLimits    map[string]*ratelimit.Limiter
+}
+
+func (a *grpcAuthenticator) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *grpcAuthenticator) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// limitUnary enforces the rate limit of the method's HTTP route, if it has one.
+func (a *grpcAuthenticator) limitUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	limiter := a.rateLimits[methodRoutes[info.FullMethod]]
+	if limiter == nil {
+		return handler(ctx, req)
+	}
+	ctx, key := a.rateKey(ctx)
+	if err := allow(limiter, key); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// limitStream enforces the rate limit of the method's HTTP route on every message received, so a stream of
+// receipts is limited like as many HTTP requests.
+func (a *grpcAuthenticator) limitStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	limiter := a.rateLimits[methodRoutes[info.FullMethod]]
+	if limiter == nil {
+		return handler(srv, ss)
+	}
+	ctx, key := a.rateKey(ss.Context())
+	return handler(srv, &limitedStream{ServerStream: ss, ctx: ctx, limiter: limiter, key: key})
+}
+
+// rateKey returns the rate limiter key of the call, as ReceiptServer.rateLimit does: its principal once its
+// credential has been verified, and otherwise the peer's IP address.
+func (a *grpcAuthenticator) rateKey(ctx context.Context) (context.Context, string) {
+	ctx, principal, err := a.verify(ctx)
+	if err == nil {
+		return ctx, principalRateKey(principal)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, splitErr := net.SplitHostPort(p.Addr.String())
+		if splitErr != nil {
+			host = p.Addr.String()
+		}
+		return ctx, "ip:" + host
+	}
+	return ctx, "ip:"
+}
+
+// allow takes a token for key from limiter, or returns a ResourceExhausted error saying when to retry.
+func allow(limiter *ratelimit.Limiter, key string) error {
+	result := limiter.Allow(key)
+	if result.Allowed {
+		return nil
+	}
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded, please retry later")
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(result.RetryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// limitedStream takes a rate limit token for every message received.
+type limitedStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	limiter *ratelimit.Limiter
+	key     string
+}
+
+func (s *limitedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *limitedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return allow(s.limiter, s.key)
+}
+
+// credentialContextKey is the context key of a call's verifiedCredential.
+type credentialContextKey struct{}
+
+// verify returns the principal of the call's credential, read from the x-api-key or authorization metadata.
+// The credential is checked once per call; the returned context carries the result for later interceptors.
+func (a *grpcAuthenticator) verify(ctx context.Context) (context.Context, *auth.Principal, error) {
+	if verified, ok := ctx.Value(credentialContextKey{}).(verifiedCredential); ok {
+		return ctx, verified.principal, verified.err
+	}
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		token = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 {
+		token, _ = strings.CutPrefix(values[0], "Bearer ")
+	}
+	principal, err := a.authenticator.Authenticate(strings.TrimSpace(token))
+	return context.WithValue(ctx, credentialContextKey{}, verifiedCredential{principal: principal, err: err}), principal, err
+}
+
+// authenticate checks the call's credential has the method's scope.
+// Operator credentials select a tenant with the x-tenant-id metadata, as with the X-Tenant-ID header, and
+// x-request-id sets the request id kept in the audit log.
+func (a *grpcAuthenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	ctx, principal, err := a.verify(ctx)
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			log.Println(err)
+		}
+		return nil, status.Error(codes.Unauthenticated, auth.ErrUnauthenticated.Error())
+	}
+	if !principal.HasScope(methodScopes[method]) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-tenant-id"); len(values) > 0 {
+		if principal, err = principal.ForTenant(values[0]); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+	requestID := uuid.New().String()
+	if values := md.Get("x-request-id"); len(values) > 0 && validRequestID(values[0]) {
+		requestID = values[0]
+	}
+	return audit.WithRequestID(auth.WithPrincipal(ctx, principal), requestID), nil
+}
+
+// authenticatedStream overrides the stream context so handlers see the principal.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func receiptFromProto(r *pb.Receipt) *model.Receipt {
+	receipt := &model.Receipt{
+		Retailer:         r.GetRetailer(),
+		PurchaseDate:     r.GetPurchaseDate(),
+		PurchaseTime:     r.GetPurchaseTime(),
+		PurchaseTimezone: r.GetPurchaseTimezone(),
+		PurchasedAt:      r.GetPurchasedAt(),
+		Total:            r.GetTotal(),
+	}
+	for _, item := range r.GetItems() {
+		receipt.Items = append(receipt.Items, model.Item{
+			ShortDescription: item.GetShortDescription(),
+			Price:            item.GetPrice(),
+		})
+	}
+	return receipt
+}
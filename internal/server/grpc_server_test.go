@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/pb"
+	"github.com/pranathireddyk/receipt-processor/internal/ratelimit"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newGRPCClient(t *testing.T, svc *service.ReceiptService, keys *auth.KeyStore) pb.ReceiptProcessorClient {
+	t.Helper()
+	return newLimitedGRPCClient(t, svc, keys, nil)
+}
+
+// newLimitedGRPCClient is newGRPCClient with the server's rate limits set to rateLimits.
+func newLimitedGRPCClient(t *testing.T, svc *service.ReceiptService, keys *auth.KeyStore, rateLimits map[string]*ratelimit.Limiter) pb.ReceiptProcessorClient {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	s := NewGRPCReceiptServer(svc, keys, rateLimits)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewReceiptProcessorClient(conn)
+}
+
+func testProtoReceipt() *pb.Receipt {
+	return &pb.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []*pb.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+		Total: "9.00",
+	}
+}
+
+func TestGRPCMatchesHTTP(t *testing.T) {
+	db := database.NewBoltDatabase(":memory:")
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	keys := auth.NewKeyStore(db)
+	apiKey := createTestKey(t, keys, auth.ScopeSubmit, auth.ScopeRead)
+	client := newGRPCClient(t, svc, keys)
+	server := NewReceiptServer()
+	server.Service = svc
+	server.Keys = keys
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", apiKey)
+
+	t.Run("ProcessReceipt then GetPoints over both transports", func(t *testing.T) {
+		resp, err := client.ProcessReceipt(ctx, &pb.ProcessReceiptRequest{Receipt: testProtoReceipt()})
+		assert.NoError(t, err)
+		assertUUID(resp.Id, t)
+
+		points, err := client.GetPoints(ctx, &pb.GetPointsRequest{Id: resp.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(109), points.Points)
+
+		// the receipt is visible through the HTTP api as well
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/receipts/"+resp.Id+"/points", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]int
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 109, response["points"])
+	})
+
+	t.Run("GetPoints errors", func(t *testing.T) {
+		tests := []struct {
+			id         string
+			code       codes.Code
+			httpStatus int
+		}{
+			{"123", codes.InvalidArgument, http.StatusBadRequest},
+			{"d49ae048-61cc-4236-a258-1c4b3c2362ab", codes.NotFound, http.StatusNotFound},
+		}
+		for _, test := range tests {
+			_, err := client.GetPoints(ctx, &pb.GetPointsRequest{Id: test.id})
+			st, _ := status.FromError(err)
+			assert.Equal(t, test.code, st.Code())
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/receipts/"+test.id+"/points", nil)
+			req.Header.Set("X-API-Key", apiKey)
+			server.ServeHTTP(w, req)
+			assert.Equal(t, test.httpStatus, w.Code)
+			var response map[string]string
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, st.Message(), response["error"])
+		}
+	})
+
+	t.Run("ProcessReceipt invalid receipt", func(t *testing.T) {
+		receipt := testProtoReceipt()
+		receipt.PurchaseTime = "26:01"
+		_, err := client.ProcessReceipt(ctx, &pb.ProcessReceiptRequest{Receipt: receipt})
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+
+		body, _ := json.Marshal(map[string]any{
+			"retailer": receipt.Retailer, "purchaseDate": receipt.PurchaseDate, "purchaseTime": receipt.PurchaseTime,
+			"items": []map[string]string{}, "total": receipt.Total,
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer(body))
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, st.Message(), response["error"])
+
+		receipt = testProtoReceipt()
+		receipt.Items[0].Price = "a2.25"
+		_, err = client.ProcessReceipt(ctx, &pb.ProcessReceiptRequest{Receipt: receipt})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestGRPCSubmitBatch(t *testing.T) {
+	db := database.NewBoltDatabase(":memory:")
+	defer db.Close()
+	keys := auth.NewKeyStore(db)
+	client := newGRPCClient(t, service.NewReceiptService(db), keys)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+createTestKey(t, keys, auth.ScopeSubmit))
+
+	stream, err := client.SubmitBatch(ctx)
+	assert.NoError(t, err)
+	invalid := testProtoReceipt()
+	invalid.Total = "nine"
+	for _, receipt := range []*pb.Receipt{testProtoReceipt(), invalid, testProtoReceipt()} {
+		assert.NoError(t, stream.Send(&pb.ProcessReceiptRequest{Receipt: receipt}))
+	}
+	assert.NoError(t, stream.CloseSend())
+
+	var results []*pb.BatchResult
+	for {
+		result, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		results = append(results, result)
+	}
+	assert.Len(t, results, 3)
+	assertUUID(results[0].Id, t)
+	assert.Equal(t, int32(1), results[1].Index)
+	assert.Equal(t, int32(codes.InvalidArgument), results[1].Code)
+	assert.Equal(t, "field `total` is not in the correct format", results[1].Error)
+	assertUUID(results[2].Id, t)
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	db := database.NewBoltDatabase(":memory:")
+	defer db.Close()
+	keys := auth.NewKeyStore(db)
+	client := newGRPCClient(t, service.NewReceiptService(db), keys)
+
+	_, err := client.ProcessReceipt(context.Background(), &pb.ProcessReceiptRequest{Receipt: testProtoReceipt()})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", createTestKey(t, keys, auth.ScopeRead))
+	_, err = client.ProcessReceipt(ctx, &pb.ProcessReceiptRequest{Receipt: testProtoReceipt()})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	stream, err := client.SubmitBatch(ctx)
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestGRPCRateLimits(t *testing.T) {
+	db := database.NewBoltDatabase(":memory:")
+	defer db.Close()
+	svc := service.NewReceiptService(db)
+	keys := auth.NewKeyStore(db)
+	keyA := createTestKey(t, keys, auth.ScopeSubmit)
+	keyB := createTestKey(t, keys, auth.ScopeSubmit)
+	limiter := ratelimit.NewLimiter(ratelimit.Limit{Rate: 0.001, Burst: 2})
+	client := newLimitedGRPCClient(t, svc, keys, map[string]*ratelimit.Limiter{"POST /receipts/process": limiter})
+	with := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+	process := func(ctx context.Context) error {
+		_, err := client.ProcessReceipt(ctx, &pb.ProcessReceiptRequest{Receipt: testProtoReceipt()})
+		return err
+	}
+
+	t.Run("rate limit per principal", func(t *testing.T) {
+		assert.NoError(t, process(with(keyA)))
+		assert.NoError(t, process(with(keyA)))
+		err := process(with(keyA))
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		details := status.Convert(err).Details()
+		if assert.Len(t, details, 1) {
+			assert.InDelta(t, 1000, details[0].(*errdetails.RetryInfo).RetryDelay.AsDuration().Seconds(), 1)
+		}
+		assert.NoError(t, process(with(keyB)))
+	})
+
+	t.Run("made up credentials share the bucket of their ip", func(t *testing.T) {
+		assert.Equal(t, codes.Unauthenticated, status.Code(process(with("made-up-1"))))
+		assert.Equal(t, codes.Unauthenticated, status.Code(process(with("made-up-2"))))
+		assert.Equal(t, codes.ResourceExhausted, status.Code(process(with("made-up-3"))))
+	})
+
+	t.Run("each message of a batch counts", func(t *testing.T) {
+		stream, err := client.SubmitBatch(with(keyB))
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&pb.ProcessReceiptRequest{Receipt: testProtoReceipt()}))
+		result, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.NotEmpty(t, result.Id)
+		assert.NoError(t, stream.Send(&pb.ProcessReceiptRequest{Receipt: testProtoReceipt()}))
+		_, err = stream.Recv()
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/buildinfo"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BeginShutdown makes /readyz fail, so the orchestrator stops routing new requests here before the server stops.
+func (rs *ReceiptServer) BeginShutdown() {
+	rs.draining.Store(true)
+}
+
+// healthz reports that the process is alive. It checks nothing else, so a slow dependency never gets the process restarted.
+func (rs *ReceiptServer) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyz reports whether the server can handle requests, with the result of each check.
+func (rs *ReceiptServer) readyz(c *gin.Context) {
+	checks := map[string]string{}
+	ready := true
+	check := func(name string, err error) {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+		}
+	}
+	if rs.draining.Load() {
+		check("shutdown", errors.New("server is shutting down"))
+	}
+	check("config", rs.checkConfig())
+	if rs.Service != nil {
+		check("database", checkDatabase(rs.Service.DB))
+		check("rules", rs.Service.ValidateRuleSets())
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
+
+func (rs *ReceiptServer) version(c *gin.Context) {
+	info := buildinfo.Get()
+	rules := make([]string, 0, len(service.DefaultRules))
+	for _, rule := range service.DefaultRules {
+		rules = append(rules, rule.Name)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"commit":        info.Commit,
+		"buildTime":     info.BuildTime,
+		"goVersion":     info.GoVersion,
+		"rulesVersion":  service.RulesVersion,
+		"rules":         rules,
+		"schemaVersion": database.LatestVersion(),
+	})
+}
+
+// checkConfig verifies the dependencies every route needs have been set.
+func (rs *ReceiptServer) checkConfig() error {
+	if rs.Service == nil || rs.Keys == nil {
+		return errors.New("receipt service or api key store is not configured")
+	}
+	return nil
+}
+
+// checkDatabase verifies the database is open, writable and at this build's schema version. It only reads, so it
+// neither waits for nor holds up the single writer.
+func checkDatabase(db *bolt.DB) error {
+	if db.IsReadOnly() {
+		return errors.New("database is read-only")
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		version, err := database.SchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if version != database.LatestVersion() {
+			return fmt.Errorf("database is at schema version %d, expected %d", version, database.LatestVersion())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	server := NewReceiptServer()
+
+	get := func(path string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		server.ServeHTTP(w, req)
+		var response map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	t.Run("not ready until configured", func(t *testing.T) {
+		code, response := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.NotEqual(t, "ok", response["checks"].(map[string]any)["config"])
+		// alive regardless
+		code, _ = get("/healthz")
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	t.Run("ready", func(t *testing.T) {
+		code, response := get("/readyz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]any{"config": "ok", "database": "ok", "rules": "ok"}, response["checks"])
+	})
+
+	t.Run("ready while a write is in progress", func(t *testing.T) {
+		tx, err := db.Begin(true)
+		assert.NoError(t, err)
+		defer tx.Rollback()
+		code, _ := get("/readyz")
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("a tenant naming a rule this build does not have", func(t *testing.T) {
+		put := func(data []byte) {
+			assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+				if data == nil {
+					return tx.Bucket([]byte("tenants")).Delete([]byte("acme"))
+				}
+				return tx.Bucket([]byte("tenants")).Put([]byte("acme"), data)
+			}))
+		}
+		put([]byte(`{"id":"acme","name":"Acme","rules":["retired-rule"]}`))
+		defer put(nil)
+		code, response := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, `tenant acme: unknown rule "retired-rule"`, response["checks"].(map[string]any)["rules"])
+	})
+
+	t.Run("version", func(t *testing.T) {
+		code, response := get("/version")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, service.RulesVersion, response["rulesVersion"])
+		assert.NotEmpty(t, response["commit"])
+		assert.Len(t, response["rules"], len(service.DefaultRules))
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		server.BeginShutdown()
+		code, response := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "server is shutting down", response["checks"].(map[string]any)["shutdown"])
+		code, _ = get("/healthz")
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("database closed", func(t *testing.T) {
+		db.Close()
+		code, response := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "database not open", response["checks"].(map[string]any)["database"])
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+)
+
+// rateLimit enforces the limiter in rs.RateLimits for the matched route, if there is one. Clients are told
+// their remaining quota with RateLimit-* headers. They are identified by their principal once their credential
+// has been verified, and otherwise by IP address, so sending made up credentials does not get a fresh bucket.
+func (rs *ReceiptServer) rateLimit(c *gin.Context) {
+	limiter := rs.RateLimits[c.Request.Method+" "+c.FullPath()]
+	if limiter == nil {
+		c.Next()
+		return
+	}
+	key := "ip:" + c.ClientIP()
+	if principal, err := rs.verifyCredential(c); err == nil {
+		key = principalRateKey(principal)
+	}
+
+	result := limiter.Allow(key)
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", seconds(result.Reset))
+	if !result.Allowed {
+		c.Header("Retry-After", seconds(result.RetryAfter))
+		handleError(c, http.StatusTooManyRequests, "rate limit exceeded, please retry later")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// principalRateKey is the rate limiter key of an authenticated client. The tenant is part of it as JWT
+// subjects are only unique within their issuer's tenant.
+func principalRateKey(principal *auth.Principal) string {
+	return "principal:" + principal.Tenant + "/" + principal.ID
+}
+
+// limitBody rejects request bodies larger than rs.MaxBodyBytes, or rs.MaxImportBytes for imports, once they are read.
+func (rs *ReceiptServer) limitBody(c *gin.Context) {
+	limit := rs.MaxBodyBytes
+	if c.Request.Method == http.MethodPost && c.FullPath() == "/receipts/import" {
+		limit = rs.MaxImportBytes
+	}
+	if limit > 0 && c.Request.Body != nil {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+	c.Next()
+}
+
+// handleBindError responds to a request body that could not be decoded.
+func handleBindError(err error, c *gin.Context) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		handleError(c, http.StatusRequestEntityTooLarge, "request body must not be larger than "+strconv.FormatInt(maxBytesErr.Limit, 10)+" bytes")
+		return
+	}
+	handleError(c, http.StatusBadRequest, err.Error())
+}
+
+// seconds formats d as whole seconds, rounded up, for the Retry-After and RateLimit-Reset headers.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/ratelimit"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitsAndSizeLimits(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	server.RateLimits = map[string]*ratelimit.Limiter{
+		"POST /receipts/process": ratelimit.NewLimiter(ratelimit.Limit{Rate: 0.001, Burst: 2}),
+	}
+	keyA := createTestKey(t, server.Keys, auth.ScopeSubmit)
+	keyB := createTestKey(t, server.Keys, auth.ScopeSubmit)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("rate limit per api key", func(t *testing.T) {
+		w := do("POST", "/receipts/process", keyA, simpleReceiptJSON)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, http.StatusOK, do("POST", "/receipts/process", keyA, simpleReceiptJSON).Code)
+
+		w = do("POST", "/receipts/process", keyA, simpleReceiptJSON)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1000", w.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, do("POST", "/receipts/process", keyB, simpleReceiptJSON).Code)
+	})
+
+	t.Run("rate limit per ip without a key", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do("POST", "/receipts/process", "", simpleReceiptJSON).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("POST", "/receipts/process", "", simpleReceiptJSON).Code)
+		assert.Equal(t, http.StatusTooManyRequests, do("POST", "/receipts/process", "", simpleReceiptJSON).Code)
+	})
+
+	t.Run("made up credentials share the bucket of their ip", func(t *testing.T) {
+		assert.Equal(t, http.StatusTooManyRequests, do("POST", "/receipts/process", "made-up-1", simpleReceiptJSON).Code)
+		assert.Equal(t, http.StatusTooManyRequests, do("POST", "/receipts/process", "made-up-2", simpleReceiptJSON).Code)
+	})
+
+	t.Run("forwarded addresses are ignored unless the proxy is trusted", func(t *testing.T) {
+		forwarded := func(addr string) int {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(simpleReceiptJSON))
+			req.RemoteAddr = "10.0.0.1:4000"
+			req.Header.Set("X-Forwarded-For", addr)
+			server.ServeHTTP(w, req)
+			return w.Code
+		}
+		assert.Equal(t, http.StatusUnauthorized, forwarded("203.0.113.1"))
+		assert.Equal(t, http.StatusUnauthorized, forwarded("203.0.113.2"))
+		assert.Equal(t, http.StatusTooManyRequests, forwarded("203.0.113.3"))
+
+		assert.NoError(t, server.SetTrustedProxies([]string{"10.0.0.0/8"}))
+		defer server.SetTrustedProxies(nil)
+		assert.Equal(t, http.StatusUnauthorized, forwarded("203.0.113.4"))
+	})
+
+	t.Run("routes without a limit", func(t *testing.T) {
+		w := do("GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab/points", keyA, "")
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+
+	server.RateLimits = nil
+	t.Run("body size limit", func(t *testing.T) {
+		server.MaxBodyBytes = 256
+		defer func() { server.MaxBodyBytes = DefaultMaxBodyBytes }()
+		body := strings.Replace(simpleReceiptJSON, "Target", strings.Repeat("T", 300), 1)
+		w := do("POST", "/receipts/process", keyA, body)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("item count limit", func(t *testing.T) {
+		server.Service.MaxItems = 3
+		items := make([]string, 4)
+		for i := range items {
+			items[i] = `{"shortDescription":"Gum","price":"1.00"}`
+		}
+		body := fmt.Sprintf(`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[%s],"total":"4.00"}`, strings.Join(items, ","))
+		w := do("POST", "/receipts/process", keyA, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "field `items` must not have more than 3 entries", response["error"])
+	})
+}
@@ -4,32 +4,101 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"sync/atomic"
 
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/eventlog"
+	"github.com/pranathireddyk/receipt-processor/internal/metrics"
+	"github.com/pranathireddyk/receipt-processor/internal/ratelimit"
 	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/pranathireddyk/receipt-processor/internal/tracing"
+	"github.com/pranathireddyk/receipt-processor/internal/webhook"
 	model "github.com/pranathireddyk/receipt-processor/pkg"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	bolt "go.etcd.io/bbolt"
 )
 
 type ReceiptServer struct {
-	DB *bolt.DB
+	Service  *service.ReceiptService
+	Webhooks *webhook.Dispatcher
+	Events   *eventlog.Log
+	Keys     *auth.KeyStore
+	JWT      *auth.JWTVerifier
+	// RateLimits limits each client per route, keyed by method and route path such as "POST /receipts/process".
+	// Routes without a limiter are not limited.
+	RateLimits map[string]*ratelimit.Limiter
+	// MaxBodyBytes is the largest request body accepted. Zero means no limit.
+	MaxBodyBytes int64
+	// MaxImportBytes replaces MaxBodyBytes for POST /receipts/import. Zero means no limit.
+	MaxImportBytes int64
+	// Metrics, if set, records every request and is served on GET /metrics.
+	Metrics *metrics.Metrics
 	*gin.Engine
+
+	// draining is set by BeginShutdown.
+	draining atomic.Bool
 }
 
+// DefaultMaxBodyBytes is the default request body limit, far more than any real receipt needs.
+const DefaultMaxBodyBytes = 1 << 20
+
 type ReceiptResponse struct {
 	ID string `json:"id"`
 }
 
 // NewReceiptServer initializes the server, creates a database with dbname and sets up the router
 func NewReceiptServer() *ReceiptServer {
-	rs := &ReceiptServer{}
+	rs := &ReceiptServer{MaxBodyBytes: DefaultMaxBodyBytes, MaxImportBytes: DefaultMaxImportBytes}
 
 	router := gin.Default()
+	// clients are told apart by address, so forwarded addresses are only believed from proxies the operator trusts
+	router.SetTrustedProxies(nil)
+	router.Use(tracing.Middleware, rs.requestID, rs.observe, rs.rateLimit, rs.limitBody)
+	// GET /metrics in the Prometheus text format, for scrapers inside the deployment
+	router.GET("/metrics", rs.serveMetrics)
+	// unauthenticated probes for the orchestrator
+	router.GET("/healthz", rs.healthz)
+	router.GET("/readyz", rs.readyz)
+	router.GET("/version", rs.version)
+	submit := rs.requireScope(auth.ScopeSubmit)
+	read := rs.requireScope(auth.ScopeRead)
+	admin := rs.requireScope(auth.ScopeAdmin)
+	operator := rs.requireOperator()
 	// POST /receipts/process endpoint
-	router.POST("/receipts/process", rs.processReceipt)
+	router.POST("/receipts/process", submit, rs.processReceipt)
 	// GET /receipts/:id/points endpoint
-	router.GET("receipts/:id/points", rs.getPoints)
+	router.GET("receipts/:id/points", read, rs.getPoints)
+	// manual points adjustments, shown by GET /receipts/:id/points?history=true
+	router.POST("/receipts/:id/adjustments", admin, rs.adjustPoints)
+	// review queue of suspicious receipts, decisions on them, and account balances of approved receipts
+	router.GET("/review", admin, rs.listReviewQueue)
+	router.POST("/receipts/:id/decision", admin, rs.decideReceipt)
+	router.GET("/balance", read, rs.getBalance)
+	// right to erasure, and the audit records of erased receipts
+	router.DELETE("/receipts/:id", admin, rs.deleteReceipt)
+	router.GET("/deletions", admin, rs.listDeletions)
+	// bulk export and import of the tenant's receipts
+	router.GET("/receipts/export", admin, rs.exportReceipts)
+	router.POST("/receipts/import", admin, rs.importReceipts)
+	// webhook subscription endpoints
+	router.POST("/webhooks", admin, rs.createWebhook)
+	router.GET("/webhooks", admin, rs.listWebhooks)
+	router.DELETE("/webhooks/:id", admin, rs.deleteWebhook)
+	// GET /events server-sent event stream
+	router.GET("/events", read, rs.streamEvents)
+	// api key management endpoints
+	router.POST("/keys", admin, rs.createAPIKey)
+	router.GET("/keys", admin, rs.listAPIKeys)
+	router.DELETE("/keys/:id", admin, rs.revokeAPIKey)
+	// tenant provisioning endpoints
+	router.POST("/tenants", operator, rs.createTenant)
+	router.GET("/tenants", operator, rs.listTenants)
+	router.GET("/tenants/:id", operator, rs.getTenant)
+	router.DELETE("/tenants/:id", operator, rs.deleteTenant)
+	// GET /backup online backup of the whole database
+	router.GET("/backup", operator, rs.downloadBackup)
+	// the audit log of every tenant, and verification of its hash chain
+	router.GET("/audit", operator, rs.listAudit)
+	router.GET("/audit/verify", operator, rs.verifyAudit)
 
 	rs.Engine = router
 	return rs
@@ -39,19 +108,13 @@ func (rs *ReceiptServer) processReceipt(c *gin.Context) {
 	var receipt model.Receipt
 
 	if err := c.ShouldBindJSON(&receipt); err != nil {
-		handleError(c, http.StatusBadRequest, err.Error())
-		return
-	}
-
-	if err := receipt.Validate(); err != nil {
-		handleError(c, http.StatusBadRequest, err.Error())
+		handleBindError(err, c)
 		return
 	}
 
-	id, err := service.ProcessReceipt(&receipt, rs.DB)
+	id, err := rs.Service.ProcessReceipt(c.Request.Context(), &receipt)
 	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process the receipt, please try again"})
+		handleProcessReceiptError(err, c)
 		return
 	}
 
@@ -59,13 +122,12 @@ func (rs *ReceiptServer) processReceipt(c *gin.Context) {
 }
 
 func (rs *ReceiptServer) getPoints(c *gin.Context) {
-	id := c.Params.ByName("id")
-	if _, err := uuid.Parse(id); err != nil {
-		handleError(c, http.StatusBadRequest, "id is not a uuid")
+	if c.Query("history") == "true" {
+		rs.getPointsHistory(c)
 		return
 	}
-
-	points, err := service.GetPoints(id, rs.DB)
+	id := c.Params.ByName("id")
+	points, err := rs.Service.GetPoints(c.Request.Context(), id)
 	if err != nil {
 		handleGetPointsError(err, c)
 		return
@@ -74,12 +136,47 @@ func (rs *ReceiptServer) getPoints(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"points": points})
 }
 
+// observe records the request in rs.Metrics, if metrics are enabled.
+func (rs *ReceiptServer) observe(c *gin.Context) {
+	if rs.Metrics == nil {
+		c.Next()
+		return
+	}
+	rs.Metrics.Middleware(c)
+}
+
+func (rs *ReceiptServer) serveMetrics(c *gin.Context) {
+	if rs.Metrics == nil {
+		handleError(c, http.StatusNotFound, "metrics are not enabled")
+		return
+	}
+	rs.Metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
 func handleError(c *gin.Context, statusCode int, message string) {
 	c.JSON(statusCode, gin.H{"error": message})
 }
 
+func handleProcessReceiptError(err error, c *gin.Context) {
+	var validationErr *model.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Code != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": validationErr.Code})
+	} else if errors.As(err, &validationErr) {
+		handleError(c, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, service.ErrTenantNotFound) {
+		handleError(c, http.StatusNotFound, err.Error())
+	} else if errors.Is(err, service.ErrReceiptBlocked) {
+		handleError(c, http.StatusUnprocessableEntity, service.ErrReceiptBlocked.Error())
+	} else {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to process the receipt, please try again")
+	}
+}
+
 func handleGetPointsError(err error, c *gin.Context) {
-	if errors.Is(err, service.ErrIdNotFound) {
+	if errors.Is(err, service.ErrInvalidId) {
+		handleError(c, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, service.ErrIdNotFound) {
 		handleError(c, http.StatusNotFound, err.Error())
 	} else {
 		handleError(c, http.StatusInternalServerError, "failed to get points for the id")
@@ -7,7 +7,9 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
 	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,12 +17,15 @@ import (
 func TestGetPoints(t *testing.T) {
 	db := database.NewBoltDatabase(":memory:")
 	server := NewReceiptServer()
-	server.DB = db
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	apiKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
 	defer db.Close()
 	// Test /receipts/:id/points endpoint with invalid id
 	t.Run("GET /receipts/:id/points", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/receipts/123/points", nil)
+		req.Header.Set("X-API-Key", apiKey)
 		server.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
@@ -30,6 +35,7 @@ func TestGetPoints(t *testing.T) {
 	t.Run("GET /receipts/:id/points", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab/points", nil)
+		req.Header.Set("X-API-Key", apiKey)
 		server.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
@@ -39,12 +45,15 @@ func TestGetPoints(t *testing.T) {
 func TestProcessReceipt(t *testing.T) {
 	db := database.NewBoltDatabase(":memory:")
 	server := NewReceiptServer()
-	server.DB = db
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	apiKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
 	defer db.Close()
 	// Test /receipts/process endpoint invalid json
 	t.Run("POST /receipts/process", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", nil)
+		req.Header.Set("X-API-Key", apiKey)
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
@@ -78,6 +87,7 @@ func TestProcessReceipt(t *testing.T) {
 		  }`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set("X-API-Key", apiKey)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
@@ -112,6 +122,7 @@ func TestProcessReceipt(t *testing.T) {
 			}`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set("X-API-Key", apiKey)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
@@ -147,6 +158,7 @@ func TestProcessReceipt(t *testing.T) {
 			  }`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set("X-API-Key", apiKey)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
@@ -182,12 +194,34 @@ func TestProcessReceipt(t *testing.T) {
 			  }`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set("X-API-Key", apiKey)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
+	t.Run("POST /receipts/process with a future purchase date", func(t *testing.T) {
+		receiptJSON := `{
+			"retailer": "Target",
+			"purchaseDate": "2999-01-01",
+			"purchaseTime": "13:01",
+			"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+			"total": "6.49"
+		  }`
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response map[string]string
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assertNoErrorWhileDecodingJson(err, t, w)
+		assert.Equal(t, service.CodePurchaseInFuture, response["code"])
+	})
+
 	t.Run("POST /receipts/process with valid JSON", func(t *testing.T) {
 		// Mock receipt JSON for testing
 		receiptJSON := `{
@@ -217,6 +251,7 @@ func TestProcessReceipt(t *testing.T) {
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set("X-API-Key", apiKey)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
@@ -228,6 +263,7 @@ func TestProcessReceipt(t *testing.T) {
 
 		w = httptest.NewRecorder()
 		req, _ = http.NewRequest("GET", "/receipts/"+receiptResponse.ID+"/points", nil)
+		req.Header.Set("X-API-Key", apiKey)
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusOK, w.Code)
 		var response map[string]int
@@ -238,6 +274,16 @@ func TestProcessReceipt(t *testing.T) {
 
 }
 
+// createTestKey creates an api key with the given scopes and returns the key itself.
+func createTestKey(t testing.TB, keys *auth.KeyStore, scopes ...string) string {
+	t.Helper()
+	_, token, err := keys.Create("test", "", scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
 func decodeResponse(response *httptest.ResponseRecorder, t testing.TB) ReceiptResponse {
 	t.Helper()
 	var got ReceiptResponse
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deleteReceipt erases a receipt for a right to erasure request. The optional reason query parameter
+// is kept in the deletion's audit record.
+func (rs *ReceiptServer) deleteReceipt(c *gin.Context) {
+	if err := rs.Service.DeleteReceipt(c.Request.Context(), c.Params.ByName("id"), c.Query("reason")); err != nil {
+		handleGetPointsError(err, c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (rs *ReceiptServer) listDeletions(c *gin.Context) {
+	deletions, err := rs.Service.Deletions(c.Request.Context())
+	if err != nil {
+		handleError(c, http.StatusInternalServerError, "failed to list deletions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deletions": deletions})
+}
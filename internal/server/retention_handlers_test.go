@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteReceipt(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	adminKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+	posKey := createTestKey(t, server.Keys, auth.ScopeSubmit, auth.ScopeRead)
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", key)
+		server.ServeHTTP(w, req)
+		return w
+	}
+	var deleted []service.Event
+	server.Service.Subscribe(func(event service.Event) {
+		if event.Type == service.EventReceiptDeleted {
+			deleted = append(deleted, event)
+		}
+	})
+
+	id := decodeResponse(do("POST", "/receipts/process", posKey, simpleReceiptJSON), t).ID
+	assert.Equal(t, http.StatusForbidden, do("DELETE", "/receipts/"+id, posKey, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("DELETE", "/receipts/not-a-uuid", adminKey, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/receipts/"+id+"?reason=erasure+request+42", adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/receipts/"+id+"/points", posKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/receipts/"+id, adminKey, "").Code)
+	assert.Len(t, deleted, 1)
+
+	w := do("GET", "/deletions", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string][]service.Deletion
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response["deletions"], 1)
+	assert.Equal(t, id, response["deletions"][0].ReceiptID)
+	assert.Equal(t, "erasure request 42", response["deletions"][0].Reason)
+	assert.NotEmpty(t, response["deletions"][0].DeletedBy)
+}
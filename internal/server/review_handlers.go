@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+)
+
+type decisionRequest struct {
+	Decision string `json:"decision" binding:"required"`
+	Reason   string `json:"reason"`
+}
+
+func (rs *ReceiptServer) listReviewQueue(c *gin.Context) {
+	queue, err := rs.Service.ReviewQueue(c.Request.Context())
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to list receipts under review")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"receipts": queue})
+}
+
+func (rs *ReceiptServer) decideReceipt(c *gin.Context) {
+	var req decisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(err, c)
+		return
+	}
+
+	record, err := rs.Service.DecideReceipt(c.Request.Context(), c.Params.ByName("id"), req.Decision, req.Reason)
+	if err != nil {
+		handleDecisionError(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": record.ID, "status": record.Status, "statusHistory": record.StatusHistory})
+}
+
+// getBalance responds with the points of the caller's account. Admins may name any account with the account
+// query parameter.
+func (rs *ReceiptServer) getBalance(c *gin.Context) {
+	principal := auth.PrincipalFrom(c.Request.Context())
+	account := principal.Account
+	if principal.HasScope(auth.ScopeAdmin) && c.Query("account") != "" {
+		account = c.Query("account")
+	}
+	if account == "" {
+		handleError(c, http.StatusBadRequest, "account is required")
+		return
+	}
+	balance, err := rs.Service.Balance(c.Request.Context(), account)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to get the balance")
+		return
+	}
+	c.JSON(http.StatusOK, balance)
+}
+
+func handleDecisionError(err error, c *gin.Context) {
+	if errors.Is(err, service.ErrInvalidDecision) {
+		handleError(c, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, service.ErrInvalidTransition) {
+		handleError(c, http.StatusConflict, err.Error())
+	} else {
+		handleGetPointsError(err, c)
+	}
+}
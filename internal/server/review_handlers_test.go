@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewQueue(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	adminKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+	posKey := createTestKey(t, server.Keys, auth.ScopeSubmit, auth.ScopeRead)
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", key)
+		server.ServeHTTP(w, req)
+		return w
+	}
+	queue := func() []service.StoredReceipt {
+		w := do("GET", "/review", adminKey, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string][]service.StoredReceipt
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["receipts"]
+	}
+
+	decodeResponse(do("POST", "/receipts/process", posKey, simpleReceiptJSON), t)
+	assert.Empty(t, queue())
+	id := decodeResponse(do("POST", "/receipts/process", posKey, simpleReceiptJSON), t).ID
+	inconsistent := decodeResponse(do("POST", "/receipts/process", posKey,
+		`{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:01","items":[{"shortDescription":"Pepsi","price":"6.49"}],"total":"1.00"}`), t).ID
+
+	got := queue()
+	assert.Len(t, got, 2)
+	assert.Equal(t, id, got[0].ID)
+	assert.Equal(t, []string{service.FlagDuplicate}, got[0].ReviewFlags)
+	assert.Equal(t, []string{service.FlagInconsistentTotal}, got[1].ReviewFlags)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/review", posKey, "").Code)
+
+	t.Run("decision", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do("POST", "/receipts/"+id+"/decision", posKey, `{"decision": "approve"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/receipts/"+id+"/decision", adminKey, `{"decision": "maybe"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/receipts/"+id+"/decision", adminKey, `{}`).Code)
+		assert.Equal(t, http.StatusNotFound, do("POST", "/receipts/7fb1377b-b223-49d9-a31a-5a02701dd310/decision", adminKey, `{"decision": "approve"}`).Code)
+
+		w := do("POST", "/receipts/"+id+"/decision", adminKey, `{"decision": "approve"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"approved"`)
+		assert.Equal(t, http.StatusConflict, do("POST", "/receipts/"+id+"/decision", adminKey, `{"decision": "reject", "reason": "too late"}`).Code)
+		assert.Equal(t, http.StatusOK, do("POST", "/receipts/"+inconsistent+"/decision", adminKey, `{"decision": "reject", "reason": "altered total"}`).Code)
+		assert.Empty(t, queue())
+	})
+
+	t.Run("balance", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do("GET", "/balance", posKey, "").Code)
+		w := do("GET", "/balance?account=alice", adminKey, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var balance service.Balance
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &balance))
+		assert.Equal(t, service.Balance{Account: "alice"}, balance)
+	})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+)
+
+type tenantRequest struct {
+	ID          string                   `json:"id" binding:"required"`
+	Name        string                   `json:"name" binding:"required"`
+	Rules       []string                 `json:"rules"`
+	TimeWindows []service.TimeWindowRule `json:"timeWindows"`
+	Retention   *service.Retention       `json:"retention"`
+}
+
+func (rs *ReceiptServer) createTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(err, c)
+		return
+	}
+
+	tenant, err := rs.Service.CreateTenant(service.Tenant{ID: req.ID, Name: req.Name, Rules: req.Rules, TimeWindows: req.TimeWindows, Retention: req.Retention})
+	if err != nil {
+		handleTenantError(err, c)
+		return
+	}
+	rs.audit(c, audit.ActionTenantCreated, tenant.ID, tenant.ID, nil, tenant)
+	c.JSON(http.StatusCreated, tenant)
+}
+
+func (rs *ReceiptServer) listTenants(c *gin.Context) {
+	tenants, err := rs.Service.Tenants()
+	if err != nil {
+		handleTenantError(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tenants": tenants})
+}
+
+func (rs *ReceiptServer) getTenant(c *gin.Context) {
+	tenant, err := rs.Service.Tenant(c.Params.ByName("id"))
+	if err != nil {
+		handleTenantError(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, tenant)
+}
+
+func (rs *ReceiptServer) deleteTenant(c *gin.Context) {
+	tenant, err := rs.Service.Tenant(c.Params.ByName("id"))
+	if err != nil {
+		handleTenantError(err, c)
+		return
+	}
+	if err := rs.Service.DeleteTenant(tenant.ID); err != nil {
+		handleTenantError(err, c)
+		return
+	}
+	rs.audit(c, audit.ActionTenantDeleted, tenant.ID, tenant.ID, tenant, nil)
+	c.Status(http.StatusNoContent)
+}
+
+func handleTenantError(err error, c *gin.Context) {
+	if errors.Is(err, service.ErrInvalidTenant) {
+		handleError(c, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, service.ErrTenantNotFound) {
+		handleError(c, http.StatusNotFound, err.Error())
+	} else if errors.Is(err, service.ErrTenantExists) {
+		handleError(c, http.StatusConflict, err.Error())
+	} else {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to update tenants, please try again")
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/pranathireddyk/receipt-processor/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	server.Webhooks = webhook.NewDispatcher(db)
+	server.Service.OnDeleteTenant(server.Webhooks.DeleteTenant)
+	operatorKey := createTestKey(t, server.Keys, auth.ScopeAdmin)
+
+	do := func(method, path, key, tenant, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+	createKey := func(adminKey, body string) string {
+		w := do("POST", "/keys", adminKey, "", body)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["key"].(string)
+	}
+
+	t.Run("provisioning", func(t *testing.T) {
+		w := do("POST", "/tenants", operatorKey, "", `{"id":"acme","name":"Acme Rewards"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		// brand only awards points for the retailer name
+		w = do("POST", "/tenants", operatorKey, "", `{"id":"brand","name":"Brand Club","rules":["retailer_name"]}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		assert.Equal(t, http.StatusConflict, do("POST", "/tenants", operatorKey, "", `{"id":"acme","name":"Again"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/tenants", operatorKey, "", `{"id":"Bad Id","name":"Bad"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/tenants", operatorKey, "", `{"id":"default","name":"Default"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/tenants", operatorKey, "", `{"id":"other","name":"Other","rules":["double_points"]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/tenants", operatorKey, "", `{"id":"other","name":"Other",
+			"timeWindows":[{"name":"late","points":5,"window":{"start":"22:00","end":"22:00"}}]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/tenants", operatorKey, "", `{"id":"other","name":"Other",
+			"timeWindows":[{"name":"odd_day","points":5,"window":{"start":"22:00","end":"02:00"}}]}`).Code)
+
+		w = do("GET", "/tenants", operatorKey, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string][]service.Tenant
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response["tenants"], 2)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/tenants/missing", operatorKey, "", "").Code)
+	})
+
+	acmeAdmin := createKey(operatorKey, `{"name":"acme-admin","tenant":"acme","scopes":["admin"]}`)
+	acmeKey := createKey(acmeAdmin, `{"name":"acme-pos","scopes":["submit","read"]}`)
+	brandKey := createKey(operatorKey, `{"name":"brand-pos","tenant":"brand","scopes":["submit","read"]}`)
+
+	t.Run("receipts are only visible to their tenant", func(t *testing.T) {
+		w := do("POST", "/receipts/process", acmeKey, "", simpleReceiptJSON)
+		assert.Equal(t, http.StatusOK, w.Code)
+		id := decodeResponse(w, t).ID
+
+		assert.Equal(t, http.StatusOK, do("GET", "/receipts/"+id+"/points", acmeKey, "", "").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/receipts/"+id+"/points", brandKey, "", "").Code)
+		// the operator sees the default tenant unless it selects another one
+		assert.Equal(t, http.StatusNotFound, do("GET", "/receipts/"+id+"/points", operatorKey, "", "").Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/receipts/"+id+"/points", operatorKey, "acme", "").Code)
+		// a tenant key cannot select another tenant
+		assert.Equal(t, http.StatusForbidden, do("GET", "/receipts/"+id+"/points", brandKey, "acme", "").Code)
+	})
+
+	t.Run("per-tenant rules", func(t *testing.T) {
+		points := func(key string) int {
+			w := do("POST", "/receipts/process", key, "", simpleReceiptJSON)
+			assert.Equal(t, http.StatusOK, w.Code)
+			w = do("GET", "/receipts/"+decodeResponse(w, t).ID+"/points", key, "", "")
+			var response map[string]int
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			return response["points"]
+		}
+		assert.Equal(t, 12, points(acmeKey))
+		assert.Equal(t, 6, points(brandKey))
+	})
+
+	t.Run("tenant admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do("GET", "/tenants", acmeAdmin, "", "").Code)
+		assert.Equal(t, http.StatusForbidden, do("POST", "/keys", acmeAdmin, "", `{"name":"x","tenant":"brand","scopes":["read"]}`).Code)
+
+		w := do("GET", "/keys", acmeAdmin, "", "")
+		var response map[string][]auth.APIKey
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response["keys"], 2)
+		for _, key := range response["keys"] {
+			assert.Equal(t, "acme", key.Tenant)
+		}
+	})
+
+	t.Run("unknown tenant", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do("POST", "/receipts/process", operatorKey, "missing", simpleReceiptJSON).Code)
+		assert.Equal(t, http.StatusNotFound, do("POST", "/keys", operatorKey, "", `{"name":"x","tenant":"missing","scopes":["read"]}`).Code)
+	})
+
+	t.Run("delete tenant", func(t *testing.T) {
+		brandAdmin := createKey(operatorKey, `{"name":"brand-admin","tenant":"brand","scopes":["admin"]}`)
+		hook := `{"url":"https://203.0.113.10/hook","events":["receipt.scored"]}`
+		assert.Equal(t, http.StatusCreated, do("POST", "/webhooks", brandAdmin, "", hook).Code)
+		assert.Equal(t, http.StatusCreated, do("POST", "/webhooks", acmeAdmin, "", hook).Code)
+
+		assert.Equal(t, http.StatusNoContent, do("DELETE", "/tenants/brand", operatorKey, "", "").Code)
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/tenants/brand", operatorKey, "", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, do("POST", "/receipts/process", brandKey, "", simpleReceiptJSON).Code)
+
+		// a tenant created again with the same id starts without the old keys, webhooks and receipts
+		assert.Equal(t, http.StatusCreated, do("POST", "/tenants", operatorKey, "", `{"id":"brand","name":"Brand Club"}`).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("POST", "/receipts/process", brandKey, "", simpleReceiptJSON).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/webhooks", brandAdmin, "", "").Code)
+		w := do("GET", "/keys", operatorKey, "", "")
+		var keys map[string][]auth.APIKey
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+		for _, key := range keys["keys"] {
+			assert.NotEqual(t, "brand", key.Tenant)
+		}
+		w = do("GET", "/webhooks", operatorKey, "", "")
+		var hooks map[string][]webhook.Subscription
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hooks))
+		assert.Len(t, hooks["webhooks"], 1)
+		assert.Equal(t, "acme", hooks["webhooks"][0].Tenant)
+		w = do("GET", "/receipts/export?format=ndjson", operatorKey, "brand", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	server := NewReceiptServer()
+	server.Service = service.NewReceiptService(db)
+	server.Keys = auth.NewKeyStore(db)
+	apiKey := createTestKey(t, server.Keys, auth.ScopeSubmit)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(simpleReceiptJSON))
+	req.Header.Set("X-API-Key", apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	id := decodeResponse(w, t).ID
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String(), span.Name())
+	}
+	handler, svc := spans["POST /receipts/process"], spans["ReceiptService.ProcessReceipt"]
+	score, update := spans["CalculatePoints"], spans["bolt.Update"]
+	if !assert.NotNil(t, handler) || !assert.NotNil(t, svc) || !assert.NotNil(t, score) || !assert.NotNil(t, update) {
+		return
+	}
+	assert.Equal(t, "00f067aa0ba902b7", handler.Parent().SpanID().String())
+	assert.Equal(t, handler.SpanContext().SpanID(), svc.Parent().SpanID())
+	assert.Equal(t, svc.SpanContext().SpanID(), score.Parent().SpanID())
+	assert.Equal(t, svc.SpanContext().SpanID(), update.Parent().SpanID())
+
+	attrs := attribute.NewSet(svc.Attributes()...)
+	value, _ := attrs.Value("receipt.id")
+	assert.Equal(t, id, value.AsString())
+	value, _ = attrs.Value("receipt.item_count")
+	assert.Equal(t, int64(1), value.AsInt64())
+	value, _ = attrs.Value("receipt.points")
+	assert.Equal(t, int64(12), value.AsInt64())
+}
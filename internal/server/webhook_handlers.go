@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/webhook"
+)
+
+type webhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required"`
+	Secret string   `json:"secret"`
+}
+
+func (rs *ReceiptServer) createWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(err, c)
+		return
+	}
+
+	tenant := auth.PrincipalFrom(c.Request.Context()).Tenant
+	sub, err := rs.Webhooks.CreateSubscription(webhook.Subscription{URL: req.URL, Events: req.Events, Secret: req.Secret, Tenant: tenant})
+	if err != nil {
+		handleWebhookError(err, c)
+		return
+	}
+	rs.audit(c, audit.ActionWebhookCreated, sub.Tenant, sub.ID, nil, sub)
+	// the secret is only ever returned here, so the client can verify signatures
+	c.JSON(http.StatusCreated, sub)
+}
+
+func (rs *ReceiptServer) listWebhooks(c *gin.Context) {
+	subs, err := rs.tenantWebhooks(c)
+	if err != nil {
+		handleWebhookError(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": subs})
+}
+
+func (rs *ReceiptServer) deleteWebhook(c *gin.Context) {
+	subs, err := rs.tenantWebhooks(c)
+	if err != nil {
+		handleWebhookError(err, c)
+		return
+	}
+	id := c.Params.ByName("id")
+	// subscriptions of other tenants are reported as not found
+	i := slices.IndexFunc(subs, func(sub webhook.Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		handleWebhookError(webhook.ErrSubscriptionNotFound, c)
+		return
+	}
+	if err := rs.Webhooks.DeleteSubscription(id); err != nil {
+		handleWebhookError(err, c)
+		return
+	}
+	rs.audit(c, audit.ActionWebhookDeleted, subs[i].Tenant, id, subs[i], nil)
+	c.Status(http.StatusNoContent)
+}
+
+// tenantWebhooks returns the subscriptions the request's principal may manage: every subscription for
+// operators, otherwise only those of its tenant.
+func (rs *ReceiptServer) tenantWebhooks(c *gin.Context) ([]webhook.Subscription, error) {
+	subs, err := rs.Webhooks.Subscriptions()
+	if err != nil {
+		return nil, err
+	}
+	if tenant := auth.PrincipalFrom(c.Request.Context()).Tenant; tenant != "" {
+		subs = slices.DeleteFunc(subs, func(sub webhook.Subscription) bool { return sub.Tenant != tenant })
+	}
+	return subs, nil
+}
+
+func handleWebhookError(err error, c *gin.Context) {
+	if errors.Is(err, webhook.ErrInvalidSubscription) {
+		handleError(c, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, webhook.ErrSubscriptionNotFound) {
+		handleError(c, http.StatusNotFound, err.Error())
+	} else {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, "failed to update webhooks, please try again")
+	}
+}
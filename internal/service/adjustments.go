@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidAdjustment is returned for a points adjustment without a delta or reason, or one that would make
+// the receipt's points negative.
+var ErrInvalidAdjustment = errors.New("invalid adjustment")
+
+// Adjustment is a manual change to the points of a receipt, such as goodwill points or the correction of a
+// scoring mistake. The points computed when the receipt was scored are never changed; a receipt's points are
+// the computed points plus the deltas of its adjustments.
+type Adjustment struct {
+	ReceiptID string `json:"receiptId"`
+	Delta     int    `json:"delta"`
+	Reason    string `json:"reason"`
+	// Actor is the id of the principal that made the adjustment.
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PointsHistory is how a receipt's points came about.
+type PointsHistory struct {
+	// Points is ComputedPoints plus the deltas of Adjustments.
+	Points         int          `json:"points"`
+	ComputedPoints int          `json:"computedPoints"`
+	Adjustments    []Adjustment `json:"adjustments"`
+}
+
+// AdjustPoints records an adjustment of delta points to receipt id in the tenant of the principal in ctx and
+// returns it with the receipt's new points. It returns ErrInvalidId, ErrIdNotFound or ErrInvalidAdjustment.
+func (s *ReceiptService) AdjustPoints(ctx context.Context, id string, delta int, reason string) (*Adjustment, int, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, 0, ErrInvalidId
+	}
+	reason = strings.TrimSpace(reason)
+	if delta == 0 {
+		return nil, 0, fmt.Errorf("%w: delta must not be zero", ErrInvalidAdjustment)
+	}
+	if reason == "" {
+		return nil, 0, fmt.Errorf("%w: reason is required", ErrInvalidAdjustment)
+	}
+	tenant := tenantFrom(ctx)
+	adjustment := &Adjustment{ReceiptID: id, Delta: delta, Reason: reason, CreatedAt: time.Now().UTC()}
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		adjustment.Actor = p.ID
+	}
+	data, err := json.Marshal(adjustment)
+	if err != nil {
+		return nil, 0, err
+	}
+	var points int
+	var account string
+	var event Event
+	version := s.pointsVersion(tenant, id)
+	err = s.DB.Update(func(tx *bolt.Tx) error {
+		history, err := pointsHistory(tx, tenant, id)
+		if err != nil {
+			return err
+		}
+		var status string
+		account, status, err = receiptOwner(tx, tenant, id)
+		if err != nil {
+			return err
+		}
+		points = history.Points + delta
+		if points < 0 {
+			return fmt.Errorf("%w: the receipt has %d points, so it cannot be adjusted by %d", ErrInvalidAdjustment, history.Points, delta)
+		}
+		entry := auditEntry(ctx, audit.ActionPointsAdjusted, tenant, id)
+		entry.Time = adjustment.CreatedAt
+		entry.Before = audit.HashJSON(history)
+		history.Points = points
+		history.Adjustments = append(history.Adjustments, *adjustment)
+		entry.After = audit.HashJSON(history)
+		if err := audit.Append(tx, entry); err != nil {
+			return err
+		}
+		if err := updateBalance(tx, tenant, account, shareOf(status, points-delta), shareOf(status, points)); err != nil {
+			return err
+		}
+		if err := putAdjustment(tx, tenant, id, data); err != nil {
+			return err
+		}
+		event = Event{Type: EventPointsAdjusted, Tenant: tenant, ReceiptID: id, Account: account, Points: points}
+		return s.recordEvents(tx, &event)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	s.updatePoints(tenant, id, CachedPoints{Points: points, Account: account}, version)
+	s.publish(event)
+	return adjustment, points, nil
+}
+
+// PointsHistory returns the computed points of receipt id in the tenant of the principal in ctx and its
+// adjustments, oldest first. It returns ErrInvalidId or ErrIdNotFound under the same rules as GetPoints.
+func (s *ReceiptService) PointsHistory(ctx context.Context, id string) (*PointsHistory, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidId
+	}
+	if err := s.checkAccount(ctx, id); err != nil {
+		return nil, err
+	}
+	var history *PointsHistory
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		history, err = pointsHistory(tx, tenantFrom(ctx), id)
+		return err
+	})
+	return history, err
+}
+
+// pointsHistory reads the computed points and adjustments of tenant's receipt id.
+func pointsHistory(tx *bolt.Tx, tenant, id string) (*PointsHistory, error) {
+	bucket := tenantBucket(tx, tenant, "points")
+	if bucket == nil {
+		return nil, ErrIdNotFound
+	}
+	data := bucket.Get([]byte(id))
+	if data == nil {
+		return nil, ErrIdNotFound
+	}
+	computed, err := DecodePoints(data)
+	if err != nil {
+		return nil, err
+	}
+	adjustments, err := readAdjustments(tx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	return &PointsHistory{Points: adjustedPoints(computed, adjustments), ComputedPoints: computed, Adjustments: adjustments}, nil
+}
+
+// receiptOwner returns the account and status of tenant's receipt id. The account is "" if it has none or the
+// receipt is no longer stored.
+func receiptOwner(tx *bolt.Tx, tenant, id string) (account, status string, err error) {
+	receipts := tenantBucket(tx, tenant, "receipts")
+	if receipts == nil || receipts.Get([]byte(id)) == nil {
+		return "", "", nil
+	}
+	var record StoredReceipt
+	if err := decodeReceipt(receipts.Get([]byte(id)), &record); err != nil {
+		return "", "", err
+	}
+	return record.Account, record.CurrentStatus(), nil
+}
+
+// readAdjustments returns the adjustments of tenant's receipt id, oldest first.
+func readAdjustments(tx *bolt.Tx, tenant, id string) ([]Adjustment, error) {
+	adjustments := []Adjustment{}
+	bucket := tenantBucket(tx, tenant, "adjustments")
+	if bucket == nil {
+		return adjustments, nil
+	}
+	bucket = bucket.Bucket([]byte(id))
+	if bucket == nil {
+		return adjustments, nil
+	}
+	err := bucket.ForEach(func(_, v []byte) error {
+		var adjustment Adjustment
+		if err := json.Unmarshal(v, &adjustment); err != nil {
+			return err
+		}
+		adjustments = append(adjustments, adjustment)
+		return nil
+	})
+	return adjustments, err
+}
+
+// adjustedPoints returns computed plus the deltas of adjustments.
+func adjustedPoints(computed int, adjustments []Adjustment) int {
+	for _, adjustment := range adjustments {
+		computed += adjustment.Delta
+	}
+	return computed
+}
+
+// putAdjustment appends an encoded adjustment to those of tenant's receipt id.
+func putAdjustment(tx *bolt.Tx, tenant, id string, data []byte) error {
+	adjustments, err := createTenantBucket(tx, tenant, "adjustments")
+	if err != nil {
+		return err
+	}
+	bucket, err := adjustments.CreateBucketIfNotExists([]byte(id))
+	if err != nil {
+		return err
+	}
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return bucket.Put(key, data)
+}
+
+// deleteAdjustments removes the adjustments of tenant's receipt id, if it has any.
+func deleteAdjustments(tx *bolt.Tx, tenant, id string) error {
+	bucket := tenantBucket(tx, tenant, "adjustments")
+	if bucket == nil || bucket.Bucket([]byte(id)) == nil {
+		return nil
+	}
+	return bucket.DeleteBucket([]byte(id))
+}
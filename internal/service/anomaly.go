@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/cache"
+)
+
+// ErrReceiptBlocked is returned for a receipt whose risk score reaches ReceiptService.BlockRisk.
+var ErrReceiptBlocked = errors.New("receipt blocked as likely fraudulent")
+
+// FlagAnomaly is a receipt whose risk score reached ReceiptService.FlagRisk.
+const FlagAnomaly = "anomaly"
+
+// Default risk scores at which receipts are flagged for review or blocked. Blocking is off by default, since
+// a blocked receipt gets no points and no review.
+const (
+	DefaultFlagRisk  = 50
+	DefaultBlockRisk = 0
+)
+
+// Risk is how likely a receipt is to be fraudulent, from 0 to 100, with the features that added to the score.
+type Risk struct {
+	Score    int      `json:"score"`
+	Features []string `json:"features,omitempty"`
+}
+
+// AnomalyDetector assesses scored receipts before they are stored. Assess is called once for every
+// submission, including those it ends up blocking, so it may remember them to judge later ones.
+// Implementations must be safe for concurrent use and must not call other services.
+type AnomalyDetector interface {
+	Assess(ctx context.Context, record *StoredReceipt) Risk
+}
+
+// Features of FeatureDetector.
+const (
+	// FeatureRoundTotals is an account most of whose recent receipts have round dollar totals.
+	FeatureRoundTotals = "round_totals"
+	// FeatureRuleMaximizing is a round dollar total bought in the window of the afternoon purchase rule, the
+	// receipt that scores highest under the round total, quarter and purchase time rules.
+	FeatureRuleMaximizing = "rule_maximizing"
+	// FeatureVelocity is an account submitting more receipts in an hour than FeatureDetector.MaxPerHour.
+	FeatureVelocity = "velocity"
+	// FeatureImplausibleTotal is a total of zero or less, or more than FeatureDetector.MaxTotal.
+	FeatureImplausibleTotal = "implausible_total"
+)
+
+// featureWeights is the most each feature adds to a risk score.
+var featureWeights = map[string]int{
+	FeatureRoundTotals:      40,
+	FeatureRuleMaximizing:   15,
+	FeatureVelocity:         35,
+	FeatureImplausibleTotal: 35,
+}
+
+// Defaults of FeatureDetector.
+const (
+	DefaultMaxPerHour = 30
+	DefaultMaxTotal   = 5000
+	// roundTotalsWindow is how many recent receipts of an account round_totals looks at, and
+	// roundTotalsMinimum how many it needs before it scores at all.
+	roundTotalsWindow  = 20
+	roundTotalsMinimum = 5
+	// maxTrackedAccounts bounds the accounts FeatureDetector remembers.
+	maxTrackedAccounts = 100000
+)
+
+// FeatureDetector is the default AnomalyDetector. It adds up weighted features of the receipt and of the
+// recent submissions of the same account. Receipts without an account are submitted by service principals,
+// such as POS api keys and ingest consumers, on behalf of many customers, so only their own features count.
+// Submission history is kept in memory for a day, so it starts empty when the process restarts.
+type FeatureDetector struct {
+	// MaxPerHour is how many receipts an account may submit in an hour before velocity scores.
+	MaxPerHour int
+	// MaxTotal is the largest total that is plausible for one receipt.
+	MaxTotal float64
+
+	mu       sync.Mutex
+	accounts *cache.LRU[string, *accountHistory]
+	now      func() time.Time
+}
+
+// accountHistory is what FeatureDetector remembers of one account.
+type accountHistory struct {
+	// submissions are the times of the account's submissions in the last hour, oldest first.
+	submissions []time.Time
+	// roundTotals records whether each of the account's most recent receipts had a round total, oldest first.
+	roundTotals []bool
+}
+
+// NewFeatureDetector creates a FeatureDetector with the default thresholds.
+func NewFeatureDetector() *FeatureDetector {
+	return &FeatureDetector{
+		MaxPerHour: DefaultMaxPerHour,
+		MaxTotal:   DefaultMaxTotal,
+		accounts:   cache.New[string, *accountHistory](maxTrackedAccounts, 24*time.Hour),
+		now:        time.Now,
+	}
+}
+
+// Assess scores the record and remembers it in its account's history.
+func (d *FeatureDetector) Assess(_ context.Context, record *StoredReceipt) Risk {
+	now := d.now()
+	var risk Risk
+	add := func(feature string, fraction float64) {
+		if fraction > 0 {
+			risk.Score += int(float64(featureWeights[feature]) * min(fraction, 1))
+			risk.Features = append(risk.Features, feature)
+		}
+	}
+
+	total, err := cents(record.Receipt.Total)
+	round := err == nil && total%100 == 0
+	if err == nil && (total <= 0 || d.MaxTotal > 0 && float64(total) > d.MaxTotal*100) {
+		add(FeatureImplausibleTotal, 1)
+	}
+	if round && afternoonWindow.Contains(&record.Receipt) {
+		add(FeatureRuleMaximizing, 1)
+	}
+
+	if key := accountKey(record); key != "" {
+		d.mu.Lock()
+		history, ok := d.accounts.Get(key)
+		if !ok {
+			history = &accountHistory{}
+			d.accounts.Add(key, history)
+		}
+		history.submissions = append(history.submissions, now)
+		for len(history.submissions) > 0 && now.Sub(history.submissions[0]) >= time.Hour {
+			history.submissions = history.submissions[1:]
+		}
+		history.roundTotals = append(history.roundTotals, round)
+		if len(history.roundTotals) > roundTotalsWindow {
+			history.roundTotals = history.roundTotals[1:]
+		}
+		submissions := len(history.submissions)
+		var rounds int
+		for _, r := range history.roundTotals {
+			if r {
+				rounds++
+			}
+		}
+		recent := len(history.roundTotals)
+		d.mu.Unlock()
+
+		if d.MaxPerHour > 0 && submissions > d.MaxPerHour {
+			add(FeatureVelocity, 1)
+		}
+		if recent >= roundTotalsMinimum {
+			add(FeatureRoundTotals, float64(rounds)/float64(recent))
+		}
+	}
+	risk.Score = min(risk.Score, 100)
+	return risk
+}
+
+// accountKey identifies the history a receipt belongs to, that of its account. Receipts without an account
+// have no history.
+func accountKey(record *StoredReceipt) string {
+	if record.Account == "" {
+		return ""
+	}
+	return record.Tenant + "/" + record.Account
+}
+
+// assessRisk runs the anomaly detector, if there is one, on a scored record. It records the risk on the record
+// and flags it for review if the score reaches FlagRisk, or returns ErrReceiptBlocked if it reaches BlockRisk.
+func (s *ReceiptService) assessRisk(ctx context.Context, record *StoredReceipt) error {
+	if s.Anomaly == nil {
+		return nil
+	}
+	risk := s.Anomaly.Assess(ctx, record)
+	record.RiskScore = risk.Score
+	record.RiskFeatures = risk.Features
+	if s.BlockRisk > 0 && risk.Score >= s.BlockRisk {
+		return fmt.Errorf("%w: risk score %d (%s)", ErrReceiptBlocked, risk.Score, strings.Join(risk.Features, ", "))
+	}
+	if s.FlagRisk > 0 && risk.Score >= s.FlagRisk {
+		record.ReviewFlags = append(record.ReviewFlags, FlagAnomaly)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureDetector(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	newDetector := func() *FeatureDetector {
+		d := NewFeatureDetector()
+		d.MaxPerHour = 3
+		d.now = func() time.Time { return now }
+		return d
+	}
+	record := func(account, date, purchaseTime, total string) *StoredReceipt {
+		return &StoredReceipt{
+			Tenant:  DefaultTenant,
+			Account: account,
+			Receipt: model.Receipt{Retailer: "Target", PurchaseDate: date, PurchaseTime: purchaseTime, Total: total},
+		}
+	}
+
+	t.Run("ordinary receipt", func(t *testing.T) {
+		risk := newDetector().Assess(context.Background(), record("alice", "2024-02-29", "10:13", "35.35"))
+		assert.Equal(t, Risk{}, risk)
+	})
+
+	t.Run("receipt features", func(t *testing.T) {
+		d := newDetector()
+		assert.Equal(t, Risk{Score: 35, Features: []string{FeatureImplausibleTotal}}, d.Assess(context.Background(), record("", "2024-02-29", "10:13", "0.00")))
+		assert.Equal(t, Risk{Score: 35, Features: []string{FeatureImplausibleTotal}}, d.Assess(context.Background(), record("", "2024-02-29", "10:13", "5000.01")))
+		// future purchases are the date policy's to refuse
+		assert.Empty(t, d.Assess(context.Background(), record("", "2024-03-03", "10:13", "35.35")).Features)
+		assert.Equal(t, Risk{Score: 15, Features: []string{FeatureRuleMaximizing}}, d.Assess(context.Background(), record("", "2024-02-29", "14:01", "20.00")))
+		// 14:00 scores no afternoon purchase points, so it is not rule maximizing either
+		assert.Empty(t, d.Assess(context.Background(), record("", "2024-02-29", "14:00", "20.00")).Features)
+		assert.Empty(t, d.Assess(context.Background(), record("", "2024-02-29", "16:00", "20.00")).Features)
+	})
+
+	t.Run("round totals at 2:01pm", func(t *testing.T) {
+		d := newDetector()
+		d.MaxPerHour = 0
+		var risk Risk
+		for i := 0; i < roundTotalsMinimum; i++ {
+			risk = d.Assess(context.Background(), record("mallory", "2024-02-29", "14:01", "100.00"))
+		}
+		assert.Equal(t, 55, risk.Score)
+		assert.Equal(t, []string{FeatureRuleMaximizing, FeatureRoundTotals}, risk.Features)
+		// other accounts are not affected
+		assert.Equal(t, Risk{}, d.Assess(context.Background(), record("alice", "2024-02-29", "10:13", "35.35")))
+	})
+
+	t.Run("velocity", func(t *testing.T) {
+		d := newDetector()
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, Risk{}, d.Assess(context.Background(), record("bob", "2024-02-29", "10:13", "35.35")))
+		}
+		assert.Equal(t, Risk{Score: 35, Features: []string{FeatureVelocity}}, d.Assess(context.Background(), record("bob", "2024-02-29", "10:13", "35.35")))
+		now = now.Add(time.Hour)
+		assert.Equal(t, Risk{}, d.Assess(context.Background(), record("bob", "2024-02-29", "10:13", "35.35")))
+	})
+
+	t.Run("service principals have no history", func(t *testing.T) {
+		d := newDetector()
+		for i := 0; i < 10; i++ {
+			r := record("", "2024-02-29", "10:13", "100.00")
+			r.SubmittedBy = "ingest:file"
+			assert.Equal(t, Risk{}, d.Assess(context.Background(), r))
+		}
+	})
+}
+
+func TestAssessRisk(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "pos", Account: "mallory", Scopes: []string{auth.ScopeSubmit}})
+	crafted := func(day int) *model.Receipt {
+		return &model.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: time.Date(2022, 1, day, 0, 0, 0, 0, time.UTC).Format("2006-01-02"),
+			PurchaseTime: "14:01",
+			Items:        []model.Item{{ShortDescription: "Gift Card", Price: "50.00"}},
+			Total:        "50.00",
+		}
+	}
+
+	for day := 1; day < roundTotalsMinimum; day++ {
+		id, err := svc.ProcessReceipt(ctx, crafted(day))
+		assert.NoError(t, err)
+		record, err := svc.GetReceipt(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusApproved, record.Status)
+		assert.Equal(t, 15, record.RiskScore)
+	}
+
+	id, err := svc.ProcessReceipt(ctx, crafted(roundTotalsMinimum))
+	assert.NoError(t, err)
+	record, err := svc.GetReceipt(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusUnderReview, record.Status)
+	assert.Equal(t, []string{FlagAnomaly}, record.ReviewFlags)
+	assert.Equal(t, 55, record.RiskScore)
+
+	svc.BlockRisk = 50
+	_, err = svc.ProcessReceipt(ctx, crafted(roundTotalsMinimum+1))
+	assert.ErrorIs(t, err, ErrReceiptBlocked)
+}
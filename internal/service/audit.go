@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+)
+
+// auditEntry returns an audit log entry for action on tenant's target, attributed to the principal and request in ctx.
+func auditEntry(ctx context.Context, action, tenant, target string) audit.Entry {
+	entry := audit.Entry{Action: action, Tenant: tenant, Target: target, RequestID: audit.RequestIDFrom(ctx)}
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		entry.Actor, entry.Subject = p.ID, p.Account
+	}
+	return entry
+}
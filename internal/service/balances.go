@@ -0,0 +1,113 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	bolt "go.etcd.io/bbolt"
+)
+
+// the balances migration needs the receipt encoding, which only this package knows
+func init() {
+	database.BuildBalances = buildAllBalances
+}
+
+// share is what one receipt adds to its account's balance.
+type share struct {
+	approved, pending int
+}
+
+// shareOf returns what a receipt with points adds to its account's balance while it has status. Rejected and
+// reversed receipts add nothing.
+func shareOf(status string, points int) share {
+	switch status {
+	case StatusApproved:
+		return share{approved: points}
+	case StatusRejected, StatusReversed:
+		return share{}
+	}
+	return share{pending: points}
+}
+
+// updateBalance replaces what one of account's receipts adds to its balance in tenant, from before to after.
+// Balances are kept in their own bucket, updated in the transaction that changes the receipt, so they survive
+// retention deleting or anonymizing the receipts they were earned with.
+func updateBalance(tx *bolt.Tx, tenant, account string, before, after share) error {
+	if account == "" || before == after {
+		return nil
+	}
+	bucket, err := createTenantBucket(tx, tenant, "balances")
+	if err != nil {
+		return err
+	}
+	balance := Balance{Account: account}
+	if data := bucket.Get([]byte(account)); data != nil {
+		if err := json.Unmarshal(data, &balance); err != nil {
+			return err
+		}
+	}
+	balance.Points += after.approved - before.approved
+	balance.PendingPoints += after.pending - before.pending
+	data, err := json.Marshal(balance)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(account), data)
+}
+
+// buildAllBalances builds every tenant's balances from its stored receipts. It runs once, as a schema
+// migration, for databases from before balances were kept. Points of receipts that retention removed before
+// then are lost.
+func buildAllBalances(tx *bolt.Tx) error {
+	tenants := []string{DefaultTenant}
+	err := tx.Bucket([]byte("tenants")).ForEach(func(k, _ []byte) error {
+		tenants = append(tenants, string(k))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := buildBalances(tx, tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildBalances replaces tenant's balances with those of its stored receipts.
+func buildBalances(tx *bolt.Tx, tenant string) error {
+	receipts := tenantBucket(tx, tenant, "receipts")
+	if receipts == nil {
+		return nil
+	}
+	bucket, err := createTenantBucket(tx, tenant, "balances")
+	if err != nil {
+		return err
+	}
+	// clear what was added before the balances were built, as it is counted again below
+	var accounts [][]byte
+	err = bucket.ForEach(func(k, _ []byte) error {
+		accounts = append(accounts, k)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if err := bucket.Delete(account); err != nil {
+			return err
+		}
+	}
+	return receipts.ForEach(func(k, v []byte) error {
+		var record StoredReceipt
+		if err := decodeReceipt(v, &record); err != nil {
+			return err
+		}
+		history, err := pointsHistory(tx, tenant, string(k))
+		if err != nil {
+			return err
+		}
+		return updateBalance(tx, tenant, record.Account, share{}, shareOf(record.CurrentStatus(), history.Points))
+	})
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+)
+
+// Codes of the validation errors for purchase dates outside DatePolicy.
+const (
+	CodePurchaseTooOld   = "purchase_too_old"
+	CodePurchaseInFuture = "purchase_in_future"
+)
+
+// Defaults of DatePolicy. Receipts of any age are accepted by default, and the future skew allows for a store
+// whose clock is a day ahead of the service's.
+const (
+	DefaultMaxReceiptAge = 0
+	DefaultMaxFutureSkew = 24 * time.Hour
+)
+
+// DatePolicy is the window of purchase dates accepted when a receipt is submitted. Imports are not checked,
+// as they restore receipts that were accepted before.
+type DatePolicy struct {
+	// MaxAge is how long before now a receipt may have been bought. Zero accepts receipts of any age.
+	MaxAge time.Duration
+	// MaxFutureSkew is how far after now a receipt may have been bought. Negative accepts any future date.
+	MaxFutureSkew time.Duration
+	// Location is the time zone purchase dates and times are read in when the receipt has no time zone of its
+	// own. Nil means UTC.
+	Location *time.Location
+}
+
+// check returns a *model.ValidationError with a code if receipt was bought outside the policy's window around now.
+// A receipt without a purchase time is taken to have been bought at the end of its day for the age check and
+// at its start for the future check, so only a date that is wrong whatever the time is rejected.
+func (p DatePolicy) check(receipt *model.Receipt, now time.Time) error {
+	earliest, ok := receipt.Purchase(p.Location)
+	if !ok {
+		// there is no date, or Validate reports its format
+		return nil
+	}
+	latest := earliest
+	if receipt.PurchaseTime == "" {
+		latest = earliest.AddDate(0, 0, 1).Add(-time.Minute)
+	}
+	if p.MaxAge > 0 && latest.Before(now.Add(-p.MaxAge)) {
+		return &model.ValidationError{Field: "purchaseDate", Code: CodePurchaseTooOld,
+			Reason: fmt.Sprintf("must not be more than %s before now", p.MaxAge)}
+	}
+	if p.MaxFutureSkew >= 0 && earliest.After(now.Add(p.MaxFutureSkew)) {
+		return &model.ValidationError{Field: "purchaseDate", Code: CodePurchaseInFuture,
+			Reason: fmt.Sprintf("must not be more than %s after now", p.MaxFutureSkew)}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatePolicy(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	policy := DatePolicy{MaxAge: 365 * 24 * time.Hour, MaxFutureSkew: time.Hour}
+
+	tests := []struct {
+		name   string
+		policy DatePolicy
+		date   string
+		time   string
+		code   string
+	}{
+		{name: "today", policy: policy, date: "2024-03-01", time: "11:00"},
+		{name: "within the skew", policy: policy, date: "2024-03-01", time: "13:00"},
+		{name: "after the skew", policy: policy, date: "2024-03-01", time: "13:01", code: CodePurchaseInFuture},
+		{name: "tomorrow without a time", policy: policy, date: "2024-03-02", code: CodePurchaseInFuture},
+		{name: "today without a time", policy: DatePolicy{}, date: "2024-03-01"},
+		{name: "years ahead", policy: policy, date: "2030-01-01", time: "10:00", code: CodePurchaseInFuture},
+		{name: "any future date", policy: DatePolicy{MaxFutureSkew: -1}, date: "2999-01-01", time: "10:00"},
+		{name: "at the max age", policy: policy, date: "2023-03-02", time: "12:00"},
+		{name: "older than the max age", policy: policy, date: "2023-03-02", time: "11:59", code: CodePurchaseTooOld},
+		{name: "last day of the max age without a time", policy: policy, date: "2023-03-02"},
+		{name: "decades old", policy: policy, date: "1990-06-15", time: "10:00", code: CodePurchaseTooOld},
+		{name: "any age", policy: DatePolicy{}, date: "1990-06-15", time: "10:00"},
+		{name: "no date", policy: policy},
+		{name: "later in a time zone behind UTC", policy: DatePolicy{Location: newYork}, date: "2024-03-01", time: "06:59"},
+		{name: "future in a time zone behind UTC", policy: DatePolicy{Location: newYork}, date: "2024-03-01", time: "07:01", code: CodePurchaseInFuture},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.check(&model.Receipt{PurchaseDate: tt.date, PurchaseTime: tt.time}, now)
+			if tt.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *model.ValidationError
+			assert.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, "purchaseDate", validationErr.Field)
+			assert.Equal(t, tt.code, validationErr.Code)
+		})
+	}
+}
+
+func TestProcessReceiptDatePolicy(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	svc.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+	svc.Dates.MaxAge = 30 * 24 * time.Hour
+	var rejected []Event
+	svc.Subscribe(func(e Event) {
+		if e.Type == EventReceiptRejected {
+			rejected = append(rejected, e)
+		}
+	})
+	receipt := func(date string) *model.Receipt {
+		return &model.Receipt{Retailer: "Target", PurchaseDate: date, PurchaseTime: "10:00",
+			Items: []model.Item{{ShortDescription: "Pepsi", Price: "1.25"}}, Total: "1.25"}
+	}
+
+	id, err := svc.ProcessReceipt(context.Background(), receipt("2024-02-20"))
+	assert.NoError(t, err)
+	record, err := svc.GetReceipt(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, svc.now(), record.SubmittedAt)
+
+	_, err = svc.ProcessReceipt(context.Background(), receipt("2024-01-20"))
+	var validationErr *model.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, CodePurchaseTooOld, validationErr.Code)
+
+	_, err = svc.ProcessReceipt(context.Background(), receipt("2024-03-05"))
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, CodePurchaseInFuture, validationErr.Code)
+
+	if assert.Len(t, rejected, 2) {
+		assert.Equal(t, CodePurchaseTooOld, rejected[0].Code)
+		assert.Equal(t, CodePurchaseInFuture, rejected[1].Code)
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Stored values start with an encoding version byte, so records written by different releases can coexist in
+// one bucket and are only rewritten when they next change. Version 1 is the protobuf wire format, written
+// directly with protowire so no generated code is needed. Values written before versioning have no version
+// byte: points were decimal text and receipts were JSON. Neither starts with a byte below 0x20, which is
+// what tells them apart from versioned values.
+const (
+	encodingV1 = 0x01
+	// legacyLimit is the lowest byte a legacy value can start with.
+	legacyLimit = 0x20
+)
+
+// ErrUnknownEncoding is returned for a stored value written by a newer release with an encoding this one cannot read.
+var ErrUnknownEncoding = errors.New("unknown record encoding")
+
+// Field numbers of a version 1 receipt record. Never reuse a number.
+const (
+	fieldID protowire.Number = iota + 1
+	fieldRetailer
+	fieldPurchaseDate
+	fieldPurchaseTime
+	fieldTotal
+	fieldItem
+	fieldPoints
+	fieldSubmittedBy
+	fieldAccount
+	fieldTenant
+	fieldSubmittedAt
+	fieldAnonymized
+	fieldStatus
+	fieldReviewFlag
+	fieldStatusChange
+	fieldRiskScore
+	fieldRiskFeature
+	fieldPurchaseTimezone
+)
+
+// Field numbers of an item inside a version 1 receipt record.
+const (
+	fieldItemDescription protowire.Number = iota + 1
+	fieldItemPrice
+)
+
+// Field numbers of a status change inside a version 1 receipt record.
+const (
+	fieldChangeStatus protowire.Number = iota + 1
+	fieldChangeAt
+	fieldChangeBy
+	fieldChangeReason
+)
+
+// encodePoints encodes points as a version byte followed by a zigzag varint.
+func encodePoints(points int) []byte {
+	return protowire.AppendVarint([]byte{encodingV1}, protowire.EncodeZigZag(int64(points)))
+}
+
+// DecodePoints decodes a value of a points bucket in any encoding.
+func DecodePoints(data []byte) (int, error) {
+	if len(data) == 0 || data[0] >= legacyLimit {
+		return strconv.Atoi(string(data))
+	}
+	if data[0] != encodingV1 {
+		return 0, fmt.Errorf("%w %d", ErrUnknownEncoding, data[0])
+	}
+	v, n := protowire.ConsumeVarint(data[1:])
+	if n < 0 || n != len(data)-1 {
+		return 0, fmt.Errorf("invalid points value: %w", protowire.ParseError(n))
+	}
+	return int(protowire.DecodeZigZag(v)), nil
+}
+
+// encodeReceipt encodes record as a version byte followed by its protobuf wire fields. Empty fields are left out.
+func encodeReceipt(record *StoredReceipt) []byte {
+	b := make([]byte, 1, 128+32*len(record.Receipt.Items))
+	b[0] = encodingV1
+	appendString := func(b []byte, num protowire.Number, s string) []byte {
+		if s == "" {
+			return b
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, s)
+	}
+	b = appendString(b, fieldID, record.ID)
+	b = appendString(b, fieldRetailer, record.Receipt.Retailer)
+	b = appendString(b, fieldPurchaseDate, record.Receipt.PurchaseDate)
+	b = appendString(b, fieldPurchaseTime, record.Receipt.PurchaseTime)
+	b = appendString(b, fieldPurchaseTimezone, record.Receipt.PurchaseTimezone)
+	b = appendString(b, fieldTotal, record.Receipt.Total)
+	for _, item := range record.Receipt.Items {
+		var ib []byte
+		ib = appendString(ib, fieldItemDescription, item.ShortDescription)
+		ib = appendString(ib, fieldItemPrice, item.Price)
+		b = protowire.AppendTag(b, fieldItem, protowire.BytesType)
+		b = protowire.AppendBytes(b, ib)
+	}
+	if record.Points != 0 {
+		b = protowire.AppendTag(b, fieldPoints, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(record.Points)))
+	}
+	b = appendString(b, fieldSubmittedBy, record.SubmittedBy)
+	b = appendString(b, fieldAccount, record.Account)
+	b = appendString(b, fieldTenant, record.Tenant)
+	if !record.SubmittedAt.IsZero() {
+		b = protowire.AppendTag(b, fieldSubmittedAt, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(record.SubmittedAt.UnixNano()))
+	}
+	if record.Anonymized {
+		b = protowire.AppendTag(b, fieldAnonymized, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	b = appendString(b, fieldStatus, record.Status)
+	for _, flag := range record.ReviewFlags {
+		b = protowire.AppendTag(b, fieldReviewFlag, protowire.BytesType)
+		b = protowire.AppendString(b, flag)
+	}
+	if record.RiskScore != 0 {
+		b = protowire.AppendTag(b, fieldRiskScore, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(record.RiskScore)))
+	}
+	for _, feature := range record.RiskFeatures {
+		b = protowire.AppendTag(b, fieldRiskFeature, protowire.BytesType)
+		b = protowire.AppendString(b, feature)
+	}
+	for _, change := range record.StatusHistory {
+		var cb []byte
+		cb = appendString(cb, fieldChangeStatus, change.Status)
+		cb = protowire.AppendTag(cb, fieldChangeAt, protowire.VarintType)
+		cb = protowire.AppendVarint(cb, protowire.EncodeZigZag(change.At.UnixNano()))
+		cb = appendString(cb, fieldChangeBy, change.By)
+		cb = appendString(cb, fieldChangeReason, change.Reason)
+		b = protowire.AppendTag(b, fieldStatusChange, protowire.BytesType)
+		b = protowire.AppendBytes(b, cb)
+	}
+	return b
+}
+
+// decodeReceipt decodes a value of a receipts bucket in any encoding into record.
+func decodeReceipt(data []byte, record *StoredReceipt) error {
+	if len(data) == 0 || data[0] >= legacyLimit {
+		return json.Unmarshal(data, record)
+	}
+	if data[0] != encodingV1 {
+		return fmt.Errorf("%w %d", ErrUnknownEncoding, data[0])
+	}
+	*record = StoredReceipt{}
+	return consumeFields(data[1:], func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error {
+		switch {
+		case num == fieldID && typ == protowire.BytesType:
+			record.ID = string(value)
+		case num == fieldRetailer && typ == protowire.BytesType:
+			record.Receipt.Retailer = string(value)
+		case num == fieldPurchaseDate && typ == protowire.BytesType:
+			record.Receipt.PurchaseDate = string(value)
+		case num == fieldPurchaseTime && typ == protowire.BytesType:
+			record.Receipt.PurchaseTime = string(value)
+		case num == fieldPurchaseTimezone && typ == protowire.BytesType:
+			record.Receipt.PurchaseTimezone = string(value)
+		case num == fieldTotal && typ == protowire.BytesType:
+			record.Receipt.Total = string(value)
+		case num == fieldItem && typ == protowire.BytesType:
+			var item model.Item
+			err := consumeFields(value, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+				switch {
+				case num == fieldItemDescription && typ == protowire.BytesType:
+					item.ShortDescription = string(value)
+				case num == fieldItemPrice && typ == protowire.BytesType:
+					item.Price = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			record.Receipt.Items = append(record.Receipt.Items, item)
+		case num == fieldPoints && typ == protowire.VarintType:
+			record.Points = int(protowire.DecodeZigZag(v))
+		case num == fieldSubmittedBy && typ == protowire.BytesType:
+			record.SubmittedBy = string(value)
+		case num == fieldAccount && typ == protowire.BytesType:
+			record.Account = string(value)
+		case num == fieldTenant && typ == protowire.BytesType:
+			record.Tenant = string(value)
+		case num == fieldSubmittedAt && typ == protowire.VarintType:
+			record.SubmittedAt = time.Unix(0, protowire.DecodeZigZag(v)).UTC()
+		case num == fieldAnonymized && typ == protowire.VarintType:
+			record.Anonymized = v != 0
+		case num == fieldStatus && typ == protowire.BytesType:
+			record.Status = string(value)
+		case num == fieldReviewFlag && typ == protowire.BytesType:
+			record.ReviewFlags = append(record.ReviewFlags, string(value))
+		case num == fieldRiskScore && typ == protowire.VarintType:
+			record.RiskScore = int(protowire.DecodeZigZag(v))
+		case num == fieldRiskFeature && typ == protowire.BytesType:
+			record.RiskFeatures = append(record.RiskFeatures, string(value))
+		case num == fieldStatusChange && typ == protowire.BytesType:
+			var change StatusChange
+			err := consumeFields(value, func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error {
+				switch {
+				case num == fieldChangeStatus && typ == protowire.BytesType:
+					change.Status = string(value)
+				case num == fieldChangeAt && typ == protowire.VarintType:
+					change.At = time.Unix(0, protowire.DecodeZigZag(v)).UTC()
+				case num == fieldChangeBy && typ == protowire.BytesType:
+					change.By = string(value)
+				case num == fieldChangeReason && typ == protowire.BytesType:
+					change.Reason = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			record.StatusHistory = append(record.StatusHistory, change)
+		}
+		// fields this release does not know were added by a newer one and are skipped
+		return nil
+	})
+}
+
+// consumeFields calls fn with every field in b. Length-delimited fields are passed as value and varint fields as v.
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("invalid record: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var value []byte
+		var v uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid record field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		if err := fn(num, typ, value, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
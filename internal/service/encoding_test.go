@@ -0,0 +1,242 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func testRecord() *StoredReceipt {
+	return &StoredReceipt{
+		ID: "7fb1377b-b223-49d9-a31a-5a02701dd310",
+		Receipt: model.Receipt{
+			Retailer:         "M&M Corner Market",
+			PurchaseDate:     "2022-03-20",
+			PurchaseTime:     "14:33",
+			PurchaseTimezone: "America/Chicago",
+			Items: []model.Item{
+				{ShortDescription: "Gatorade", Price: "2.25"},
+				{ShortDescription: "Gatorade", Price: "2.25"},
+				{ShortDescription: "Gatorade", Price: "2.25"},
+				{ShortDescription: "Gatorade", Price: "2.25"},
+			},
+			Total: "9.00",
+		},
+		Points:      109,
+		SubmittedBy: "a2c1d7a4-6f0b-4a5e-9a57-0c0f3d3b8e11",
+		Account:     "alice",
+		Tenant:      DefaultTenant,
+		SubmittedAt: time.Date(2022, 3, 20, 14, 35, 12, 123456789, time.UTC),
+		Status:      StatusApproved,
+		StatusHistory: []StatusChange{
+			{Status: StatusPending, At: time.Date(2022, 3, 20, 14, 35, 12, 123456789, time.UTC)},
+			{Status: StatusScored, At: time.Date(2022, 3, 20, 14, 35, 12, 123456789, time.UTC)},
+			{Status: StatusUnderReview, At: time.Date(2022, 3, 20, 14, 35, 12, 123456789, time.UTC), Reason: FlagDuplicate},
+			{Status: StatusApproved, At: time.Date(2022, 3, 21, 9, 0, 0, 0, time.UTC), By: "reviewer", Reason: "second visit"},
+		},
+		ReviewFlags:  []string{FlagDuplicate},
+		RiskScore:    40,
+		RiskFeatures: []string{FeatureRoundTotals},
+	}
+}
+
+func TestReceiptEncoding(t *testing.T) {
+	record := testRecord()
+
+	t.Run("round trip", func(t *testing.T) {
+		data := encodeReceipt(record)
+		assert.Equal(t, byte(encodingV1), data[0])
+		var got StoredReceipt
+		assert.NoError(t, decodeReceipt(data, &got))
+		assert.Equal(t, *record, got)
+
+		anonymized := *record
+		anonymized.Points = -5
+		anonymized.Anonymized = true
+		assert.NoError(t, decodeReceipt(encodeReceipt(&anonymized), &got))
+		assert.Equal(t, anonymized, got)
+	})
+
+	t.Run("legacy json", func(t *testing.T) {
+		data, err := json.Marshal(record)
+		assert.NoError(t, err)
+		var got StoredReceipt
+		assert.NoError(t, decodeReceipt(data, &got))
+		assert.Equal(t, *record, got)
+	})
+
+	t.Run("unknown fields are skipped", func(t *testing.T) {
+		data := encodeReceipt(record)
+		data = protowire.AppendTag(data, 99, protowire.BytesType)
+		data = protowire.AppendString(data, "from a newer release")
+		data = protowire.AppendTag(data, 100, protowire.Fixed64Type)
+		data = protowire.AppendFixed64(data, 42)
+		var got StoredReceipt
+		assert.NoError(t, decodeReceipt(data, &got))
+		assert.Equal(t, *record, got)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var got StoredReceipt
+		assert.ErrorIs(t, decodeReceipt([]byte{0x02, 0x0a, 0x00}, &got), ErrUnknownEncoding)
+		assert.Error(t, decodeReceipt(encodeReceipt(record)[:20], &got))
+	})
+}
+
+func TestPointsEncoding(t *testing.T) {
+	for _, points := range []int{0, 1, 28, 109, 1 << 40, -3} {
+		got, err := DecodePoints(encodePoints(points))
+		assert.NoError(t, err)
+		assert.Equal(t, points, got)
+	}
+
+	got, err := DecodePoints([]byte("28"))
+	assert.NoError(t, err)
+	assert.Equal(t, 28, got)
+
+	_, err = DecodePoints([]byte("lots"))
+	assert.Error(t, err)
+	_, err = DecodePoints([]byte{0x07, 0x38})
+	assert.ErrorIs(t, err, ErrUnknownEncoding)
+	_, err = DecodePoints(append(encodePoints(28), 0x00))
+	assert.Error(t, err)
+}
+
+// encodings compares the JSON and decimal text values stored before versioning with version 1.
+var encodings = []struct {
+	name          string
+	encodeReceipt func(*StoredReceipt) []byte
+	encodePoints  func(int) []byte
+}{
+	{"json", func(r *StoredReceipt) []byte { data, _ := json.Marshal(r); return data }, func(p int) []byte { return []byte(fmt.Sprint(p)) }},
+	{"binary", encodeReceipt, encodePoints},
+}
+
+func BenchmarkEncodeReceipt(b *testing.B) {
+	record := testRecord()
+	for _, enc := range encodings {
+		b.Run(enc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				size = len(enc.encodeReceipt(record))
+			}
+			b.ReportMetric(float64(size), "bytes/record")
+		})
+	}
+}
+
+func BenchmarkDecodeReceipt(b *testing.B) {
+	record := testRecord()
+	for _, enc := range encodings {
+		b.Run(enc.name, func(b *testing.B) {
+			data := enc.encodeReceipt(record)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var got StoredReceipt
+				if err := decodeReceipt(data, &got); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkStore writes receipts and their points to bbolt, 1000 per transaction, and reports the resulting
+// database file size per receipt.
+func BenchmarkStore(b *testing.B) {
+	for _, enc := range encodings {
+		b.Run(enc.name, func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "bench.db")
+			db, err := bolt.Open(path, 0600, &bolt.Options{NoSync: true})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			record := testRecord()
+			b.ResetTimer()
+			for i := 0; i < b.N; i += 1000 {
+				err := db.Update(func(tx *bolt.Tx) error {
+					receipts, _ := tx.CreateBucketIfNotExists([]byte("receipts"))
+					points, _ := tx.CreateBucketIfNotExists([]byte("points"))
+					for j := i; j < i+1000 && j < b.N; j++ {
+						record.ID = fmt.Sprintf("%036d", j)
+						if err := receipts.Put([]byte(record.ID), enc.encodeReceipt(record)); err != nil {
+							return err
+						}
+						if err := points.Put([]byte(record.ID), enc.encodePoints(record.Points)); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			var size int64
+			db.View(func(tx *bolt.Tx) error {
+				size = tx.Size()
+				return nil
+			})
+			if info, err := os.Stat(path); err == nil && info.Size() > size {
+				size = info.Size()
+			}
+			b.ReportMetric(float64(size)/float64(b.N), "file-bytes/record")
+		})
+	}
+}
+
+// BenchmarkRead reads receipts and their points back from bbolt, as GetReceipt and GetPoints do.
+func BenchmarkRead(b *testing.B) {
+	const n = 10000
+	for _, enc := range encodings {
+		b.Run(enc.name, func(b *testing.B) {
+			db, err := bolt.Open(filepath.Join(b.TempDir(), "bench.db"), 0600, &bolt.Options{NoSync: true})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			record := testRecord()
+			err = db.Update(func(tx *bolt.Tx) error {
+				receipts, _ := tx.CreateBucket([]byte("receipts"))
+				points, _ := tx.CreateBucket([]byte("points"))
+				for j := 0; j < n; j++ {
+					record.ID = fmt.Sprintf("%036d", j)
+					receipts.Put([]byte(record.ID), enc.encodeReceipt(record))
+					points.Put([]byte(record.ID), enc.encodePoints(record.Points))
+				}
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := []byte(fmt.Sprintf("%036d", i%n))
+				err := db.View(func(tx *bolt.Tx) error {
+					var got StoredReceipt
+					if err := decodeReceipt(tx.Bucket([]byte("receipts")).Get(id), &got); err != nil {
+						return err
+					}
+					_, err := DecodePoints(tx.Bucket([]byte("points")).Get(id))
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
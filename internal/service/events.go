@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Event types published by ReceiptService.
+const (
+	EventReceiptScored   = "receipt.scored"
+	EventReceiptRejected = "receipt.rejected"
+	EventPointsAdjusted  = "points.adjusted"
+	EventReceiptDeleted  = "receipt.deleted"
+	// EventReceiptFlagged is a receipt sent for review; EventReceiptDecided is a decision on a receipt.
+	EventReceiptFlagged = "receipt.flagged"
+	EventReceiptDecided = "receipt.decided"
+)
+
+// Event describes a change to a receipt. Subscribers receive events after the change has been stored, and
+// SubscribeTx subscribers while it is being stored.
+// Rejected receipts carry the validation error and, when known, the field that failed and the error code. Status is the
+// receipt's status after the change, and Flags the review checks it failed. Account is the end user the receipt
+// belongs to, when it has one.
+type Event struct {
+	Type      string    `json:"type"`
+	Tenant    string    `json:"tenant,omitempty"`
+	ReceiptID string    `json:"receiptId,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Retailer  string    `json:"retailer,omitempty"`
+	Points    int       `json:"points"`
+	Rules     []RuleHit `json:"rules,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Field     string    `json:"field,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Flags     []string  `json:"flags,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// eventBus fans events out to subscribers synchronously, in subscription order.
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers []func(Event)
+	recorders   []func(*bolt.Tx, Event) error
+}
+
+// Subscribe registers fn to be called with every event the service publishes.
+// fn runs on the publishing goroutine, so it should hand off any slow work.
+func (s *ReceiptService) Subscribe(fn func(Event)) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	s.events.subscribers = append(s.events.subscribers, fn)
+}
+
+// SubscribeTx registers fn to store a record of every event the service publishes in tx, the transaction
+// that stores the change the event describes, so the record is committed if and only if the change is. Events
+// that change nothing, such as rejected receipts, are recorded in a transaction of their own. An error from fn
+// fails the change. fn runs before the event's Subscribe subscribers, which can tell others about the record.
+func (s *ReceiptService) SubscribeTx(fn func(tx *bolt.Tx, event Event) error) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	s.events.recorders = append(s.events.recorders, fn)
+}
+
+// recordEvents stamps events with the current time, if they have none, and runs the SubscribeTx subscribers
+// for them in tx. Changes may be retried, so it must be called again with the same events if they are.
+func (s *ReceiptService) recordEvents(tx *bolt.Tx, events ...*Event) error {
+	now := time.Now().UTC()
+	s.events.mu.RLock()
+	defer s.events.mu.RUnlock()
+	for _, event := range events {
+		if event.Time.IsZero() {
+			event.Time = now
+		}
+		for _, fn := range s.events.recorders {
+			if err := fn(tx, *event); err != nil {
+				return fmt.Errorf("record %s event: %w", event.Type, err)
+			}
+		}
+	}
+	return nil
+}
+
+// publishUnstored records event, which comes with no change to store, in a batched transaction of its own and
+// publishes it. Failing to record it is only logged, as there is no change to fail.
+func (s *ReceiptService) publishUnstored(event Event) {
+	s.events.mu.RLock()
+	recorded := len(s.events.recorders) > 0
+	s.events.mu.RUnlock()
+	if recorded {
+		if err := s.Writes.Update(func(tx *bolt.Tx) error { return s.recordEvents(tx, &event) }); err != nil {
+			log.Println(err)
+		}
+	}
+	s.publish(event)
+}
+
+func (s *ReceiptService) publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	s.events.mu.RLock()
+	defer s.events.mu.RUnlock()
+	for _, fn := range s.events.subscribers {
+		fn(event)
+	}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// ErrInvalidFilter is returned when a receipt filter has a malformed date.
+	ErrInvalidFilter = errors.New("invalid filter")
+	// ErrInvalidImport is returned when a record of an import cannot be decoded.
+	ErrInvalidImport = errors.New("invalid import")
+)
+
+// ReceiptFilter selects receipts by purchase date and retailer. Empty fields match every receipt.
+type ReceiptFilter struct {
+	// From and To bound the purchase date, inclusive, as YYYY-MM-DD.
+	From string
+	To   string
+	// Retailer matches the retailer name, ignoring case.
+	Retailer string
+}
+
+// Validate checks that the filter's dates are well formed.
+func (f ReceiptFilter) Validate() error {
+	for _, date := range []string{f.From, f.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("%w: date %q is not YYYY-MM-DD", ErrInvalidFilter, date)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the filter selects record.
+func (f ReceiptFilter) Match(record *StoredReceipt) bool {
+	date := record.Receipt.PurchaseDate
+	// dates in YYYY-MM-DD order the same as strings
+	if f.From != "" && date < f.From {
+		return false
+	}
+	if f.To != "" && date > f.To {
+		return false
+	}
+	return f.Retailer == "" || strings.EqualFold(record.Receipt.Retailer, f.Retailer)
+}
+
+// eachReceiptPageSize is the most receipts EachReceipt reads in one read transaction. It is a variable so
+// tests can use small pages.
+var eachReceiptPageSize = 500
+
+// EachReceipt calls fn with every receipt of the tenant in ctx that filter selects, in id order, with its
+// computed Points and its Adjustments. The receipts are read a page at a time, each in its own short read
+// transaction that is closed before fn is called, so a slow fn, such as a client reading an export, does not
+// keep old pages of the database from being reused. Receipts stored or deleted during the iteration may or
+// may not be seen. Iteration stops at the first error fn returns.
+func (s *ReceiptService) EachReceipt(ctx context.Context, filter ReceiptFilter, fn func(*StoredReceipt) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	tenant := tenantFrom(ctx)
+	if _, err := s.Tenant(tenant); err != nil {
+		return err
+	}
+	// after is the last key read, so the next page starts past it
+	var after []byte
+	for done := false; !done; {
+		page := make([]*StoredReceipt, 0, eachReceiptPageSize)
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			bucket := tenantBucket(tx, tenant, "receipts")
+			if bucket == nil {
+				done = true
+				return nil
+			}
+			c := bucket.Cursor()
+			k, v := c.First()
+			if after != nil {
+				if k, v = c.Seek(after); bytes.Equal(k, after) {
+					k, v = c.Next()
+				}
+			}
+			for n := 0; k != nil && n < eachReceiptPageSize; k, v = c.Next() {
+				n++
+				// k is only valid during the transaction
+				after = append(after[:0], k...)
+				var record StoredReceipt
+				if err := decodeReceipt(v, &record); err != nil {
+					return err
+				}
+				if !filter.Match(&record) {
+					continue
+				}
+				history, err := pointsHistory(tx, tenant, record.ID)
+				if err != nil && !errors.Is(err, ErrIdNotFound) {
+					return err
+				}
+				if history != nil {
+					record.Points, record.Adjustments = history.ComputedPoints, history.Adjustments
+				}
+				page = append(page, &record)
+			}
+			done = k == nil
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range page {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// importBatchSize is the number of receipts written per transaction on import.
+const importBatchSize = 500
+
+// maxImportErrors bounds the rejected records listed in an ImportResult.
+const maxImportErrors = 100
+
+// ImportResult summarizes an import.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	// Skipped counts records whose id is already stored.
+	Skipped int `json:"skipped"`
+	// Rejected counts records that failed validation. Errors lists the first of them.
+	Rejected int           `json:"rejected"`
+	Errors   []ImportError `json:"errors,omitempty"`
+}
+
+// ImportError describes a record that was not imported.
+type ImportError struct {
+	// Record is the 1-based position of the record in the import.
+	Record int    `json:"record"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ImportReceipts stores the receipts returned by next, until it returns io.EOF, in the tenant of the
+// principal in ctx. Every receipt is validated again; invalid ones are reported in the result and the
+// rest are still imported. Records keep their id, and are skipped if that id is already stored, so an
+// import can safely be repeated. Records without an id get a new one. With rescore, points are
+// calculated with the tenant's current rules; otherwise the imported points are kept. Either way the
+// record's Adjustments are stored with it, so its points include them as they did when it was exported.
+// A record that cannot be decoded stops the import with ErrInvalidImport; the batches before it have
+// already been stored. Imported receipts are not published as events, so webhooks do not fire for them again.
+func (s *ReceiptService) ImportReceipts(ctx context.Context, next func() (*StoredReceipt, error), rescore bool) (ImportResult, error) {
+	var result ImportResult
+	tenant, err := s.Tenant(tenantFrom(ctx))
+	if err != nil {
+		return result, err
+	}
+	// adjustments without an actor, such as those of a CSV import, are attributed to the importer
+	var actor string
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		actor = p.ID
+	}
+	reject := func(n int, id string, err error) {
+		result.Rejected++
+		if len(result.Errors) < maxImportErrors {
+			result.Errors = append(result.Errors, ImportError{Record: n, ID: id, Error: err.Error()})
+		}
+	}
+
+	var batch []*StoredReceipt
+	for n := 1; ; n++ {
+		record, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("%w: record %d: %w", ErrInvalidImport, n, err)
+		}
+		if record.ID == "" {
+			record.ID = uuid.New().String()
+		} else if _, err := uuid.Parse(record.ID); err != nil {
+			reject(n, record.ID, ErrInvalidId)
+			continue
+		}
+		if err := s.validate(&record.Receipt); err != nil {
+			reject(n, record.ID, err)
+			continue
+		}
+		if rescore {
+			record.Points, _ = ScoreReceipt(&record.Receipt, tenant.RuleSet())
+		}
+		if record.AdjustedPoints() < 0 {
+			reject(n, record.ID, errors.New("points must not be negative"))
+			continue
+		}
+		if record.Status != "" && !slices.Contains(statuses, record.Status) {
+			reject(n, record.ID, fmt.Errorf("unknown status %q", record.Status))
+			continue
+		}
+		record.Tenant = tenant.ID
+		if record.SubmittedAt.IsZero() {
+			record.SubmittedAt = time.Now().UTC()
+		}
+		for i := range record.Adjustments {
+			adjustment := &record.Adjustments[i]
+			adjustment.ReceiptID = record.ID
+			if adjustment.Actor == "" {
+				adjustment.Actor = actor
+			}
+			if adjustment.CreatedAt.IsZero() {
+				adjustment.CreatedAt = record.SubmittedAt
+			}
+		}
+
+		batch = append(batch, record)
+		if len(batch) == importBatchSize {
+			if err := s.importBatch(ctx, batch, &result); err != nil {
+				return result, err
+			}
+			batch = batch[:0]
+		}
+	}
+	return result, s.importBatch(ctx, batch, &result)
+}
+
+// importBatch stores records in one transaction, skipping ids that are already stored, and records each
+// imported receipt in the audit log.
+func (s *ReceiptService) importBatch(ctx context.Context, records []*StoredReceipt, result *ImportResult) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var imported, skipped int
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		receipts, err := createTenantBucket(tx, records[0].Tenant, "receipts")
+		if err != nil {
+			return err
+		}
+		points, err := createTenantBucket(tx, records[0].Tenant, "points")
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if receipts.Get([]byte(record.ID)) != nil {
+				skipped++
+				continue
+			}
+			data := encodeReceipt(record)
+			if err := receipts.Put([]byte(record.ID), data); err != nil {
+				return err
+			}
+			if err := points.Put([]byte(record.ID), encodePoints(record.Points)); err != nil {
+				return err
+			}
+			for i := range record.Adjustments {
+				data, err := json.Marshal(&record.Adjustments[i])
+				if err != nil {
+					return err
+				}
+				if err := putAdjustment(tx, record.Tenant, record.ID, data); err != nil {
+					return err
+				}
+			}
+			if err := updateBalance(tx, record.Tenant, record.Account, share{}, shareOf(record.CurrentStatus(), record.AdjustedPoints())); err != nil {
+				return err
+			}
+			fingerprints, err := createTenantBucket(tx, record.Tenant, "fingerprints")
+			if err != nil {
+				return err
+			}
+			if fp := fingerprint(&record.Receipt); fingerprints.Get(fp) == nil {
+				if err := fingerprints.Put(fp, []byte(record.ID)); err != nil {
+					return err
+				}
+			}
+			entry := auditEntry(ctx, audit.ActionReceiptImported, record.Tenant, record.ID)
+			entry.After = audit.Hash(data)
+			if err := audit.Append(tx, entry); err != nil {
+				return err
+			}
+			imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	result.Imported += imported
+	result.Skipped += skipped
+	return nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestEachReceipt(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	defer func(size int) { eachReceiptPageSize = size }(eachReceiptPageSize)
+	eachReceiptPageSize = 2
+
+	var walgreens []string
+	for i, retailer := range []string{"Target", "Walgreens", "Target", "Walgreens", "Walgreens"} {
+		receipt := &model.Receipt{Retailer: retailer, PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+			Items: []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, Total: "6.49"}
+		id, err := svc.ProcessReceipt(context.Background(), receipt)
+		assert.NoError(t, err, i)
+		if retailer == "Walgreens" {
+			walgreens = append(walgreens, id)
+		}
+	}
+
+	t.Run("every page is read, in id order", func(t *testing.T) {
+		var ids []string
+		err := svc.EachReceipt(context.Background(), ReceiptFilter{}, func(r *StoredReceipt) error {
+			ids = append(ids, r.ID)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, ids, 5)
+		assert.IsIncreasing(t, ids)
+	})
+
+	t.Run("pages are filtered", func(t *testing.T) {
+		var ids []string
+		err := svc.EachReceipt(context.Background(), ReceiptFilter{Retailer: "walgreens"}, func(r *StoredReceipt) error {
+			ids = append(ids, r.ID)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, walgreens, ids)
+	})
+
+	t.Run("no read transaction is held while fn runs", func(t *testing.T) {
+		var seen int
+		err := svc.EachReceipt(context.Background(), ReceiptFilter{}, func(r *StoredReceipt) error {
+			seen++
+			// growing the database remaps it, which waits for open read transactions
+			return db.Update(func(tx *bolt.Tx) error {
+				bucket, err := tx.CreateBucketIfNotExists([]byte("filler"))
+				if err != nil {
+					return err
+				}
+				return bucket.Put([]byte(r.ID), make([]byte, 4<<20))
+			})
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, seen)
+	})
+}
@@ -1,99 +1,435 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"hash/maphash"
 	"log"
-	"math"
-	"strconv"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 	"unicode"
 
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/cache"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
 	model "github.com/pranathireddyk/receipt-processor/pkg"
 	"github.com/google/uuid"
 	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ErrIdNotFound is an error indicating that the ID was not found in the database.
 var ErrIdNotFound = errors.New("id not found")
 
-// ProcessReceipt processes a receipt, calculates points, and stores the points in the database.
-func ProcessReceipt(receipt *model.Receipt, db *bolt.DB) (string, error) {
-	log.Printf("%+v\n", receipt)
-	points := CalculatePoints(receipt)
-	log.Println(points)
-	id := uuid.New().String()
-	err := db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte("points"))
-		return bucket.Put([]byte(id), []byte(strconv.Itoa(points)))
-	})
-	if err != nil {
-		return id, err
-	}
-	return id, nil
+// ErrInvalidId is an error indicating that the ID is not a uuid.
+var ErrInvalidId = errors.New("id is not a uuid")
+
+// ReceiptService validates, scores and stores receipts. A single instance is
+// shared by every transport so they all see the same store and return the same errors.
+type ReceiptService struct {
+	DB *bolt.DB
+	// Writes group-commits the writes of concurrent submissions.
+	Writes *database.Batcher
+	// MaxItems is the most items a receipt may have. Zero means no limit.
+	MaxItems int
+	// PointsCache, if set, holds recently read and scored points with the account that owns them, keyed by
+	// tenant and receipt id.
+	PointsCache *cache.LRU[string, CachedPoints]
+	// pointsVersions guards PointsCache against storing points that changed while they were read. Each
+	// counter covers the keys hashing to it and is bumped, under cacheMu, whenever their points change.
+	cacheMu        sync.Mutex
+	pointsVersions [pointsVersionStripes]uint64
+	// ReviewPoints is the score above which a receipt is sent for review. Zero disables the check.
+	ReviewPoints int
+	// Dates is the window of purchase dates accepted at submission.
+	Dates DatePolicy
+	// Anomaly, if set, assesses the risk of each submitted receipt. Receipts whose risk score reaches
+	// FlagRisk are sent for review and those reaching BlockRisk are refused. Zero disables either threshold.
+	Anomaly   AnomalyDetector
+	FlagRisk  int
+	BlockRisk int
+	events    eventBus
+	now       func() time.Time
+	// tenantDeleters and receiptErasers are the OnDeleteTenant and OnEraseReceipts functions.
+	hooksMu        sync.RWMutex
+	tenantDeleters []func(*bolt.Tx, string) error
+	receiptErasers []func(*bolt.Tx, string, []string) error
+}
+
+// DefaultMaxItems is the default limit on items per receipt.
+const DefaultMaxItems = 500
+
+// Default size and entry lifetime of the points cache. Points only change through the service, which keeps
+// the cache up to date, as no other process can open the database while the server has it open. The TTL
+// frees the entries of receipts that are no longer read.
+const (
+	DefaultPointsCacheSize = 10000
+	DefaultPointsCacheTTL  = time.Hour
+)
+
+// CachedPoints is a receipt's points as kept in the points cache. Account is the account that owns the
+// receipt, so a hit can be checked against the caller without reading the receipt.
+type CachedPoints struct {
+	Points  int
+	Account string
 }
 
-// Calculate points for a receipt based on the defined rules
-func CalculatePoints(receipt *model.Receipt) int {
-	points := 0
+// StoredReceipt is a processed receipt as kept in the receipts bucket.
+type StoredReceipt struct {
+	ID      string        `json:"id"`
+	Receipt model.Receipt `json:"receipt"`
+	Points  int           `json:"points"`
+	// SubmittedBy is the id of the principal the receipt was submitted by, if any.
+	SubmittedBy string `json:"submittedBy,omitempty"`
+	// Account is the end user that owns the receipt, if it was submitted on behalf of one.
+	Account     string    `json:"account,omitempty"`
+	Tenant      string    `json:"tenant"`
+	SubmittedAt time.Time `json:"submittedAt"`
+	// Anonymized is set once retention has removed the receipt's personal data.
+	Anonymized bool `json:"anonymized,omitempty"`
+	// Status is where the receipt is in its lifecycle, and StatusHistory how it got there. See CurrentStatus.
+	Status        string         `json:"status,omitempty"`
+	StatusHistory []StatusChange `json:"statusHistory,omitempty"`
+	// ReviewFlags are the checks that sent the receipt for review.
+	ReviewFlags []string `json:"reviewFlags,omitempty"`
+	// RiskScore and RiskFeatures are the anomaly detector's assessment of the receipt when it was submitted.
+	RiskScore    int      `json:"riskScore,omitempty"`
+	RiskFeatures []string `json:"riskFeatures,omitempty"`
+	// Adjustments are the manual changes to the receipt's points, oldest first. They are kept apart from the
+	// receipt, in the adjustments bucket, so they are only filled in by EachReceipt and stored by ImportReceipts.
+	Adjustments []Adjustment `json:"adjustments,omitempty"`
+}
 
-	// Rule 1: One point for every alphanumeric character in the retailer name
-	points += countAlphanumericCharacters(receipt.Retailer)
-	log.Printf("Points after Rule 1: %d\n", points)
+// AdjustedPoints returns the receipt's points including its Adjustments.
+func (r *StoredReceipt) AdjustedPoints() int {
+	return adjustedPoints(r.Points, r.Adjustments)
+}
 
-	// Rule 2: 50 points if the total is a round dollar amount with no cents
-	// Rule 3: 25 points if the total is a multiple of 0.25
-	total, err := strconv.ParseFloat(receipt.Total, 64)
+// NewReceiptService creates a ReceiptService backed by db.
+func NewReceiptService(db *bolt.DB) *ReceiptService {
+	return &ReceiptService{
+		DB:           db,
+		Writes:       database.NewBatcher(db),
+		MaxItems:     DefaultMaxItems,
+		PointsCache:  cache.New[string, CachedPoints](DefaultPointsCacheSize, DefaultPointsCacheTTL),
+		ReviewPoints: DefaultReviewPoints,
+		Anomaly:      NewFeatureDetector(),
+		FlagRisk:     DefaultFlagRisk,
+		BlockRisk:    DefaultBlockRisk,
+		Dates:        DatePolicy{MaxAge: DefaultMaxReceiptAge, MaxFutureSkew: DefaultMaxFutureSkew},
+		now:          time.Now,
+	}
+}
+
+// ProcessReceipt validates the receipt, scores it with its tenant's rules and stores its points,
+// returning the new receipt id. The receipt is attributed to the principal in ctx, if there is one.
+// Receipts that fail a review check or look anomalous are stored under review; the rest are approved.
+// Validation failures, including purchase dates outside Dates, are returned as *model.ValidationError, and
+// receipts the anomaly detector blocks as ErrReceiptBlocked.
+func (s *ReceiptService) ProcessReceipt(ctx context.Context, receipt *model.Receipt) (id string, err error) {
+	ctx, span := tracer.Start(ctx, "ReceiptService.ProcessReceipt",
+		trace.WithAttributes(attribute.Int("receipt.item_count", len(receipt.Items))))
+	defer func() { endSpan(span, err) }()
+
+	tenant, err := s.Tenant(tenantFrom(ctx))
+	if err != nil {
+		return "", err
+	}
+	var account string
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		account = p.Account
+	}
+	now := s.now()
+	err = s.validate(receipt)
 	if err == nil {
-		if total == math.Floor(total) {
-			points += 50 // 50 points if the total is a round dollar amount
-		}
-		if math.Mod(total, 0.25) == 0 {
-			points += 25 // 25 points if the total is a multiple of 0.25
+		err = s.Dates.check(receipt, now)
+	}
+	if err != nil {
+		event := Event{Type: EventReceiptRejected, Tenant: tenant.ID, Account: account, Retailer: receipt.Retailer, Error: err.Error()}
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) {
+			event.Field = validationErr.Field
+			event.Code = validationErr.Code
 		}
+		s.publishUnstored(event)
+		return "", err
 	}
-	log.Printf("Points after Rule 2 & 3: %d\n", points)
-
-	// Rule 4: 5 points for every two items on the receipt
-	points += 5 * (len(receipt.Items) / 2)
-	log.Printf("len of items: %d\n", len(receipt.Items))
-	log.Printf("Points after Rule 4: %d\n", points)
-
-	// Rule 5: If the trimmed length of the item description is a multiple of 3, multiply the price by 0.2
-	// and round up to the nearest integer. The result is the number of points earned.
-	for _, item := range receipt.Items {
-		trimmedLength := len(strings.Trim(item.ShortDescription, " "))
-		log.Printf("item trimmed: %s, length: %d\n", strings.Trim(item.ShortDescription, " "), trimmedLength)
-		if trimmedLength%3 == 0 {
-			priceFloat, _ := strconv.ParseFloat(item.Price, 64)
-			points += int(math.Ceil(priceFloat * 0.2))
+
+	_, scoreSpan := tracer.Start(ctx, "CalculatePoints")
+	points, hits := ScoreReceipt(receipt, tenant.RuleSet())
+	scoreSpan.SetAttributes(attribute.Int("receipt.points", points), attribute.Int("receipt.rule_hits", len(hits)))
+	scoreSpan.End()
+
+	record := &StoredReceipt{
+		ID:          uuid.New().String(),
+		Receipt:     *receipt,
+		Points:      points,
+		Tenant:      tenant.ID,
+		SubmittedAt: now.UTC(),
+		ReviewFlags: s.reviewFlags(receipt, points),
+	}
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		record.SubmittedBy = p.ID
+		record.Account = p.Account
+	}
+	err = s.assessRisk(ctx, record)
+	span.SetAttributes(attribute.Int("receipt.risk", record.RiskScore))
+	if err != nil {
+		s.publishUnstored(Event{Type: EventReceiptRejected, Tenant: tenant.ID, Account: account, Retailer: receipt.Retailer, Error: err.Error()})
+		return "", err
+	}
+	span.SetAttributes(attribute.String("receipt.id", record.ID), attribute.Int("receipt.points", points), attribute.String("tenant", tenant.ID))
+	var events []*Event
+	version := s.pointsVersion(tenant.ID, record.ID)
+	err = storeReceipt(ctx, s.Writes.Update, record, func(tx *bolt.Tx) error {
+		// the status is only known once the receipt has been through review
+		events = []*Event{{Type: EventReceiptScored, Tenant: tenant.ID, ReceiptID: record.ID, Account: record.Account, Retailer: receipt.Retailer, Points: points, Rules: hits, Status: record.Status}}
+		if record.Status == StatusUnderReview {
+			events = append(events, &Event{Type: EventReceiptFlagged, Tenant: tenant.ID, ReceiptID: record.ID, Account: record.Account, Retailer: receipt.Retailer, Points: points, Status: record.Status, Flags: record.ReviewFlags})
 		}
+		return s.recordEvents(tx, events...)
+	})
+	if err != nil {
+		return record.ID, err
+	}
+	// clients usually poll for the points right after submitting
+	s.updatePoints(tenant.ID, record.ID, CachedPoints{Points: points, Account: record.Account}, version)
+	for _, event := range events {
+		s.publish(*event)
 	}
-	log.Printf("Points after Rule 5: %d\n", points)
+	return record.ID, nil
+}
 
-	// Rule 6: 6 points if the day in the purchase date is odd
-	if receipt.PurchaseDate != "" {
-		purchaseDate, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
-		purchaseDay := purchaseDate.Day()
-		log.Println(purchaseDay)
-		if purchaseDay%2 != 0 {
-			points += 6
+// validate normalizes the receipt's purchase time and checks its fields and that it is within the service's
+// size limits.
+func (s *ReceiptService) validate(receipt *model.Receipt) error {
+	if s.MaxItems > 0 && len(receipt.Items) > s.MaxItems {
+		return &model.ValidationError{Field: "items", Reason: fmt.Sprintf("must not have more than %d entries", s.MaxItems)}
+	}
+	if err := receipt.Normalize(); err != nil {
+		return err
+	}
+	return receipt.Validate()
+}
+
+// GetPoints returns the points stored for id in the tenant of the principal in ctx, or ErrInvalidId / ErrIdNotFound.
+// Receipts of other tenants are never visible. A principal acting for an account only sees its own receipts unless it has the admin scope;
+// other receipts are reported as not found so their ids cannot be probed.
+func (s *ReceiptService) GetPoints(ctx context.Context, id string) (points int, err error) {
+	ctx, span := tracer.Start(ctx, "ReceiptService.GetPoints", trace.WithAttributes(attribute.String("receipt.id", id)))
+	defer func() {
+		span.SetAttributes(attribute.Int("receipt.points", points))
+		endSpan(span, err)
+	}()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return 0, ErrInvalidId
+	}
+	tenant := tenantFrom(ctx)
+	if s.PointsCache != nil {
+		if cached, ok := s.PointsCache.Get(pointsCacheKey(tenant, id)); ok {
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			if !canSee(ctx, cached.Account) {
+				return 0, ErrIdNotFound
+			}
+			return cached.Points, nil
 		}
 	}
-	log.Printf("Points after Rule 6: %d\n", points)
+	version := s.pointsVersion(tenant, id)
+	cached, err := readPoints(ctx, s.DB, tenant, id)
+	if err != nil {
+		return 0, err
+	}
+	s.cachePoints(tenant, id, cached, version)
+	if !canSee(ctx, cached.Account) {
+		return 0, ErrIdNotFound
+	}
+	return cached.Points, nil
+}
+
+// checkAccount returns ErrIdNotFound if the principal in ctx acts for an account other than the one receipt id
+// was submitted for and does not have the admin scope.
+func (s *ReceiptService) checkAccount(ctx context.Context, id string) error {
+	if canSee(ctx, "") {
+		return nil
+	}
+	record, err := s.GetReceipt(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !canSee(ctx, record.Account) {
+		return ErrIdNotFound
+	}
+	return nil
+}
+
+// canSee reports whether the principal in ctx may see the receipts of account: it is not acting for an
+// account, acts for this one, or has the admin scope.
+func canSee(ctx context.Context, account string) bool {
+	p := auth.PrincipalFrom(ctx)
+	return p == nil || p.Account == "" || p.Account == account || p.HasScope(auth.ScopeAdmin)
+}
+
+// pointsVersionStripes is the number of version counters the points cache keys are spread over.
+const pointsVersionStripes = 256
+
+var pointsVersionSeed = maphash.MakeSeed()
+
+// pointsVersion returns the version of the points of tenant's receipt id. It is read before the points are,
+// and passed to cachePoints or updatePoints with them.
+func (s *ReceiptService) pointsVersion(tenant, id string) uint64 {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	return s.pointsVersions[pointsVersionStripe(tenant, id)]
+}
+
+// cachePoints adds the points of tenant's receipt id, read at version, to the points cache, if there is one.
+// They are not added if a change committed since, as they may predate it.
+func (s *ReceiptService) cachePoints(tenant, id string, points CachedPoints, version uint64) {
+	if s.PointsCache == nil {
+		return
+	}
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if s.pointsVersions[pointsVersionStripe(tenant, id)] == version {
+		s.PointsCache.Add(pointsCacheKey(tenant, id), points)
+	}
+}
+
+// updatePoints records a committed change to the points of tenant's receipt id. The new points are cached
+// if no other change committed since version was read; otherwise it is not known which change is the
+// latest, so the points are dropped from the cache and read again next time.
+func (s *ReceiptService) updatePoints(tenant, id string, points CachedPoints, version uint64) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	stripe := pointsVersionStripe(tenant, id)
+	s.pointsVersions[stripe]++
+	if s.PointsCache == nil {
+		return
+	}
+	if s.pointsVersions[stripe] == version+1 {
+		s.PointsCache.Add(pointsCacheKey(tenant, id), points)
+	} else {
+		s.PointsCache.Remove(pointsCacheKey(tenant, id))
+	}
+}
+
+// uncachePoints records that the points of tenant's receipt id are gone and drops them from the points
+// cache, if there is one.
+func (s *ReceiptService) uncachePoints(tenant, id string) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.pointsVersions[pointsVersionStripe(tenant, id)]++
+	if s.PointsCache != nil {
+		s.PointsCache.Remove(pointsCacheKey(tenant, id))
+	}
+}
+
+// purgePoints empties the points cache, if there is one, and keeps reads already in progress from refilling it.
+func (s *ReceiptService) purgePoints() {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	for i := range s.pointsVersions {
+		s.pointsVersions[i]++
+	}
+	if s.PointsCache != nil {
+		s.PointsCache.Purge()
+	}
+}
+
+func pointsCacheKey(tenant, id string) string {
+	return tenant + "/" + id
+}
+
+func pointsVersionStripe(tenant, id string) uint64 {
+	return maphash.String(pointsVersionSeed, pointsCacheKey(tenant, id)) % pointsVersionStripes
+}
 
-	// Rule 7: 10 points if the time of purchase is after 2:00pm and before 4:00pm
-	if receipt.PurchaseTime != "" {
-		purchaseTime, _ := time.Parse("15:04", receipt.PurchaseTime)
-		log.Printf("%+v\n", purchaseTime)
-		if purchaseTime.After(time.Date(0, 1, 1, 14, 0, 0, 0, time.UTC)) &&
-			purchaseTime.Before(time.Date(0, 1, 1, 16, 0, 0, 0, time.UTC)) {
-			points += 10
+// GetReceipt returns the stored receipt for id in the tenant of the principal in ctx, or ErrInvalidId / ErrIdNotFound.
+func (s *ReceiptService) GetReceipt(ctx context.Context, id string) (*StoredReceipt, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidId
+	}
+	var record StoredReceipt
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		bucket := tenantBucket(tx, tenantFrom(ctx), "receipts")
+		if bucket == nil {
+			return ErrIdNotFound
+		}
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return ErrIdNotFound
 		}
+		return decodeReceipt(data, &record)
+	})
+	if err != nil {
+		return nil, err
 	}
-	log.Printf("Points after Rule 7: %d\n", points)
+	return &record, nil
+}
 
-	return points
+// ProcessReceipt processes a receipt, calculates points, and stores the points in the database.
+func ProcessReceipt(receipt *model.Receipt, db *bolt.DB) (string, error) {
+	log.Printf("%+v\n", receipt)
+	points := CalculatePoints(receipt)
+	log.Println(points)
+	record := &StoredReceipt{ID: uuid.New().String(), Receipt: *receipt, Points: points, Tenant: DefaultTenant, SubmittedAt: time.Now().UTC()}
+	return record.ID, storeReceipt(context.Background(), db.Update, record, nil)
+}
+
+// storeReceipt takes a scored receipt through review, then stores it and its points in its tenant's buckets, adds
+// them to its account's balance and records the submission in the audit log, in a single transaction run by update.
+// If after is not nil, it is called last in the same transaction. The transaction may be retried, so it starts
+// from the receipt as it was passed in each time and only puts values.
+func storeReceipt(ctx context.Context, update func(func(*bolt.Tx) error) error, record *StoredReceipt, after func(*bolt.Tx) error) (err error) {
+	record.Status = StatusPending
+	record.StatusHistory = []StatusChange{{Status: StatusPending, At: record.SubmittedAt}}
+	if err := record.transition(StatusScored, "", "", record.SubmittedAt); err != nil {
+		return err
+	}
+	scored := *record
+	_, span := startBoltSpan(ctx, "Update")
+	defer func() { endSpan(span, err) }()
+	return update(func(tx *bolt.Tx) error {
+		*record = scored
+		record.StatusHistory = slices.Clone(scored.StatusHistory)
+		record.ReviewFlags = slices.Clone(scored.ReviewFlags)
+		if err := review(tx, record, record.SubmittedAt); err != nil {
+			return err
+		}
+		data := encodeReceipt(record)
+		entry := auditEntry(ctx, audit.ActionReceiptSubmitted, record.Tenant, record.ID)
+		entry.Time = record.SubmittedAt
+		entry.After = audit.Hash(data)
+		receipts, err := createTenantBucket(tx, record.Tenant, "receipts")
+		if err != nil {
+			return err
+		}
+		if err := receipts.Put([]byte(record.ID), data); err != nil {
+			return err
+		}
+		bucket, err := createTenantBucket(tx, record.Tenant, "points")
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(record.ID), encodePoints(record.Points)); err != nil {
+			return err
+		}
+		if err := updateBalance(tx, record.Tenant, record.Account, share{}, shareOf(record.Status, record.Points)); err != nil {
+			return err
+		}
+		if err := audit.Append(tx, entry); err != nil {
+			return err
+		}
+		if after == nil {
+			return nil
+		}
+		return after(tx)
+	})
 }
 
 // countAlphanumericCharacters counts the number of alphanumeric characters in a string.
@@ -109,17 +445,30 @@ func countAlphanumericCharacters(s string) int {
 
 // GetPoints retrieves points from the database based on the provided ID.
 func GetPoints(id string, db *bolt.DB) (int, error) {
-	var points int
+	return getPoints(context.Background(), db, DefaultTenant, id)
+}
+
+// getPoints retrieves the points of tenant's receipt id, including any manual adjustments.
+func getPoints(ctx context.Context, db *bolt.DB, tenant, id string) (int, error) {
+	points, err := readPoints(ctx, db, tenant, id)
+	return points.Points, err
+}
+
+// readPoints retrieves the points of tenant's receipt id, including any manual adjustments, and the account
+// that owns it.
+func readPoints(ctx context.Context, db *bolt.DB, tenant, id string) (CachedPoints, error) {
+	_, span := startBoltSpan(ctx, "View")
+	var points CachedPoints
 	err := db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte("points"))
-		data := bucket.Get([]byte(id))
-		if data == nil {
-			return ErrIdNotFound
+		history, err := pointsHistory(tx, tenant, id)
+		if err != nil {
+			return err
 		}
-		var converr error
-		points, converr = strconv.Atoi(string(data))
-		return converr
+		points.Points = history.Points
+		points.Account, _, err = receiptOwner(tx, tenant, id)
+		return err
 	})
+	endSpan(span, err)
 
 	return points, err
 }
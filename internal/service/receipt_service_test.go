@@ -1,8 +1,13 @@
 package service
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
 	model "github.com/pranathireddyk/receipt-processor/pkg"
 	"github.com/stretchr/testify/assert"
 )
@@ -382,3 +387,120 @@ func TestCalculatePoints(t *testing.T) {
 	}
 
 }
+
+func TestValidateRules(t *testing.T) {
+	assert.NoError(t, ValidateRules(DefaultRules))
+	assert.Error(t, ValidateRules(nil))
+	assert.Error(t, ValidateRules([]Rule{{Name: "no_apply"}}))
+	assert.Error(t, ValidateRules([]Rule{DefaultRules[0], DefaultRules[0]}))
+}
+
+func TestPointsCache(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	admin := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "admin", Scopes: []string{auth.ScopeAdmin}})
+	receipt := &model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+		Items: []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, Total: "6.49"}
+	id, err := svc.ProcessReceipt(admin, receipt)
+	assert.NoError(t, err)
+	points, err := svc.GetPoints(admin, id)
+	assert.NoError(t, err)
+
+	t.Run("points read before a change are not cached after it", func(t *testing.T) {
+		svc.PointsCache.Purge()
+		// a read that takes its snapshot, then loses the race with an adjustment
+		version := svc.pointsVersion(DefaultTenant, id)
+		stale, err := readPoints(context.Background(), db, DefaultTenant, id)
+		assert.NoError(t, err)
+		_, adjusted, err := svc.AdjustPoints(admin, id, 5, "goodwill")
+		assert.NoError(t, err)
+		svc.cachePoints(DefaultTenant, id, stale, version)
+
+		got, err := svc.GetPoints(admin, id)
+		assert.NoError(t, err)
+		assert.Equal(t, points+5, adjusted)
+		assert.Equal(t, adjusted, got)
+	})
+
+	t.Run("points read before a deletion are not cached after it", func(t *testing.T) {
+		version := svc.pointsVersion(DefaultTenant, id)
+		stale, err := readPoints(context.Background(), db, DefaultTenant, id)
+		assert.NoError(t, err)
+		assert.NoError(t, svc.DeleteReceipt(admin, id, "erasure request"))
+		svc.cachePoints(DefaultTenant, id, stale, version)
+
+		_, err = svc.GetPoints(admin, id)
+		assert.ErrorIs(t, err, ErrIdNotFound)
+	})
+
+	t.Run("cached points are only served to the owning account", func(t *testing.T) {
+		alice := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "pos", Account: "alice"})
+		bob := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "pos", Account: "bob"})
+		id, err := svc.ProcessReceipt(alice, receipt)
+		assert.NoError(t, err)
+		cached, ok := svc.PointsCache.Get(pointsCacheKey(DefaultTenant, id))
+		assert.True(t, ok)
+		assert.Equal(t, "alice", cached.Account)
+
+		hits := svc.PointsCache.Stats().Hits
+		_, err = svc.GetPoints(bob, id)
+		assert.ErrorIs(t, err, ErrIdNotFound)
+		got, err := svc.GetPoints(alice, id)
+		assert.NoError(t, err)
+		assert.Equal(t, cached.Points, got)
+		assert.Equal(t, hits+2, svc.PointsCache.Stats().Hits)
+
+		svc.PointsCache.Purge()
+		_, err = svc.GetPoints(bob, id)
+		assert.ErrorIs(t, err, ErrIdNotFound)
+		got, err = svc.GetPoints(alice, id)
+		assert.NoError(t, err)
+		assert.Equal(t, cached.Points, got)
+
+		// retention removes the account, so the cached owner is dropped with it
+		_, err = svc.PurgeReceipts(DefaultTenant, time.Now().Add(time.Hour), Retention{Action: RetentionAnonymize})
+		assert.NoError(t, err)
+		_, err = svc.GetPoints(alice, id)
+		assert.ErrorIs(t, err, ErrIdNotFound)
+	})
+}
+
+// BenchmarkProcessReceiptParallel submits receipts from many goroutines at once, as under load, with every
+// receipt committed and synced in its own transaction and with concurrent receipts group-committed.
+func BenchmarkProcessReceiptParallel(b *testing.B) {
+	receipt := &model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	}
+	for _, bench := range []struct {
+		name     string
+		maxSize  int
+		maxDelay time.Duration
+	}{
+		{"unbatched", 1, 0},
+		{"batched", database.DefaultMaxBatchSize, 0},
+		{"batched-2ms", database.DefaultMaxBatchSize, 2 * time.Millisecond},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			db := database.NewBoltDatabase(filepath.Join(b.TempDir(), "receipts.db"))
+			defer db.Close()
+			svc := NewReceiptService(db)
+			svc.Writes.MaxSize = bench.maxSize
+			svc.Writes.MaxDelay = bench.maxDelay
+			b.SetParallelism(64)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := svc.ProcessReceipt(context.Background(), receipt); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "receipts/s")
+		})
+	}
+}
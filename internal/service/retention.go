@@ -0,0 +1,277 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Retention actions applied to receipts that are older than the retention period.
+const (
+	// RetentionDelete removes the receipt. Its entry in the points bucket and the balance of its account are kept,
+	// so point totals do not change.
+	RetentionDelete = "delete"
+	// RetentionAnonymize keeps the receipt with everything that could identify the purchaser removed:
+	// the account, the submitting principal, the purchase time and the item descriptions.
+	RetentionAnonymize = "anonymize"
+)
+
+// RetentionActor is the actor of the audit log entries of receipts changed by retention.
+const RetentionActor = "retention"
+
+// Retention is how long a tenant keeps receipts.
+type Retention struct {
+	// Days is how long receipts are kept after they were submitted. Zero keeps them forever.
+	Days int `json:"days"`
+	// Action is RetentionDelete or RetentionAnonymize. It defaults to RetentionDelete.
+	Action string `json:"action,omitempty"`
+}
+
+// Validate checks that the retention period is not negative and the action is known.
+func (r *Retention) Validate() error {
+	if r.Days < 0 {
+		return fmt.Errorf("%w: retention days must not be negative", ErrInvalidTenant)
+	}
+	if r.Action != "" && r.Action != RetentionDelete && r.Action != RetentionAnonymize {
+		return fmt.Errorf("%w: retention action must be %q or %q", ErrInvalidTenant, RetentionDelete, RetentionAnonymize)
+	}
+	return nil
+}
+
+// Deletion is the audit record of a receipt erased on request. It holds no personal data from the receipt.
+type Deletion struct {
+	ReceiptID string `json:"receiptId"`
+	Tenant    string `json:"tenant"`
+	// DeletedBy is the id of the principal that requested the erasure.
+	DeletedBy string    `json:"deletedBy"`
+	Reason    string    `json:"reason,omitempty"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// purgeBatchSize is the most receipts PurgeReceipts reads in one write transaction, so writers are only held up
+// for a batch at a time. It is a variable so tests can use small batches.
+var purgeBatchSize = 500
+
+// PurgeReceipts applies retention to tenant's receipts submitted before cutoff and returns how many
+// were deleted or anonymized. Receipts that are already anonymized are left alone. Each is recorded in
+// the audit log with the actor RetentionActor, and the OnEraseReceipts functions remove their other copies.
+// The receipts are gone through in batches of their own transactions; if one fails, the batches before it stay
+// applied and the rest are left for the next run.
+func (s *ReceiptService) PurgeReceipts(tenant string, cutoff time.Time, retention Retention) (int, error) {
+	if err := retention.Validate(); err != nil {
+		return 0, err
+	}
+	var purged int
+	// after is the last key read, so the next batch starts past it
+	var after []byte
+	for done := false; !done; {
+		var ids []string
+		err := s.DB.Update(func(tx *bolt.Tx) error {
+			ids = nil
+			bucket := tenantBucket(tx, tenant, "receipts")
+			if bucket == nil {
+				done = true
+				return nil
+			}
+			// bolt does not allow changing a bucket while iterating it, so collect the expired receipts first
+			var expired []*StoredReceipt
+			hashes := map[string]string{}
+			c := bucket.Cursor()
+			k, v := c.First()
+			if after != nil {
+				if k, v = c.Seek(after); bytes.Equal(k, after) {
+					k, v = c.Next()
+				}
+			}
+			last := after
+			for n := 0; k != nil && n < purgeBatchSize; k, v = c.Next() {
+				n++
+				last = append([]byte(nil), k...)
+				var record StoredReceipt
+				if err := decodeReceipt(v, &record); err != nil {
+					return err
+				}
+				if record.SubmittedAt.Before(cutoff) && !record.Anonymized {
+					expired = append(expired, &record)
+					hashes[record.ID] = audit.Hash(v)
+				}
+			}
+			next := k == nil
+			for _, record := range expired {
+				id := record.ID
+				ids = append(ids, id)
+				entry := audit.Entry{Actor: RetentionActor, Action: audit.ActionReceiptExpired, Tenant: tenant, Target: id, Before: hashes[id]}
+				// an identical receipt submitted later is not a duplicate of one that is gone
+				if err := deleteFingerprint(tx, record); err != nil {
+					return err
+				}
+				var err error
+				if retention.Action == RetentionAnonymize {
+					data := encodeReceipt(anonymize(record))
+					entry.After = audit.Hash(data)
+					err = bucket.Put([]byte(id), data)
+				} else {
+					err = bucket.Delete([]byte(id))
+				}
+				if err != nil {
+					return err
+				}
+				if err := audit.Append(tx, entry); err != nil {
+					return err
+				}
+			}
+			if err := s.eraseCopies(tx, tenant, ids); err != nil {
+				return err
+			}
+			after, done = last, next
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += len(ids)
+		// the cached points still name the account the receipts no longer have
+		for _, id := range ids {
+			s.uncachePoints(tenant, id)
+		}
+	}
+	return purged, nil
+}
+
+// OnEraseReceipts registers fn to remove the copies of tenant's receipts ids kept outside the service, such as
+// in the event log and webhook deliveries, in tx, the transaction that erases or anonymizes them. An error from
+// fn fails the change.
+func (s *ReceiptService) OnEraseReceipts(fn func(tx *bolt.Tx, tenant string, ids []string) error) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.receiptErasers = append(s.receiptErasers, fn)
+}
+
+// eraseCopies runs the OnEraseReceipts functions for tenant's receipts ids in tx.
+func (s *ReceiptService) eraseCopies(tx *bolt.Tx, tenant string, ids []string) error {
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	for _, fn := range s.receiptErasers {
+		if err := fn(tx, tenant, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anonymize removes everything from record that could identify the purchaser. The retailer, date,
+// total, prices and points are kept for reporting.
+func anonymize(record *StoredReceipt) *StoredReceipt {
+	record.Account = ""
+	record.SubmittedBy = ""
+	record.Receipt.PurchaseTime = ""
+	for i := range record.Receipt.Items {
+		record.Receipt.Items[i].ShortDescription = ""
+	}
+	record.Anonymized = true
+	return record
+}
+
+// DeleteReceipt erases receipt id, its points and their adjustments from the tenant of the principal in ctx, for a right
+// to erasure request, and records who deleted it in the deletions bucket. The OnEraseReceipts functions remove its
+// other copies in the same transaction. It returns ErrInvalidId or ErrIdNotFound.
+func (s *ReceiptService) DeleteReceipt(ctx context.Context, id, reason string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidId
+	}
+	tenant := tenantFrom(ctx)
+	deletion := Deletion{ReceiptID: id, Tenant: tenant, Reason: reason, DeletedAt: time.Now().UTC()}
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		deletion.DeletedBy = p.ID
+	}
+	data, err := json.Marshal(deletion)
+	if err != nil {
+		return err
+	}
+	var record StoredReceipt
+	var event Event
+	err = s.DB.Update(func(tx *bolt.Tx) error {
+		receipts := tenantBucket(tx, tenant, "receipts")
+		if receipts == nil || receipts.Get([]byte(id)) == nil {
+			return ErrIdNotFound
+		}
+		if err := decodeReceipt(receipts.Get([]byte(id)), &record); err != nil {
+			return err
+		}
+		if err := deleteFingerprint(tx, &record); err != nil {
+			return err
+		}
+		// an erased receipt no longer counts, unlike one removed by retention
+		history, err := pointsHistory(tx, tenant, id)
+		if err != nil {
+			return err
+		}
+		if err := updateBalance(tx, tenant, record.Account, shareOf(record.CurrentStatus(), history.Points), share{}); err != nil {
+			return err
+		}
+		entry := auditEntry(ctx, audit.ActionReceiptDeleted, tenant, id)
+		entry.Time = deletion.DeletedAt
+		entry.Before = audit.Hash(receipts.Get([]byte(id)))
+		if err := audit.Append(tx, entry); err != nil {
+			return err
+		}
+		if err := receipts.Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := tenantBucket(tx, tenant, "points").Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := deleteAdjustments(tx, tenant, id); err != nil {
+			return err
+		}
+		// before the deletion event is recorded, which subscribers need to erase their own copies
+		if err := s.eraseCopies(tx, tenant, []string{id}); err != nil {
+			return err
+		}
+		deletions := tx.Bucket([]byte("deletions"))
+		seq, err := deletions.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := deletions.Put(key, data); err != nil {
+			return err
+		}
+		event = Event{Type: EventReceiptDeleted, Tenant: tenant, ReceiptID: id, Account: record.Account}
+		return s.recordEvents(tx, &event)
+	})
+	if err != nil {
+		return err
+	}
+	s.uncachePoints(tenant, id)
+	s.publish(event)
+	return nil
+}
+
+// Deletions returns the audit records of erased receipts in the tenant of the principal in ctx, oldest first.
+func (s *ReceiptService) Deletions(ctx context.Context) ([]Deletion, error) {
+	tenant := tenantFrom(ctx)
+	deletions := []Deletion{}
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("deletions")).ForEach(func(_, v []byte) error {
+			var deletion Deletion
+			if err := json.Unmarshal(v, &deletion); err != nil {
+				return err
+			}
+			if deletion.Tenant == tenant {
+				deletions = append(deletions, deletion)
+			}
+			return nil
+		})
+	})
+	return deletions, err
+}
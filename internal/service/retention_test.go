@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeReceipts(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	defer func(size int) { purgeBatchSize = size }(purgeBatchSize)
+	purgeBatchSize = 2
+
+	receipt := func(retailer string) *model.Receipt {
+		return &model.Receipt{Retailer: retailer, PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+			Items: []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, Total: "6.49"}
+	}
+	var ids []string
+	for _, retailer := range []string{"Target", "Walgreens", "Costco", "Aldi", "Kroger"} {
+		id, err := svc.ProcessReceipt(context.Background(), receipt(retailer))
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	t.Run("every batch is purged", func(t *testing.T) {
+		n, err := svc.PurgeReceipts(DefaultTenant, time.Now().Add(time.Hour), Retention{Action: RetentionAnonymize})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+		for _, id := range ids {
+			record, err := svc.GetReceipt(context.Background(), id)
+			assert.NoError(t, err)
+			assert.True(t, record.Anonymized)
+		}
+		n, err = svc.PurgeReceipts(DefaultTenant, time.Now().Add(time.Hour), Retention{Action: RetentionAnonymize})
+		assert.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("purged receipts are no longer duplicated", func(t *testing.T) {
+		id, err := svc.ProcessReceipt(context.Background(), receipt("Target"))
+		assert.NoError(t, err)
+		record, err := svc.GetReceipt(context.Background(), id)
+		assert.NoError(t, err)
+		assert.NotContains(t, record.ReviewFlags, FlagDuplicate)
+	})
+}
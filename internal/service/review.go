@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pranathireddyk/receipt-processor/internal/audit"
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Receipt statuses. A receipt starts pending, is scored, and is then approved at once unless a review check
+// flags it, in which case it waits under review for a decision. An approved receipt can later be reversed.
+// Only approved receipts count toward an account's balance.
+const (
+	StatusPending     = "pending"
+	StatusScored      = "scored"
+	StatusUnderReview = "under_review"
+	StatusApproved    = "approved"
+	StatusRejected    = "rejected"
+	StatusReversed    = "reversed"
+)
+
+var statuses = []string{StatusPending, StatusScored, StatusUnderReview, StatusApproved, StatusRejected, StatusReversed}
+
+// transitions lists the statuses each status can move to.
+var transitions = map[string][]string{
+	StatusPending:     {StatusScored},
+	StatusScored:      {StatusUnderReview, StatusApproved},
+	StatusUnderReview: {StatusApproved, StatusRejected},
+	StatusApproved:    {StatusReversed},
+}
+
+// Decisions on a receipt, and the status each one moves it to.
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+	DecisionReverse = "reverse"
+)
+
+var decisionStatus = map[string]string{
+	DecisionApprove: StatusApproved,
+	DecisionReject:  StatusRejected,
+	DecisionReverse: StatusReversed,
+}
+
+// Review flags say why a receipt was sent for review.
+const (
+	// FlagInconsistentTotal is a receipt whose item prices add up to more than its total.
+	FlagInconsistentTotal = "inconsistent_total"
+	// FlagDuplicate is a receipt with the same retailer, date, time, time zone, total and items as one already stored.
+	FlagDuplicate = "duplicate"
+	// FlagOutlierPoints is a receipt scoring more than ReceiptService.ReviewPoints.
+	FlagOutlierPoints = "outlier_points"
+)
+
+// DefaultReviewPoints is the default score above which a receipt is sent for review. No receipt with
+// ordinary items comes close to it.
+const DefaultReviewPoints = 500
+
+var (
+	// ErrInvalidDecision is returned for an unknown decision, or a rejection or reversal without a reason.
+	ErrInvalidDecision = errors.New("invalid decision")
+	// ErrInvalidTransition is returned for a decision the receipt's status does not allow.
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+// StatusChange is one step of a receipt's lifecycle.
+type StatusChange struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+	// By is the id of the principal that decided the change. It is empty for changes made while processing.
+	By     string `json:"by,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Balance is the points of an account's receipts.
+type Balance struct {
+	Account string `json:"account"`
+	// Points are those of approved receipts, including adjustments.
+	Points int `json:"points"`
+	// PendingPoints are those of receipts that are still waiting for a decision.
+	PendingPoints int `json:"pendingPoints"`
+}
+
+// CurrentStatus returns the receipt's status. Receipts stored before statuses existed have none and count as approved.
+func (r *StoredReceipt) CurrentStatus() string {
+	if r.Status == "" {
+		return StatusApproved
+	}
+	return r.Status
+}
+
+// transition moves the receipt to status, recording the change in its history, or returns ErrInvalidTransition.
+func (r *StoredReceipt) transition(status, by, reason string, at time.Time) error {
+	if !slices.Contains(transitions[r.CurrentStatus()], status) {
+		return fmt.Errorf("%w: a receipt that is %s cannot become %s", ErrInvalidTransition, r.CurrentStatus(), status)
+	}
+	r.Status = status
+	r.StatusHistory = append(r.StatusHistory, StatusChange{Status: status, At: at, By: by, Reason: reason})
+	return nil
+}
+
+// reviewFlags runs the checks that do not need the database on a scored receipt.
+func (s *ReceiptService) reviewFlags(receipt *model.Receipt, points int) []string {
+	var flags []string
+	if itemsExceedTotal(receipt) {
+		flags = append(flags, FlagInconsistentTotal)
+	}
+	if s.ReviewPoints > 0 && points > s.ReviewPoints {
+		flags = append(flags, FlagOutlierPoints)
+	}
+	return flags
+}
+
+// itemsExceedTotal reports whether the item prices add up to more than the total. The total may be more,
+// as it includes tax.
+func itemsExceedTotal(receipt *model.Receipt) bool {
+	total, err := cents(receipt.Total)
+	if err != nil {
+		return false
+	}
+	var sum int64
+	for _, item := range receipt.Items {
+		price, err := cents(item.Price)
+		if err != nil {
+			return false
+		}
+		sum += price
+	}
+	return sum > total
+}
+
+// cents converts a decimal amount to cents.
+func cents(amount string) (int64, error) {
+	f, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(f * 100)), nil
+}
+
+// fingerprint identifies a receipt by its contents, so a receipt submitted twice can be recognised.
+func fingerprint(receipt *model.Receipt) []byte {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(strings.ToLower(strings.TrimSpace(s))))
+		h.Write([]byte{0})
+	}
+	write(receipt.Retailer)
+	write(receipt.PurchaseDate)
+	write(receipt.PurchaseTime)
+	if receipt.PurchaseTimezone != "" {
+		// left out when empty so receipts fingerprinted before time zones still match
+		write(receipt.PurchaseTimezone)
+	}
+	write(receipt.Total)
+	for _, item := range receipt.Items {
+		write(item.ShortDescription)
+		write(item.Price)
+	}
+	return h.Sum(nil)
+}
+
+// review finishes processing a scored receipt in tx: it checks whether the receipt duplicates one already
+// stored, records its fingerprint, and moves it under review if it has any flags or approves it otherwise.
+func review(tx *bolt.Tx, record *StoredReceipt, at time.Time) error {
+	fingerprints, err := createTenantBucket(tx, record.Tenant, "fingerprints")
+	if err != nil {
+		return err
+	}
+	fp := fingerprint(&record.Receipt)
+	receipts := tenantBucket(tx, record.Tenant, "receipts")
+	if original := fingerprints.Get(fp); original != nil && receipts != nil && receipts.Get(original) != nil {
+		record.ReviewFlags = append(record.ReviewFlags, FlagDuplicate)
+	} else if err := fingerprints.Put(fp, []byte(record.ID)); err != nil {
+		return err
+	}
+	if len(record.ReviewFlags) > 0 {
+		return record.transition(StatusUnderReview, "", strings.Join(record.ReviewFlags, ", "), at)
+	}
+	return record.transition(StatusApproved, "", "", at)
+}
+
+// deleteFingerprint removes the fingerprint of record if it identifies record rather than an earlier receipt.
+func deleteFingerprint(tx *bolt.Tx, record *StoredReceipt) error {
+	fingerprints := tenantBucket(tx, record.Tenant, "fingerprints")
+	if fingerprints == nil {
+		return nil
+	}
+	fp := fingerprint(&record.Receipt)
+	if string(fingerprints.Get(fp)) != record.ID {
+		return nil
+	}
+	return fingerprints.Delete(fp)
+}
+
+// ReviewQueue returns the receipts under review in the tenant of the principal in ctx, oldest first.
+func (s *ReceiptService) ReviewQueue(ctx context.Context) ([]StoredReceipt, error) {
+	queue := []StoredReceipt{}
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		bucket := tenantBucket(tx, tenantFrom(ctx), "receipts")
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var record StoredReceipt
+			if err := decodeReceipt(v, &record); err != nil {
+				return err
+			}
+			if record.CurrentStatus() == StatusUnderReview {
+				queue = append(queue, record)
+			}
+			return nil
+		})
+	})
+	slices.SortStableFunc(queue, func(a, b StoredReceipt) int { return a.SubmittedAt.Compare(b.SubmittedAt) })
+	return queue, err
+}
+
+// DecideReceipt applies decision to receipt id in the tenant of the principal in ctx and returns the updated
+// receipt. Receipts under review can be approved or rejected, and approved receipts can be reversed; rejecting
+// and reversing need a reason. It returns ErrInvalidId, ErrIdNotFound, ErrInvalidDecision or ErrInvalidTransition.
+func (s *ReceiptService) DecideReceipt(ctx context.Context, id, decision, reason string) (*StoredReceipt, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidId
+	}
+	status, ok := decisionStatus[decision]
+	if !ok {
+		return nil, fmt.Errorf("%w: decision must be %q, %q or %q", ErrInvalidDecision, DecisionApprove, DecisionReject, DecisionReverse)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" && decision != DecisionApprove {
+		return nil, fmt.Errorf("%w: a reason is required to %s a receipt", ErrInvalidDecision, decision)
+	}
+	tenant := tenantFrom(ctx)
+	var by string
+	if p := auth.PrincipalFrom(ctx); p != nil {
+		by = p.ID
+	}
+	var record StoredReceipt
+	var event Event
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		receipts := tenantBucket(tx, tenant, "receipts")
+		if receipts == nil {
+			return ErrIdNotFound
+		}
+		before := receipts.Get([]byte(id))
+		if before == nil {
+			return ErrIdNotFound
+		}
+		if err := decodeReceipt(before, &record); err != nil {
+			return err
+		}
+		entry := auditEntry(ctx, audit.ActionReceiptDecided, tenant, id)
+		entry.Before = audit.Hash(before)
+		from := record.CurrentStatus()
+		if err := record.transition(status, by, reason, time.Now().UTC()); err != nil {
+			return err
+		}
+		history, err := pointsHistory(tx, tenant, id)
+		if err != nil {
+			return err
+		}
+		if err := updateBalance(tx, tenant, record.Account, shareOf(from, history.Points), shareOf(status, history.Points)); err != nil {
+			return err
+		}
+		data := encodeReceipt(&record)
+		entry.After = audit.Hash(data)
+		if err := receipts.Put([]byte(id), data); err != nil {
+			return err
+		}
+		if err := audit.Append(tx, entry); err != nil {
+			return err
+		}
+		event = Event{Type: EventReceiptDecided, Tenant: tenant, ReceiptID: id, Account: record.Account, Retailer: record.Receipt.Retailer, Points: history.Points, Status: status}
+		return s.recordEvents(tx, &event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(event)
+	return &record, nil
+}
+
+// Balance returns the points of account's receipts in the tenant of the principal in ctx. Adjustments count
+// with their receipt.
+func (s *ReceiptService) Balance(ctx context.Context, account string) (Balance, error) {
+	balance := Balance{Account: account}
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		bucket := tenantBucket(tx, tenantFrom(ctx), "balances")
+		if bucket == nil {
+			return nil
+		}
+		if data := bucket.Get([]byte(account)); data != nil {
+			return json.Unmarshal(data, &balance)
+		}
+		return nil
+	})
+	return balance, err
+}
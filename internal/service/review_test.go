@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestReviewFlags(t *testing.T) {
+	svc := &ReceiptService{ReviewPoints: 100}
+	receipt := func(total string, prices ...string) *model.Receipt {
+		r := &model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: total}
+		for _, price := range prices {
+			r.Items = append(r.Items, model.Item{ShortDescription: "item", Price: price})
+		}
+		return r
+	}
+
+	assert.Empty(t, svc.reviewFlags(receipt("10.00", "4.00", "5.00"), 50))
+	assert.Empty(t, svc.reviewFlags(receipt("9.00", "4.50", "4.50"), 50))
+	assert.Equal(t, []string{FlagInconsistentTotal}, svc.reviewFlags(receipt("9.00", "4.50", "4.51"), 50))
+	assert.Equal(t, []string{FlagOutlierPoints}, svc.reviewFlags(receipt("10.00", "4.00"), 101))
+	svc.ReviewPoints = 0
+	assert.Empty(t, svc.reviewFlags(receipt("10.00", "4.00"), 100000))
+}
+
+func TestReviewLifecycle(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "pos", Account: "alice", Scopes: []string{auth.ScopeSubmit, auth.ScopeRead}})
+	reviewer := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "reviewer", Scopes: []string{auth.ScopeAdmin}})
+	receipt := &model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	}
+	var flagged, decided []Event
+	svc.Subscribe(func(event Event) {
+		switch event.Type {
+		case EventReceiptFlagged:
+			flagged = append(flagged, event)
+		case EventReceiptDecided:
+			decided = append(decided, event)
+		}
+	})
+
+	first, err := svc.ProcessReceipt(ctx, receipt)
+	assert.NoError(t, err)
+	record, err := svc.GetReceipt(ctx, first)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusApproved, record.Status)
+	assert.Len(t, record.StatusHistory, 3)
+	points := record.Points
+
+	duplicate, err := svc.ProcessReceipt(ctx, receipt)
+	assert.NoError(t, err)
+	record, err = svc.GetReceipt(ctx, duplicate)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusUnderReview, record.Status)
+	assert.Equal(t, []string{FlagDuplicate}, record.ReviewFlags)
+	assert.Len(t, flagged, 1)
+
+	queue, err := svc.ReviewQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, queue, 1)
+	assert.Equal(t, duplicate, queue[0].ID)
+
+	balance, err := svc.Balance(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, Balance{Account: "alice", Points: points, PendingPoints: points}, balance)
+
+	t.Run("decisions", func(t *testing.T) {
+		_, err := svc.DecideReceipt(reviewer, duplicate, "maybe", "")
+		assert.ErrorIs(t, err, ErrInvalidDecision)
+		_, err = svc.DecideReceipt(reviewer, duplicate, DecisionReject, "")
+		assert.ErrorIs(t, err, ErrInvalidDecision)
+		_, err = svc.DecideReceipt(reviewer, first, DecisionApprove, "")
+		assert.ErrorIs(t, err, ErrInvalidTransition)
+
+		_, _, err = svc.AdjustPoints(reviewer, duplicate, 5, "goodwill")
+		assert.NoError(t, err)
+		record, err := svc.DecideReceipt(reviewer, duplicate, DecisionApprove, "")
+		assert.NoError(t, err)
+		assert.Equal(t, StatusApproved, record.Status)
+		assert.Equal(t, "reviewer", record.StatusHistory[len(record.StatusHistory)-1].By)
+		balance, err := svc.Balance(ctx, "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, 2*points+5, balance.Points)
+		assert.Zero(t, balance.PendingPoints)
+		// the event carries the points the balance moved by, adjustments included
+		if assert.Len(t, decided, 1) {
+			assert.Equal(t, points+5, decided[0].Points)
+		}
+
+		_, err = svc.DecideReceipt(reviewer, duplicate, DecisionReverse, "chargeback")
+		assert.NoError(t, err)
+		_, err = svc.DecideReceipt(reviewer, duplicate, DecisionApprove, "")
+		assert.ErrorIs(t, err, ErrInvalidTransition)
+		balance, err = svc.Balance(ctx, "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, points, balance.Points)
+	})
+
+	t.Run("erasing the original clears its fingerprint", func(t *testing.T) {
+		other := *receipt
+		other.PurchaseTime = "14:01"
+		id, err := svc.ProcessReceipt(ctx, &other)
+		assert.NoError(t, err)
+		assert.NoError(t, svc.DeleteReceipt(reviewer, id, "erasure"))
+		id, err = svc.ProcessReceipt(ctx, &other)
+		assert.NoError(t, err)
+		record, err := svc.GetReceipt(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusApproved, record.Status)
+	})
+}
+
+func TestBuildBalances(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "pos", Account: "alice", Scopes: []string{auth.ScopeSubmit}})
+	receipt := &model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+		Items: []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, Total: "6.49"}
+	_, err := svc.ProcessReceipt(ctx, receipt)
+	assert.NoError(t, err)
+
+	// take the database back to before balances were built, with a stale balance left over
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		bucket := tenantBucket(tx, DefaultTenant, "balances")
+		if err := bucket.Put([]byte("alice"), []byte(`{"account":"alice","points":99}`)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("meta")).Put([]byte("schemaVersion"), []byte("5"))
+	}))
+	applied, err := database.Migrate(db, false)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	balance, err := svc.Balance(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, Balance{Account: "alice", Points: 12}, balance)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+)
+
+// Rule awards points for one property of a receipt.
+type Rule struct {
+	Name  string
+	Apply func(receipt *model.Receipt) int
+}
+
+// RuleHit records the points a rule awarded to a receipt.
+type RuleHit struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+}
+
+// RulesVersion identifies the scoring behaviour of DefaultRules. Bump it whenever a rule is added, removed or
+// changes the points it awards, so clients can tell which rules scored a receipt.
+const RulesVersion = "1"
+
+// afternoonWindow is when the afternoon purchase rule awards points: after 2:00pm and before 4:00pm.
+var afternoonWindow = TimeWindow{Start: "14:00", End: "16:00"}
+
+// DefaultRules are the rules used to score every receipt, in the order they are applied.
+var DefaultRules = []Rule{
+	// Rule 1: One point for every alphanumeric character in the retailer name
+	{Name: "retailer_name", Apply: func(receipt *model.Receipt) int {
+		return countAlphanumericCharacters(receipt.Retailer)
+	}},
+	// Rule 2: 50 points if the total is a round dollar amount with no cents
+	{Name: "round_total", Apply: func(receipt *model.Receipt) int {
+		total, err := strconv.ParseFloat(receipt.Total, 64)
+		if err == nil && total == math.Floor(total) {
+			return 50
+		}
+		return 0
+	}},
+	// Rule 3: 25 points if the total is a multiple of 0.25
+	{Name: "quarter_total", Apply: func(receipt *model.Receipt) int {
+		total, err := strconv.ParseFloat(receipt.Total, 64)
+		if err == nil && math.Mod(total, 0.25) == 0 {
+			return 25
+		}
+		return 0
+	}},
+	// Rule 4: 5 points for every two items on the receipt
+	{Name: "item_pairs", Apply: func(receipt *model.Receipt) int {
+		return 5 * (len(receipt.Items) / 2)
+	}},
+	// Rule 5: If the trimmed length of the item description is a multiple of 3, multiply the price by 0.2
+	// and round up to the nearest integer. The result is the number of points earned.
+	{Name: "item_description", Apply: func(receipt *model.Receipt) int {
+		points := 0
+		for _, item := range receipt.Items {
+			trimmedLength := len(strings.Trim(item.ShortDescription, " "))
+			if trimmedLength%3 == 0 {
+				priceFloat, _ := strconv.ParseFloat(item.Price, 64)
+				points += int(math.Ceil(priceFloat * 0.2))
+			}
+		}
+		return points
+	}},
+	// Rule 6: 6 points if the day in the purchase date is odd. Like the purchase time, the date is the store's
+	// local one, as Normalize converts timestamps to the store's time zone.
+	{Name: "odd_day", Apply: func(receipt *model.Receipt) int {
+		if receipt.PurchaseDate == "" {
+			return 0
+		}
+		purchaseDate, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
+		if purchaseDate.Day()%2 != 0 {
+			return 6
+		}
+		return 0
+	}},
+	// Rule 7: 10 points if the time of purchase is after 2:00pm and before 4:00pm, so neither 2:00pm nor 4:00pm counts
+	TimeWindowRule{Name: "afternoon_purchase", Points: 10, Window: afternoonWindow}.Rule(),
+}
+
+// ValidateRules checks that rules is a usable rule set: not empty, and every rule has a unique name and an Apply func.
+func ValidateRules(rules []Rule) error {
+	if len(rules) == 0 {
+		return errors.New("rule set is empty")
+	}
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		if rule.Name == "" || rule.Apply == nil {
+			return fmt.Errorf("rule %d has no name or no Apply func", i)
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("rule %q is defined more than once", rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+	return nil
+}
+
+// Calculate points for a receipt based on the defined rules
+func CalculatePoints(receipt *model.Receipt) int {
+	points, _ := ScoreReceipt(receipt, DefaultRules)
+	return points
+}
+
+// ScoreReceipt applies rules to the receipt and returns the total along with every rule that awarded points.
+func ScoreReceipt(receipt *model.Receipt, rules []Rule) (int, []RuleHit) {
+	points := 0
+	var hits []RuleHit
+	for _, rule := range rules {
+		awarded := rule.Apply(receipt)
+		if awarded != 0 {
+			hits = append(hits, RuleHit{Rule: rule.Name, Points: awarded})
+		}
+		points += awarded
+		log.Printf("Points after rule %s: %d\n", rule.Name, points)
+	}
+	return points, hits
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/auth"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultTenant owns the receipts submitted without a tenant. Its data lives in the top level
+// receipts and points buckets, so stores created before tenants existed keep working unchanged.
+const DefaultTenant = auth.DefaultTenant
+
+var (
+	// ErrTenantNotFound is returned when a tenant id has not been provisioned.
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrInvalidTenant is returned when a tenant has a bad id, an unknown rule or an invalid time window rule.
+	ErrInvalidTenant = errors.New("invalid tenant")
+	// ErrTenantExists is returned when provisioning a tenant id that is already taken.
+	ErrTenantExists = errors.New("tenant already exists")
+)
+
+// tenantIDPattern keeps tenant ids usable in headers, urls and bucket names.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant is a loyalty program with its own receipts and rule set.
+type Tenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Rules names the DefaultRules that score this tenant's receipts. Empty means every rule.
+	Rules []string `json:"rules,omitempty"`
+	// TimeWindows are rules of the tenant's own that award points to receipts bought at certain times.
+	TimeWindows []TimeWindowRule `json:"timeWindows,omitempty"`
+	// Retention, if set, replaces the janitor's default retention for this tenant's receipts.
+	Retention *Retention `json:"retention,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// RuleSet returns the rules that score the tenant's receipts, in DefaultRules order followed by its time windows.
+func (t *Tenant) RuleSet() []Rule {
+	if len(t.Rules) == 0 && len(t.TimeWindows) == 0 {
+		return DefaultRules
+	}
+	var rules []Rule
+	for _, rule := range DefaultRules {
+		if len(t.Rules) == 0 || slices.Contains(t.Rules, rule.Name) {
+			rules = append(rules, rule)
+		}
+	}
+	for _, window := range t.TimeWindows {
+		rules = append(rules, window.Rule())
+	}
+	return rules
+}
+
+// validateRules checks that the tenant's rules exist in DefaultRules and that its rule set is valid.
+func (t *Tenant) validateRules() error {
+	for _, name := range t.Rules {
+		if !slices.ContainsFunc(DefaultRules, func(rule Rule) bool { return rule.Name == name }) {
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	for _, window := range t.TimeWindows {
+		if err := window.Validate(); err != nil {
+			return err
+		}
+	}
+	return ValidateRules(t.RuleSet())
+}
+
+// ValidateRuleSets checks DefaultRules and the rule set of every stored tenant, which may name rules this build
+// no longer has.
+func (s *ReceiptService) ValidateRuleSets() error {
+	if err := ValidateRules(DefaultRules); err != nil {
+		return err
+	}
+	tenants, err := s.Tenants()
+	if err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		if err := t.validateRules(); err != nil {
+			return fmt.Errorf("tenant %s: %w", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// CreateTenant validates and stores a new tenant.
+func (s *ReceiptService) CreateTenant(t Tenant) (Tenant, error) {
+	if !tenantIDPattern.MatchString(t.ID) || t.ID == DefaultTenant {
+		return t, fmt.Errorf("%w: id must be lowercase letters, digits and dashes, and not %q", ErrInvalidTenant, DefaultTenant)
+	}
+	if t.Name == "" {
+		return t, fmt.Errorf("%w: name is required", ErrInvalidTenant)
+	}
+	if err := t.validateRules(); err != nil {
+		return t, fmt.Errorf("%w: %w", ErrInvalidTenant, err)
+	}
+	if t.Retention != nil {
+		if err := t.Retention.Validate(); err != nil {
+			return t, err
+		}
+	}
+	t.CreatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return t, err
+	}
+	err = s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("tenants"))
+		if bucket.Get([]byte(t.ID)) != nil {
+			return ErrTenantExists
+		}
+		return bucket.Put([]byte(t.ID), data)
+	})
+	return t, err
+}
+
+// Tenant returns the tenant with id, or ErrTenantNotFound. The default tenant always exists.
+func (s *ReceiptService) Tenant(id string) (*Tenant, error) {
+	if id == DefaultTenant {
+		return &Tenant{ID: DefaultTenant, Name: DefaultTenant}, nil
+	}
+	var t Tenant
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte("tenants")).Get([]byte(id))
+		if data == nil {
+			return ErrTenantNotFound
+		}
+		return json.Unmarshal(data, &t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Tenants returns every provisioned tenant, not including the default tenant.
+func (s *ReceiptService) Tenants() ([]Tenant, error) {
+	tenants := []Tenant{}
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("tenants")).ForEach(func(_, v []byte) error {
+			var t Tenant
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			tenants = append(tenants, t)
+			return nil
+		})
+	})
+	return tenants, err
+}
+
+// OnDeleteTenant registers fn to remove what else belongs to a tenant in tx, the transaction that deletes it,
+// such as its webhook subscriptions. An error from fn fails the deletion.
+func (s *ReceiptService) OnDeleteTenant(fn func(tx *bolt.Tx, tenant string) error) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.tenantDeleters = append(s.tenantDeleters, fn)
+}
+
+// DeleteTenant removes a tenant along with all of its receipts and api keys, and runs the OnDeleteTenant
+// functions, all in one transaction, so a tenant later created with the same id starts empty.
+func (s *ReceiptService) DeleteTenant(id string) error {
+	// the cache cannot be searched by tenant, and deleting a tenant is rare
+	defer s.purgePoints()
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("tenants"))
+		if bucket.Get([]byte(id)) == nil {
+			return ErrTenantNotFound
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := auth.RevokeTenantKeys(tx, id); err != nil {
+			return err
+		}
+		for _, fn := range s.tenantDeleters {
+			if err := fn(tx, id); err != nil {
+				return err
+			}
+		}
+		err := tx.Bucket([]byte("tenantdata")).DeleteBucket([]byte(id))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// tenantFrom returns the tenant the principal in ctx acts in.
+func tenantFrom(ctx context.Context) string {
+	if p := auth.PrincipalFrom(ctx); p != nil && p.Tenant != "" {
+		return p.Tenant
+	}
+	return DefaultTenant
+}
+
+// tenantBucket returns tenant's bucket called name, or nil if the tenant has not stored anything yet.
+func tenantBucket(tx *bolt.Tx, tenant, name string) *bolt.Bucket {
+	if tenant == DefaultTenant {
+		return tx.Bucket([]byte(name))
+	}
+	data := tx.Bucket([]byte("tenantdata")).Bucket([]byte(tenant))
+	if data == nil {
+		return nil
+	}
+	return data.Bucket([]byte(name))
+}
+
+// createTenantBucket returns tenant's bucket called name, creating it if needed.
+func createTenantBucket(tx *bolt.Tx, tenant, name string) (*bolt.Bucket, error) {
+	if tenant == DefaultTenant {
+		return tx.Bucket([]byte(name)), nil
+	}
+	data, err := tx.Bucket([]byte("tenantdata")).CreateBucketIfNotExists([]byte(tenant))
+	if err != nil {
+		return nil, err
+	}
+	return data.CreateBucketIfNotExists([]byte(name))
+}
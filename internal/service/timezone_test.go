@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePurchase(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipt  model.Receipt
+		date     string
+		time     string
+		timezone string
+		field    string
+	}{
+		{name: "legacy fields", receipt: model.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "14:30"}, date: "2024-03-01", time: "14:30"},
+		{name: "timestamp with an offset", receipt: model.Receipt{PurchasedAt: "2024-03-01T14:30:00-06:00"},
+			date: "2024-03-01", time: "14:30", timezone: "-06:00"},
+		{name: "timestamp in UTC with the store's zone", receipt: model.Receipt{PurchasedAt: "2024-03-01T20:30:00Z", PurchaseTimezone: "America/Chicago"},
+			date: "2024-03-01", time: "14:30", timezone: "America/Chicago"},
+		{name: "timestamp on the next day in UTC", receipt: model.Receipt{PurchasedAt: "2024-03-02T03:15:00Z", PurchaseTimezone: "America/Los_Angeles"},
+			date: "2024-03-01", time: "19:15", timezone: "America/Los_Angeles"},
+		{name: "matching legacy fields", receipt: model.Receipt{PurchasedAt: "2024-03-01T14:30:00+05:30", PurchaseDate: "2024-03-01", PurchaseTime: "14:30"},
+			date: "2024-03-01", time: "14:30", timezone: "+05:30"},
+		{name: "date that does not match", receipt: model.Receipt{PurchasedAt: "2024-03-01T14:30:00Z", PurchaseDate: "2024-03-02"}, field: "purchaseDate"},
+		{name: "time that does not match", receipt: model.Receipt{PurchasedAt: "2024-03-01T14:30:00Z", PurchaseTime: "15:30"}, field: "purchaseTime"},
+		{name: "invalid timestamp", receipt: model.Receipt{PurchasedAt: "2024-03-01 14:30"}, field: "purchasedAt"},
+		{name: "unknown time zone", receipt: model.Receipt{PurchasedAt: "2024-03-01T14:30:00Z", PurchaseTimezone: "Mars/Olympus"}, field: "purchaseTimezone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := tt.receipt
+			err := receipt.Normalize()
+			if tt.field != "" {
+				var validationErr *model.ValidationError
+				assert.True(t, errors.As(err, &validationErr))
+				assert.Equal(t, tt.field, validationErr.Field)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.date, receipt.PurchaseDate)
+			assert.Equal(t, tt.time, receipt.PurchaseTime)
+			assert.Equal(t, tt.timezone, receipt.PurchaseTimezone)
+			assert.Empty(t, receipt.PurchasedAt)
+		})
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	for _, timezone := range []string{"", "Z", "UTC", "America/Chicago", "+05:30", "-11:00"} {
+		assert.NoError(t, (&model.Receipt{PurchaseTimezone: timezone, Total: "1.00"}).Validate(), timezone)
+	}
+	for _, timezone := range []string{"Local", "Mars/Olympus", "+5:30", "+24:00"} {
+		assert.Error(t, (&model.Receipt{PurchaseTimezone: timezone, Total: "1.00"}).Validate(), timezone)
+	}
+}
+
+func TestPurchase(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	assert.NoError(t, err)
+
+	purchase, ok := (&model.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "14:30"}).Purchase(nil)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC), purchase)
+
+	purchase, ok = (&model.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "14:30"}).Purchase(chicago)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 1, 20, 30, 0, 0, time.UTC), purchase.UTC())
+
+	// the receipt's own zone wins over the fallback
+	purchase, ok = (&model.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "14:30", PurchaseTimezone: "+01:00"}).Purchase(chicago)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 1, 13, 30, 0, 0, time.UTC), purchase.UTC())
+
+	// the wall clock time is kept on the day clocks go forward
+	purchase, ok = (&model.Receipt{PurchaseDate: "2024-03-10", PurchaseTime: "14:30", PurchaseTimezone: "America/Chicago"}).Purchase(nil)
+	assert.True(t, ok)
+	assert.Equal(t, "14:30", purchase.Format("15:04"))
+	assert.Equal(t, time.Date(2024, 3, 10, 19, 30, 0, 0, time.UTC), purchase.UTC())
+
+	_, ok = (&model.Receipt{PurchaseTime: "14:30"}).Purchase(nil)
+	assert.False(t, ok)
+}
+
+func TestProcessReceiptTimezone(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	svc := NewReceiptService(db)
+	svc.now = func() time.Time { return time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC) }
+	receipt := func(purchasedAt, timezone string) *model.Receipt {
+		return &model.Receipt{Retailer: "", PurchasedAt: purchasedAt, PurchaseTimezone: timezone,
+			Items: []model.Item{{ShortDescription: "Pepsi", Price: "1.30"}}, Total: "1.30"}
+	}
+
+	// 20:30 UTC on the 1st is 14:30 in Chicago: an odd day in the afternoon
+	id, err := svc.ProcessReceipt(context.Background(), receipt("2024-03-01T20:30:00Z", "America/Chicago"))
+	assert.NoError(t, err)
+	points, err := svc.GetPoints(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, points)
+	record, err := svc.GetReceipt(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "14:30", PurchaseTimezone: "America/Chicago",
+		Items: []model.Item{{ShortDescription: "Pepsi", Price: "1.30"}}, Total: "1.30"}, record.Receipt)
+
+	// the same instant read as UTC is neither
+	id, err = svc.ProcessReceipt(context.Background(), receipt("2024-03-01T20:30:00Z", ""))
+	assert.NoError(t, err)
+	points, err = svc.GetPoints(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, points)
+
+	// 01:30 UTC on the 2nd is still the 1st in Los Angeles
+	id, err = svc.ProcessReceipt(context.Background(), receipt("2024-03-02T01:30:00Z", "America/Los_Angeles"))
+	assert.NoError(t, err)
+	points, err = svc.GetPoints(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, points)
+
+	// receipts are checked against the date policy at their instant
+	_, err = svc.ProcessReceipt(context.Background(), receipt("2024-03-03T20:00:00+09:00", ""))
+	assert.NoError(t, err)
+	_, err = svc.ProcessReceipt(context.Background(), receipt("2024-03-03T20:00:00-09:00", ""))
+	var validationErr *model.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, CodePurchaseInFuture, validationErr.Code)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+)
+
+// ErrInvalidTimeWindow is returned for a time window rule with a bad name, time, day or points.
+var ErrInvalidTimeWindow = errors.New("invalid time window")
+
+// weekdays are the names TimeWindow.Days accepts, in time.Weekday order.
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// TimeWindow is a range of local times of day in which a purchase can be made, as "15:04" times with minute
+// resolution. A window whose End is before its Start crosses midnight, so 22:00 to 02:00 is four hours.
+type TimeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// StartInclusive and EndInclusive say whether a purchase made at exactly Start or End is in the window.
+	StartInclusive bool `json:"startInclusive,omitempty"`
+	EndInclusive   bool `json:"endInclusive,omitempty"`
+	// Days limits the window to purchases on these days of the week, named in English. Empty means every day.
+	// A window that crosses midnight belongs to the day it starts on, so a Friday 22:00 to 02:00 window
+	// includes 01:00 on Saturday but not 01:00 on Friday.
+	Days []string `json:"days,omitempty"`
+}
+
+// Validate checks that Start and End are times, that the window is not empty and that Days are days of the week.
+// Start and End may only be equal if both are inclusive, making a window of one minute.
+func (w *TimeWindow) Validate() error {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return fmt.Errorf("%w: start %q is not a time such as 14:00", ErrInvalidTimeWindow, w.Start)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return fmt.Errorf("%w: end %q is not a time such as 16:00", ErrInvalidTimeWindow, w.End)
+	}
+	if start.Equal(end) && !(w.StartInclusive && w.EndInclusive) {
+		return fmt.Errorf("%w: a window that starts when it ends must include both", ErrInvalidTimeWindow)
+	}
+	for _, day := range w.Days {
+		if !slices.Contains(weekdays, strings.ToLower(day)) {
+			return fmt.Errorf("%w: %q is not a day of the week", ErrInvalidTimeWindow, day)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether receipt was bought in the window, by its local purchase date and time. Receipts
+// without a valid purchase time are never in it, nor are receipts without a date in windows limited to some days.
+func (w *TimeWindow) Contains(receipt *model.Receipt) bool {
+	purchase, err := time.Parse("15:04", receipt.PurchaseTime)
+	if err != nil {
+		return false
+	}
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return false
+	}
+	afterStart := purchase.After(start) || w.StartInclusive && purchase.Equal(start)
+	beforeEnd := purchase.Before(end) || w.EndInclusive && purchase.Equal(end)
+	var inside, nextDay bool
+	if end.Before(start) {
+		inside = afterStart || beforeEnd
+		nextDay = !afterStart
+	} else {
+		inside = afterStart && beforeEnd
+	}
+	if !inside || len(w.Days) == 0 {
+		return inside
+	}
+
+	date, err := time.Parse("2006-01-02", receipt.PurchaseDate)
+	if err != nil {
+		return false
+	}
+	if nextDay {
+		date = date.AddDate(0, 0, -1)
+	}
+	return slices.ContainsFunc(w.Days, func(day string) bool { return strings.EqualFold(day, weekdays[date.Weekday()]) })
+}
+
+// TimeWindowRule awards Points to receipts bought within Window. Tenants can add their own alongside DefaultRules.
+type TimeWindowRule struct {
+	Name   string     `json:"name"`
+	Points int        `json:"points"`
+	Window TimeWindow `json:"window"`
+}
+
+// Validate checks that the rule has a name, awards points and has a valid window.
+func (r *TimeWindowRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTimeWindow)
+	}
+	if r.Points == 0 {
+		return fmt.Errorf("%w: rule %q awards no points", ErrInvalidTimeWindow, r.Name)
+	}
+	if err := r.Window.Validate(); err != nil {
+		return fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	return nil
+}
+
+// Rule returns the scoring rule that applies r.
+func (r TimeWindowRule) Rule() Rule {
+	return Rule{Name: r.Name, Apply: func(receipt *model.Receipt) int {
+		if r.Window.Contains(receipt) {
+			return r.Points
+		}
+		return 0
+	}}
+}
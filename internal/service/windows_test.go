@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	afternoon := TimeWindow{Start: "14:00", End: "16:00"}
+	closed := TimeWindow{Start: "14:00", End: "16:00", StartInclusive: true, EndInclusive: true}
+	startOnly := TimeWindow{Start: "14:00", End: "16:00", StartInclusive: true}
+	endOnly := TimeWindow{Start: "14:00", End: "16:00", EndInclusive: true}
+	overnight := TimeWindow{Start: "22:00", End: "02:00"}
+	overnightClosed := TimeWindow{Start: "22:00", End: "02:00", StartInclusive: true, EndInclusive: true}
+	// 2024-03-01 is a Friday
+	fridayNight := TimeWindow{Start: "22:00", End: "02:00", StartInclusive: true, Days: []string{"Friday"}}
+	weekend := TimeWindow{Start: "00:00", End: "23:59", StartInclusive: true, EndInclusive: true, Days: []string{"saturday", "sunday"}}
+	minute := TimeWindow{Start: "12:00", End: "12:00", StartInclusive: true, EndInclusive: true}
+
+	tests := []struct {
+		window TimeWindow
+		date   string
+		time   string
+		want   bool
+	}{
+		{afternoon, "2024-03-01", "13:59", false},
+		{afternoon, "2024-03-01", "14:00", false},
+		{afternoon, "2024-03-01", "14:01", true},
+		{afternoon, "2024-03-01", "15:00", true},
+		{afternoon, "2024-03-01", "15:59", true},
+		{afternoon, "2024-03-01", "16:00", false},
+		{afternoon, "2024-03-01", "16:01", false},
+		{afternoon, "", "14:30", true},
+		{afternoon, "2024-03-01", "", false},
+
+		{closed, "2024-03-01", "13:59", false},
+		{closed, "2024-03-01", "14:00", true},
+		{closed, "2024-03-01", "16:00", true},
+		{closed, "2024-03-01", "16:01", false},
+
+		{startOnly, "2024-03-01", "14:00", true},
+		{startOnly, "2024-03-01", "16:00", false},
+		{endOnly, "2024-03-01", "14:00", false},
+		{endOnly, "2024-03-01", "16:00", true},
+
+		{overnight, "2024-03-01", "21:59", false},
+		{overnight, "2024-03-01", "22:00", false},
+		{overnight, "2024-03-01", "22:01", true},
+		{overnight, "2024-03-01", "23:59", true},
+		{overnight, "2024-03-01", "00:00", true},
+		{overnight, "2024-03-01", "01:59", true},
+		{overnight, "2024-03-01", "02:00", false},
+		{overnight, "2024-03-01", "12:00", false},
+		{overnightClosed, "2024-03-01", "22:00", true},
+		{overnightClosed, "2024-03-01", "02:00", true},
+		{overnightClosed, "2024-03-01", "02:01", false},
+
+		{fridayNight, "2024-03-01", "21:59", false},
+		{fridayNight, "2024-03-01", "22:00", true},
+		{fridayNight, "2024-03-01", "23:59", true},
+		{fridayNight, "2024-03-02", "00:00", true},
+		{fridayNight, "2024-03-02", "01:59", true},
+		{fridayNight, "2024-03-02", "02:00", false},
+		{fridayNight, "2024-03-01", "01:00", false},
+		{fridayNight, "2024-03-02", "22:00", false},
+		{fridayNight, "", "23:00", false},
+
+		{weekend, "2024-03-01", "23:59", false},
+		{weekend, "2024-03-02", "00:00", true},
+		{weekend, "2024-03-03", "23:59", true},
+		{weekend, "2024-03-04", "00:00", false},
+
+		{minute, "2024-03-01", "11:59", false},
+		{minute, "2024-03-01", "12:00", true},
+		{minute, "2024-03-01", "12:01", false},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s-%s %v %s %s", tt.window.Start, tt.window.End, tt.window.Days, tt.date, tt.time)
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, tt.window.Validate())
+			assert.Equal(t, tt.want, tt.window.Contains(&model.Receipt{PurchaseDate: tt.date, PurchaseTime: tt.time}))
+		})
+	}
+}
+
+func TestTimeWindowValidate(t *testing.T) {
+	for _, window := range []TimeWindow{
+		{Start: "2pm", End: "16:00"},
+		{Start: "14:00", End: "24:00"},
+		{Start: "14:00", End: "14:00"},
+		{Start: "14:00", End: "14:00", StartInclusive: true},
+		{Start: "14:00", End: "16:00", Days: []string{"someday"}},
+	} {
+		err := window.Validate()
+		assert.True(t, errors.Is(err, ErrInvalidTimeWindow), "%+v", window)
+	}
+	for _, rule := range []TimeWindowRule{
+		{Points: 5, Window: TimeWindow{Start: "14:00", End: "16:00"}},
+		{Name: "none", Window: TimeWindow{Start: "14:00", End: "16:00"}},
+	} {
+		assert.ErrorIs(t, rule.Validate(), ErrInvalidTimeWindow)
+	}
+}
+
+func TestTenantTimeWindows(t *testing.T) {
+	happyHour := TimeWindowRule{Name: "happy_hour", Points: 20, Window: TimeWindow{Start: "17:00", End: "19:00", StartInclusive: true, Days: []string{"friday"}}}
+	tenant := Tenant{ID: "acme", Name: "Acme", Rules: []string{"odd_day"}, TimeWindows: []TimeWindowRule{happyHour}}
+	assert.NoError(t, ValidateRules(tenant.RuleSet()))
+
+	points, hits := ScoreReceipt(&model.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "17:00", Total: "1.30"}, tenant.RuleSet())
+	assert.Equal(t, 26, points)
+	assert.Equal(t, []RuleHit{{Rule: "odd_day", Points: 6}, {Rule: "happy_hour", Points: 20}}, hits)
+
+	// time windows are added to every default rule when none are named
+	tenant.Rules = nil
+	assert.Len(t, tenant.RuleSet(), len(DefaultRules)+1)
+
+	tenant.TimeWindows = append(tenant.TimeWindows, TimeWindowRule{Name: "odd_day", Points: 1, Window: happyHour.Window})
+	assert.Error(t, ValidateRules(tenant.RuleSet()))
+}
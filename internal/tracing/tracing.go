@@ -0,0 +1,159 @@
+// Package tracing configures OpenTelemetry tracing and starts server spans for incoming HTTP and gRPC
+// requests, continuing any W3C trace context the caller sent.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName identifies this application in exported spans.
+const ServiceName = "receipt-processor"
+
+var tracer = otel.Tracer("github.com/pranathireddyk/receipt-processor/internal/tracing")
+
+// Exporters builds span exporters by name from the argument after the colon in an exporter spec.
+// Register another constructor here to plug in a different backend.
+var Exporters = map[string]func(arg string) (sdktrace.SpanExporter, error){
+	// stdout writes indented JSON spans to standard output
+	"stdout": func(string) (sdktrace.SpanExporter, error) {
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	},
+	// file appends one JSON span per line to the named file
+	"file": func(path string) (sdktrace.SpanExporter, error) {
+		if path == "" {
+			return nil, fmt.Errorf("file exporter needs a path, as in file:traces.json")
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	},
+}
+
+// NewExporter creates the exporter named by spec, which is a name from Exporters optionally
+// followed by a colon and an argument, such as "stdout" or "file:traces.json".
+func NewExporter(spec string) (sdktrace.SpanExporter, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	newExporter, ok := Exporters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown trace exporter %q", name)
+	}
+	return newExporter(arg)
+}
+
+// Setup installs a global tracer provider that batches spans to exporter, and the W3C trace context
+// and baggage propagators. The caller should shut the provider down on exit to flush pending spans.
+func Setup(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider
+}
+
+// Middleware starts a server span for every request, as a child of the traceparent header if there is one.
+func Middleware(c *gin.Context) {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(c.Request.Method), semconv.HTTPRoute(route)))
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+	code := c.Writer.Status()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(code))
+	if code >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(code))
+	}
+}
+
+// UnaryServerInterceptor is the gRPC equivalent of Middleware for unary calls.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, span := startRPC(ctx, info.FullMethod)
+	defer span.End()
+	resp, err := handler(ctx, req)
+	endRPC(span, err)
+	return resp, err
+}
+
+// StreamServerInterceptor is the gRPC equivalent of Middleware for streaming calls.
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := startRPC(ss.Context(), info.FullMethod)
+	defer span.End()
+	err := handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+	endRPC(span, err)
+	return err
+}
+
+func startRPC(ctx context.Context, method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	return tracer.Start(ctx, strings.TrimPrefix(method, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCMethod(method)))
+}
+
+func endRPC(span trace.Span, err error) {
+	st := status.Convert(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+	if err != nil {
+		span.SetStatus(codes.Error, st.Message())
+	}
+}
+
+// tracedStream overrides the stream context so handlers see the span.
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// metadataCarrier reads and writes trace context in gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
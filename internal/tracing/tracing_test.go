@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	exporter, err := NewExporter("file:" + path)
+	assert.NoError(t, err)
+	provider := Setup(exporter)
+
+	_, span := tracer.Start(context.Background(), "test-span")
+	span.End()
+	assert.NoError(t, provider.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"test-span"`)
+	assert.Contains(t, string(data), ServiceName)
+
+	_, err = NewExporter("zipkin")
+	assert.Error(t, err)
+	_, err = NewExporter("file")
+	assert.Error(t, err)
+}
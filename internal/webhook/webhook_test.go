@@ -0,0 +1,290 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pranathireddyk/receipt-processor/internal/database"
+	"github.com/pranathireddyk/receipt-processor/internal/service"
+	model "github.com/pranathireddyk/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local webhook endpoint that fails the first failures requests.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	received []receivedWebhook
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	r.received = append(r.received, receivedWebhook{header: req.Header, body: body})
+}
+
+func (r *receiver) webhooks() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.received...)
+}
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, *service.ReceiptService) {
+	t.Helper()
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	t.Cleanup(func() { db.Close() })
+	svc := service.NewReceiptService(db)
+	d := NewDispatcher(db)
+	svc.SubscribeTx(d.Record)
+	svc.Subscribe(d.Notify)
+	return d, svc
+}
+
+func testReceipt() *model.Receipt {
+	return &model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	}
+}
+
+func TestSignedDelivery(t *testing.T) {
+	d, svc := newTestDispatcher(t)
+	recv := &receiver{}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	sub, err := d.CreateSubscription(Subscription{URL: ts.URL, Events: []string{service.EventReceiptScored}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, sub.Secret)
+
+	id, err := svc.ProcessReceipt(context.Background(), testReceipt())
+	assert.NoError(t, err)
+	// rejected receipts are not delivered to a subscription that only wants receipt.scored
+	invalid := testReceipt()
+	invalid.Total = "abc"
+	_, err = svc.ProcessReceipt(context.Background(), invalid)
+	assert.Error(t, err)
+
+	assert.NoError(t, d.DeliverDue(context.Background()))
+	received := recv.webhooks()
+	assert.Len(t, received, 1)
+
+	header := received[0].header
+	assert.Equal(t, service.EventReceiptScored, header.Get("X-Webhook-Event"))
+	expected := "sha256=" + Sign(sub.Secret, header.Get("X-Webhook-Timestamp"), received[0].body)
+	assert.Equal(t, expected, header.Get("X-Webhook-Signature"))
+
+	var event service.Event
+	assert.NoError(t, json.Unmarshal(received[0].body, &event))
+	assert.Equal(t, id, event.ReceiptID)
+	assert.Equal(t, "Target", event.Retailer)
+
+	pending, err := d.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestOutboxCommitsWithTheReceipt(t *testing.T) {
+	d, svc := newTestDispatcher(t)
+	_, err := d.CreateSubscription(Subscription{URL: "https://example.com/hook", Events: []string{service.EventReceiptScored}})
+	assert.NoError(t, err)
+
+	// a receipt that fails to be stored leaves no delivery behind
+	failing := service.NewReceiptService(svc.DB)
+	failing.SubscribeTx(d.Record)
+	errFull := errors.New("full")
+	failing.SubscribeTx(func(*bolt.Tx, service.Event) error { return errFull })
+	_, err = failing.ProcessReceipt(context.Background(), testReceipt())
+	assert.ErrorIs(t, err, errFull)
+	pending, err := d.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// a stored receipt has its delivery in the outbox as soon as it is committed
+	id, err := svc.ProcessReceipt(context.Background(), testReceipt())
+	assert.NoError(t, err)
+	pending, err = d.Pending()
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		var event service.Event
+		assert.NoError(t, json.Unmarshal(pending[0].Payload, &event))
+		assert.Equal(t, id, event.ReceiptID)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	d, svc := newTestDispatcher(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	d.MaxAttempts = 3
+	recv := &receiver{failures: 1}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	_, err := d.CreateSubscription(Subscription{URL: ts.URL, Events: []string{service.EventReceiptRejected}})
+	assert.NoError(t, err)
+	invalid := testReceipt()
+	invalid.PurchaseDate = "2022-13-01"
+	_, err = svc.ProcessReceipt(context.Background(), invalid)
+	assert.Error(t, err)
+
+	ctx := context.Background()
+	assert.NoError(t, d.DeliverDue(ctx))
+	pending, err := d.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, now.Add(d.RetryDelay), pending[0].NextAttempt)
+
+	// not due yet
+	assert.NoError(t, d.DeliverDue(ctx))
+	assert.Empty(t, recv.webhooks())
+
+	now = now.Add(d.RetryDelay)
+	assert.NoError(t, d.DeliverDue(ctx))
+	received := recv.webhooks()
+	assert.Len(t, received, 1)
+	assert.Equal(t, service.EventReceiptRejected, received[0].header.Get("X-Webhook-Event"))
+	pending, err = d.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestSubscriptions(t *testing.T) {
+	d, svc := newTestDispatcher(t)
+
+	_, err := d.CreateSubscription(Subscription{URL: "ftp://example.com", Events: []string{service.EventReceiptScored}})
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+	_, err = d.CreateSubscription(Subscription{URL: "http://example.com", Events: []string{"receipt.archived"}})
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	sub, err := d.CreateSubscription(Subscription{URL: "http://example.com", Events: []string{service.EventReceiptScored}, Secret: "s3cret"})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", sub.Secret)
+	subs, err := d.Subscriptions()
+	assert.NoError(t, err)
+	assert.Len(t, subs, 1)
+	assert.Empty(t, subs[0].Secret)
+
+	// deliveries for a deleted subscription are dropped
+	_, err = svc.ProcessReceipt(context.Background(), testReceipt())
+	assert.NoError(t, err)
+	assert.NoError(t, d.DeleteSubscription(sub.ID))
+	assert.ErrorIs(t, d.DeleteSubscription(sub.ID), ErrSubscriptionNotFound)
+	assert.NoError(t, d.DeliverDue(context.Background()))
+	pending, err := d.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestTenantSubscriptionAddresses(t *testing.T) {
+	d, _ := newTestDispatcher(t)
+	resolved := map[string][]netip.Addr{
+		"metadata.internal": {netip.MustParseAddr("169.254.169.254")},
+		"hooks.example":     {netip.MustParseAddr("203.0.113.10")},
+		// registered as public, but connecting resolves it to loopback
+		"localhost": {netip.MustParseAddr("203.0.113.11")},
+	}
+	d.lookup = func(_ context.Context, host string) ([]netip.Addr, error) {
+		if addrs, ok := resolved[host]; ok {
+			return addrs, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	create := func(url string) error {
+		_, err := d.CreateSubscription(Subscription{URL: url, Events: []string{service.EventReceiptScored}, Tenant: service.DefaultTenant})
+		return err
+	}
+
+	for _, url := range []string{"http://127.0.0.1:8080/hook", "http://[::1]/hook", "http://10.0.0.5/hook", "http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data", "http://[::ffff:127.0.0.1]/hook", "http://metadata.internal/", "http://unknown.example/"} {
+		assert.ErrorIs(t, create(url), ErrInvalidSubscription, url)
+	}
+	assert.NoError(t, create("https://hooks.example/hook"))
+	assert.NoError(t, create("https://203.0.113.10/hook"))
+
+	// operators may register internal urls
+	_, err := d.CreateSubscription(Subscription{URL: "http://127.0.0.1:8080/hook", Events: []string{service.EventReceiptFlagged}})
+	assert.NoError(t, err)
+
+	t.Run("connections to private addresses are refused", func(t *testing.T) {
+		d, svc := newTestDispatcher(t)
+		d.lookup = func(context.Context, string) ([]netip.Addr, error) { return resolved["localhost"], nil }
+		recv := &receiver{}
+		ts := httptest.NewServer(recv)
+		defer ts.Close()
+		_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+		_, err := d.CreateSubscription(Subscription{URL: "http://localhost:" + port, Events: []string{service.EventReceiptScored}, Tenant: service.DefaultTenant})
+		assert.NoError(t, err)
+
+		_, err = svc.ProcessReceipt(context.Background(), testReceipt())
+		assert.NoError(t, err)
+		assert.NoError(t, d.DeliverDue(context.Background()))
+		assert.Empty(t, recv.webhooks())
+		pending, err := d.Pending()
+		assert.NoError(t, err)
+		if assert.Len(t, pending, 1) {
+			assert.Contains(t, pending[0].LastError, errPrivateAddress.Error())
+		}
+	})
+}
+
+func TestDeliveriesToSubscriptionsRunConcurrently(t *testing.T) {
+	d, svc := newTestDispatcher(t)
+	// each endpoint waits for the other, so both only succeed in time if they are sent to at once
+	var (
+		mu      sync.Mutex
+		arrived int
+		waited  atomic.Int32
+	)
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		if arrived++; arrived == 2 {
+			close(release)
+		}
+		mu.Unlock()
+		select {
+		case <-release:
+			waited.Add(1)
+		case <-time.After(2 * time.Second):
+		}
+	})
+	for i := 0; i < 2; i++ {
+		ts := httptest.NewServer(handler)
+		defer ts.Close()
+		_, err := d.CreateSubscription(Subscription{URL: ts.URL, Events: []string{service.EventReceiptScored}})
+		assert.NoError(t, err)
+	}
+
+	_, err := svc.ProcessReceipt(context.Background(), testReceipt())
+	assert.NoError(t, err)
+	assert.NoError(t, d.DeliverDue(context.Background()))
+	assert.Equal(t, int32(2), waited.Load())
+}
@@ -1,17 +1,114 @@
 package model
 
 import (
-	"errors"
+	"fmt"
+	"regexp"
 	"time"
 )
 
+// numericPattern matches the same values as the validator `numeric` binding tag.
+var numericPattern = regexp.MustCompile(`^[-+]?[0-9]+(?:\.[0-9]+)?$`)
+
+// offsetPattern matches a UTC offset such as "-05:00".
+var offsetPattern = regexp.MustCompile(`^[-+]([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
 // Receipt represents the structure of a receipt.
 type Receipt struct {
 	Retailer     string `json:"retailer"`
 	PurchaseDate string `json:"purchaseDate"`
 	PurchaseTime string `json:"purchaseTime"`
-	Items        []Item `json:"items" binding:"dive"`
-	Total        string `json:"total" binding:"numeric"`
+	// PurchaseTimezone is the store's time zone, as an IANA name such as "America/Chicago" or a UTC offset
+	// such as "-05:00". PurchaseDate and PurchaseTime are local to it. Receipts without one are read as UTC.
+	PurchaseTimezone string `json:"purchaseTimezone,omitempty"`
+	// PurchasedAt is an RFC 3339 timestamp of the purchase, which may be sent instead of the date and time.
+	// Normalize replaces it with the date, time and time zone it stands for.
+	PurchasedAt string `json:"purchasedAt,omitempty"`
+	Items       []Item `json:"items" binding:"dive"`
+	Total       string `json:"total" binding:"numeric"`
+}
+
+// ValidationError reports the receipt field that failed validation.
+type ValidationError struct {
+	Field string
+	// Reason describes the failure. It defaults to the field not being in the correct format.
+	Reason string
+	// Code identifies failures more specific than the format of the field, for clients to act on.
+	Code string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("field `%s` %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("field `%s` is not in the correct format", e.Field)
+}
+
+// ParseTimezone returns the location named by an IANA time zone name or a UTC offset, or UTC for "".
+func ParseTimezone(name string) (*time.Location, error) {
+	switch {
+	case name == "" || name == "Z":
+		return time.UTC, nil
+	case offsetPattern.MatchString(name):
+		offset, _ := time.Parse("-07:00", name)
+		_, seconds := offset.Zone()
+		return time.FixedZone(name, seconds), nil
+	case name == "Local":
+		// the server's own zone says nothing about the store's
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// Normalize replaces PurchasedAt with the PurchaseDate, PurchaseTime and PurchaseTimezone it stands for. The time
+// zone is PurchaseTimezone if it is set, and otherwise the timestamp's offset. Dates and times that are also set
+// must agree with the timestamp. Failures are returned as *ValidationError.
+func (receipt *Receipt) Normalize() error {
+	if receipt.PurchasedAt == "" {
+		return nil
+	}
+	purchasedAt, err := time.Parse(time.RFC3339, receipt.PurchasedAt)
+	if err != nil {
+		return &ValidationError{Field: "purchasedAt"}
+	}
+	timezone := receipt.PurchaseTimezone
+	if timezone == "" {
+		timezone = purchasedAt.Format("-07:00")
+	}
+	loc, err := ParseTimezone(timezone)
+	if err != nil {
+		return &ValidationError{Field: "purchaseTimezone"}
+	}
+	local := purchasedAt.In(loc)
+	date, clock := local.Format("2006-01-02"), local.Format("15:04")
+	if receipt.PurchaseDate != "" && receipt.PurchaseDate != date {
+		return &ValidationError{Field: "purchaseDate", Reason: "does not match `purchasedAt`"}
+	}
+	if receipt.PurchaseTime != "" && receipt.PurchaseTime != clock {
+		return &ValidationError{Field: "purchaseTime", Reason: "does not match `purchasedAt`"}
+	}
+	receipt.PurchaseDate, receipt.PurchaseTime, receipt.PurchaseTimezone = date, clock, timezone
+	receipt.PurchasedAt = ""
+	return nil
+}
+
+// Purchase returns when the receipt was bought, in the store's time zone, or in fallback for receipts without
+// one. The time is midnight when PurchaseTime is empty. ok is false when the date is missing or either the date
+// or the time zone is invalid. It expects a normalized receipt.
+func (receipt *Receipt) Purchase(fallback *time.Location) (purchase time.Time, ok bool) {
+	loc := fallback
+	if receipt.PurchaseTimezone != "" || loc == nil {
+		var err error
+		if loc, err = ParseTimezone(receipt.PurchaseTimezone); err != nil {
+			return time.Time{}, false
+		}
+	}
+	date, err := time.Parse("2006-01-02", receipt.PurchaseDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// the wall clock time is kept even on days the clocks change
+	clock, _ := time.Parse("15:04", receipt.PurchaseTime)
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, loc), true
 }
 
 // Validate validates that the receipt variables are in the correct format
@@ -19,14 +116,34 @@ func (receipt *Receipt) Validate() error {
 	if receipt.PurchaseDate != "" {
 		_, err := time.Parse("2006-01-02", receipt.PurchaseDate)
 		if err != nil {
-			return errors.New("field `purchaseDate` is not in the correct format")
+			return &ValidationError{Field: "purchaseDate"}
 		}
 	}
 
 	if receipt.PurchaseTime != "" {
 		_, err := time.Parse("15:04", receipt.PurchaseTime)
 		if err != nil {
-			return errors.New("field `purchaseTime` is not in the correct format")
+			return &ValidationError{Field: "purchaseTime"}
+		}
+	}
+
+	if _, err := ParseTimezone(receipt.PurchaseTimezone); err != nil {
+		return &ValidationError{Field: "purchaseTimezone"}
+	}
+	if receipt.PurchasedAt != "" {
+		if _, err := time.Parse(time.RFC3339, receipt.PurchasedAt); err != nil {
+			return &ValidationError{Field: "purchasedAt"}
+		}
+	}
+
+	// The gin binding tags already cover these for HTTP requests, but receipts
+	// arriving over other transports are only checked here.
+	if !numericPattern.MatchString(receipt.Total) {
+		return &ValidationError{Field: "total"}
+	}
+	for _, item := range receipt.Items {
+		if !numericPattern.MatchString(item.Price) {
+			return &ValidationError{Field: "price"}
 		}
 	}
 	return nil